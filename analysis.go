@@ -0,0 +1,319 @@
+package mario
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/imantung/mario/ast"
+)
+
+// Analysis represents the static dependencies of a template.
+type Analysis struct {
+	Paths           []*PathRef // context and private data paths
+	Helpers         []string   // helpers names
+	Partials        []string   // static partials names
+	DynamicPartials []string   // dynamic partials expressions, eg: "(whichPartial)"
+	BlockParams     []string   // block parameters names
+}
+
+// PathRef represents a path referenced by a template.
+type PathRef struct {
+	Original string   // path as written in template, eg: "../author.name"
+	Parts    []string // path parts, without "..", "this" and "@root"
+	Depth    int      // number of "../" segments
+	Data     bool     // true for a private data path, eg: "@index"
+	Root     bool     // true for a "@root" path
+	Loc      ast.Loc  // location of first reference
+}
+
+// String returns the canonical form of path reference.
+func (ref *PathRef) String() string {
+	result := strings.Repeat("../", ref.Depth) + strings.Join(ref.Parts, ".")
+
+	if ref.Root {
+		result = "@root." + result
+	} else if ref.Data {
+		result = "@" + result
+	}
+
+	return result
+}
+
+// Analyze walks template AST and returns all its static dependencies.
+func (tpl *Template) Analyze() *Analysis {
+	v := newAnalyzer(evaluatorHelpers(tpl.helpers))
+	v.helperCalls = tpl.helperCalls
+
+	if tpl.program != nil {
+		tpl.program.Accept(v)
+	}
+
+	return v.analysis()
+}
+
+// analyzer implements the Visitor interface to collect template dependencies
+type analyzer struct {
+	helpers map[string]*Helper
+
+	// expressions resolved as helper calls or not when parsing
+	helperCalls helperCalls
+
+	paths           map[string]*PathRef
+	helperNames     map[string]bool
+	partials        map[string]bool
+	dynamicPartials map[string]bool
+	blockParams     map[string]bool
+
+	// block parameters scopes stack
+	scopes [][]string
+}
+
+func newAnalyzer(helpers map[string]*Helper) *analyzer {
+	return &analyzer{
+		helpers:         helpers,
+		paths:           make(map[string]*PathRef),
+		helperNames:     make(map[string]bool),
+		partials:        make(map[string]bool),
+		dynamicPartials: make(map[string]bool),
+		blockParams:     make(map[string]bool),
+	}
+}
+
+// analysis returns collected dependencies, sorted
+func (v *analyzer) analysis() *Analysis {
+	result := &Analysis{
+		Helpers:         sortedKeys(v.helperNames),
+		Partials:        sortedKeys(v.partials),
+		DynamicPartials: sortedKeys(v.dynamicPartials),
+		BlockParams:     sortedKeys(v.blockParams),
+	}
+
+	var keys []string
+	for key := range v.paths {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result.Paths = append(result.Paths, v.paths[key])
+	}
+
+	return result
+}
+
+// isBlockParam returns true if given name is a block parameter in current scope
+func (v *analyzer) isBlockParam(name string) bool {
+	for i := len(v.scopes) - 1; i >= 0; i-- {
+		for _, param := range v.scopes[i] {
+			if param == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isHelperCall returns true if given expression statically looks like a helper call
+func (v *analyzer) isHelperCall(node *ast.Expression) bool {
+	if call := v.helperCalls.lookup(node); call != nil {
+		return call.known
+	}
+
+	name := node.HelperName()
+	if name == "" || v.isBlockParam(name) {
+		return false
+	}
+
+	if _, ok := v.helpers[name]; ok {
+		return true
+	}
+
+	return (len(node.Params) > 0) || (node.Hash != nil)
+}
+
+// addPath records a path reference
+func (v *analyzer) addPath(node *ast.PathExpression) {
+	if (len(node.Parts) > 0) && !node.Data && (node.Depth == 0) && v.isBlockParam(node.Parts[0]) {
+		// block parameter reference
+		return
+	}
+
+	ref := &PathRef{
+		Original: node.Original,
+		Parts:    node.Parts,
+		Depth:    node.Depth,
+		Data:     node.Data,
+		Loc:      node.Loc,
+	}
+
+	if node.IsDataRoot() {
+		ref.Root = true
+		ref.Parts = node.Parts[1:]
+	}
+
+	if len(ref.Parts) == 0 {
+		// `this`, `..` or `@root` reference a context, not a field
+		return
+	}
+
+	key := ref.String()
+	if _, ok := v.paths[key]; !ok {
+		v.paths[key] = ref
+	}
+}
+
+// sortedKeys returns sorted keys of given map
+func sortedKeys(m map[string]bool) []string {
+	var result []string
+	for key := range m {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+//
+// Visitor interface
+//
+
+// Statements
+
+// VisitProgram implements corresponding Visitor interface method
+func (v *analyzer) VisitProgram(w io.Writer, node *ast.Program) error {
+	for _, name := range node.BlockParams {
+		v.blockParams[name] = true
+	}
+
+	v.scopes = append(v.scopes, node.BlockParams)
+	for _, n := range node.Body {
+		n.Accept(v)
+	}
+	v.scopes = v.scopes[:len(v.scopes)-1]
+
+	return nil
+}
+
+// VisitMustache implements corresponding Visitor interface method
+func (v *analyzer) VisitMustache(node *ast.MustacheStatement) interface{} {
+	return node.Expression.Accept(v)
+}
+
+// VisitBlock implements corresponding Visitor interface method
+func (v *analyzer) VisitBlock(node *ast.BlockStatement) interface{} {
+	node.Expression.Accept(v)
+
+	if node.Program != nil {
+		node.Program.Accept(v)
+	}
+
+	if node.Inverse != nil {
+		node.Inverse.Accept(v)
+	}
+
+	return nil
+}
+
+// VisitPartial implements corresponding Visitor interface method
+func (v *analyzer) VisitPartial(node *ast.PartialStatement) interface{} {
+	if name, ok := ast.HelperNameStr(node.Name); ok {
+		v.partials[name] = true
+	} else if subExpr, ok := node.Name.(*ast.SubExpression); ok {
+		v.dynamicPartials["("+subExpr.Expression.Canonical()+")"] = true
+		subExpr.Accept(v)
+	}
+
+	for _, param := range node.Params {
+		param.Accept(v)
+	}
+
+	if node.Hash != nil {
+		node.Hash.Accept(v)
+	}
+
+	return nil
+}
+
+// VisitContent implements corresponding Visitor interface method
+func (v *analyzer) VisitContent(node *ast.ContentStatement) interface{} {
+	return nil
+}
+
+// VisitComment implements corresponding Visitor interface method
+func (v *analyzer) VisitComment(node *ast.CommentStatement) interface{} {
+	return nil
+}
+
+// Expressions
+
+// VisitExpression implements corresponding Visitor interface method
+func (v *analyzer) VisitExpression(node *ast.Expression) interface{} {
+	if v.isHelperCall(node) {
+		v.helperNames[node.HelperName()] = true
+	} else if path := node.FieldPath(); path != nil {
+		v.addPath(path)
+	}
+
+	for _, param := range node.Params {
+		param.Accept(v)
+	}
+
+	if node.Hash != nil {
+		node.Hash.Accept(v)
+	}
+
+	return nil
+}
+
+// VisitSubExpression implements corresponding Visitor interface method
+func (v *analyzer) VisitSubExpression(node *ast.SubExpression) interface{} {
+	return node.Expression.Accept(v)
+}
+
+// VisitPath implements corresponding Visitor interface method
+func (v *analyzer) VisitPath(node *ast.PathExpression) interface{} {
+	v.addPath(node)
+	return nil
+}
+
+// Literals
+
+// VisitString implements corresponding Visitor interface method
+func (v *analyzer) VisitString(node *ast.StringLiteral) interface{} {
+	return nil
+}
+
+// VisitBoolean implements corresponding Visitor interface method
+func (v *analyzer) VisitBoolean(node *ast.BooleanLiteral) interface{} {
+	return nil
+}
+
+// VisitNumber implements corresponding Visitor interface method
+func (v *analyzer) VisitNumber(node *ast.NumberLiteral) interface{} {
+	return nil
+}
+
+// VisitUndefined implements corresponding Visitor interface method
+func (v *analyzer) VisitUndefined(node *ast.UndefinedLiteral) interface{} {
+	return nil
+}
+
+// VisitNull implements corresponding Visitor interface method
+func (v *analyzer) VisitNull(node *ast.NullLiteral) interface{} {
+	return nil
+}
+
+// Miscellaneous
+
+// VisitHash implements corresponding Visitor interface method
+func (v *analyzer) VisitHash(node *ast.Hash) interface{} {
+	for _, pair := range node.Pairs {
+		pair.Accept(v)
+	}
+	return nil
+}
+
+// VisitHashPair implements corresponding Visitor interface method
+func (v *analyzer) VisitHashPair(node *ast.HashPair) interface{} {
+	return node.Val.Accept(v)
+}
@@ -0,0 +1,41 @@
+package mario_test
+
+import (
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Analyze(t *testing.T) {
+	source := `{{title}} {{#each comments as |comment i|}}{{comment.body}} {{i}} {{../title}} {{@index}}{{/each}}` +
+		`{{#with author}}{{firstName}} {{format @root.date layout=dateLayout}}{{/with}}` +
+		`{{> header}}{{> (whichFooter kind)}}`
+
+	tpl := mario.Must(mario.New().Parse(source))
+
+	analysis := tpl.Analyze()
+
+	var paths []string
+	for _, ref := range analysis.Paths {
+		paths = append(paths, ref.String())
+	}
+
+	require.Equal(t, []string{"../title", "@index", "@root.date", "author", "comments", "dateLayout", "firstName", "kind", "title"}, paths)
+	require.Equal(t, []string{"each", "format", "whichFooter", "with"}, analysis.Helpers)
+	require.Equal(t, []string{"header"}, analysis.Partials)
+	require.Equal(t, []string{"(whichFooter)"}, analysis.DynamicPartials)
+	require.Equal(t, []string{"comment", "i"}, analysis.BlockParams)
+}
+
+func TestTemplate_Analyze_Section(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse(`{{#person}}{{name}}{{/person}}{{upper name}}`))
+	tpl.WithHelperFunc("upper", func(s string) string { return s })
+
+	analysis := tpl.Analyze()
+
+	require.Len(t, analysis.Paths, 2)
+	require.Equal(t, "name", analysis.Paths[0].String())
+	require.Equal(t, "person", analysis.Paths[1].String())
+	require.Equal(t, []string{"upper"}, analysis.Helpers)
+}
@@ -0,0 +1,55 @@
+package ast
+
+import "io"
+
+// BaseVisitor implements all Visitor interface methods as no-ops, and does not visit children nodes. Embed it in a
+// visitor to only implement the methods it needs.
+type BaseVisitor struct{}
+
+// VisitProgram implements corresponding Visitor interface method
+func (v BaseVisitor) VisitProgram(w io.Writer, node *Program) error { return nil }
+
+// VisitMustache implements corresponding Visitor interface method
+func (v BaseVisitor) VisitMustache(node *MustacheStatement) interface{} { return nil }
+
+// VisitBlock implements corresponding Visitor interface method
+func (v BaseVisitor) VisitBlock(node *BlockStatement) interface{} { return nil }
+
+// VisitPartial implements corresponding Visitor interface method
+func (v BaseVisitor) VisitPartial(node *PartialStatement) interface{} { return nil }
+
+// VisitContent implements corresponding Visitor interface method
+func (v BaseVisitor) VisitContent(node *ContentStatement) interface{} { return nil }
+
+// VisitComment implements corresponding Visitor interface method
+func (v BaseVisitor) VisitComment(node *CommentStatement) interface{} { return nil }
+
+// VisitExpression implements corresponding Visitor interface method
+func (v BaseVisitor) VisitExpression(node *Expression) interface{} { return nil }
+
+// VisitSubExpression implements corresponding Visitor interface method
+func (v BaseVisitor) VisitSubExpression(node *SubExpression) interface{} { return nil }
+
+// VisitPath implements corresponding Visitor interface method
+func (v BaseVisitor) VisitPath(node *PathExpression) interface{} { return nil }
+
+// VisitString implements corresponding Visitor interface method
+func (v BaseVisitor) VisitString(node *StringLiteral) interface{} { return nil }
+
+// VisitBoolean implements corresponding Visitor interface method
+func (v BaseVisitor) VisitBoolean(node *BooleanLiteral) interface{} { return nil }
+
+// VisitNumber implements corresponding Visitor interface method
+func (v BaseVisitor) VisitNumber(node *NumberLiteral) interface{} { return nil }
+
+// VisitUndefined implements corresponding Visitor interface method
+func (v BaseVisitor) VisitUndefined(node *UndefinedLiteral) interface{} { return nil }
+
+// VisitNull implements corresponding Visitor interface method
+func (v BaseVisitor) VisitNull(node *NullLiteral) interface{} { return nil }
+
+// VisitHash implements corresponding Visitor interface method
+func (v BaseVisitor) VisitHash(node *Hash) interface{} { return nil }
+
+// VisitHashPair implements corresponding Visitor interface method
+func (v BaseVisitor) VisitHashPair(node *HashPair) interface{} { return nil }
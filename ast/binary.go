@@ -0,0 +1,514 @@
+package ast
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Binary encoding of nodes
+//
+// Each node is encoded as its type tag (NodeType + 1, 0 being a nil node), its location, then its fields in
+// declaration order. Integers are varints, strings and slices are prefixed by their length, and strips are encoded
+// as a bit set. The encoding is not versioned: callers that persist it must version it themselves, and that version
+// must change with this file.
+
+// strip bits
+const (
+	stripPresent byte = 1 << iota
+	stripOpen
+	stripClose
+	stripOpenStandalone
+	stripCloseStandalone
+	stripInlineStandalone
+)
+
+var errBinaryTruncated = errors.New("Truncated binary AST")
+
+// MarshalBinaryNode returns the binary encoding of given node and all its children.
+func MarshalBinaryNode(node Node) []byte {
+	var e binaryEncoder
+	e.node(node)
+	return e.buf
+}
+
+// UnmarshalBinaryNode decodes a node encoded by MarshalBinaryNode.
+func UnmarshalBinaryNode(data []byte) (result Node, err error) {
+	d := binaryDecoder{buf: data}
+
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			result, err = nil, e
+		}
+	}()
+
+	result = d.node()
+	if len(d.buf) > 0 {
+		return nil, fmt.Errorf("Unexpected %d trailing bytes in binary AST", len(d.buf))
+	}
+
+	return result, nil
+}
+
+//
+// Encoder
+//
+
+type binaryEncoder struct {
+	buf []byte
+}
+
+func (e *binaryEncoder) uint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *binaryEncoder) int(v int) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(b[:], int64(v))
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *binaryEncoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *binaryEncoder) float(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	e.buf = append(e.buf, b[:]...)
+}
+
+func (e *binaryEncoder) str(v string) {
+	e.uint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *binaryEncoder) strs(v []string) {
+	e.uint(uint64(len(v)))
+	for _, s := range v {
+		e.str(s)
+	}
+}
+
+func (e *binaryEncoder) strip(s *Strip) {
+	if s == nil {
+		e.buf = append(e.buf, 0)
+		return
+	}
+
+	b := stripPresent
+	for _, f := range []struct {
+		set bool
+		bit byte
+	}{
+		{s.Open, stripOpen},
+		{s.Close, stripClose},
+		{s.OpenStandalone, stripOpenStandalone},
+		{s.CloseStandalone, stripCloseStandalone},
+		{s.InlineStandalone, stripInlineStandalone},
+	} {
+		if f.set {
+			b |= f.bit
+		}
+	}
+
+	e.buf = append(e.buf, b)
+}
+
+func (e *binaryEncoder) nodes(nodes []Node) {
+	e.uint(uint64(len(nodes)))
+	for _, n := range nodes {
+		e.node(n)
+	}
+}
+
+func (e *binaryEncoder) node(node Node) {
+	if isNil(node) {
+		e.uint(0)
+		return
+	}
+
+	e.uint(uint64(node.Type()) + 1)
+
+	loc := node.Location()
+	e.uint(uint64(loc.Pos))
+	e.uint(uint64(loc.Line))
+	e.uint(uint64(loc.Column))
+	e.uint(uint64(loc.EndPos))
+	e.uint(uint64(loc.EndLine))
+	e.uint(uint64(loc.EndColumn))
+
+	switch n := node.(type) {
+	case *Program:
+		e.nodes(n.Body)
+		e.strs(n.BlockParams)
+		e.bool(n.Chained)
+		e.strip(n.Strip)
+
+	case *MustacheStatement:
+		e.bool(n.Unescaped)
+		e.node(exprNode(n.Expression))
+		e.strip(n.Strip)
+
+	case *BlockStatement:
+		e.node(exprNode(n.Expression))
+		e.node(programNode(n.Program))
+		e.node(programNode(n.Inverse))
+		e.strip(n.OpenStrip)
+		e.strip(n.InverseStrip)
+		e.strip(n.CloseStrip)
+		e.bool(n.Raw)
+		e.str(n.RawContent)
+		e.str(n.Delims[0])
+		e.str(n.Delims[1])
+		e.uint(uint64(n.Inheritance))
+
+	case *PartialStatement:
+		e.node(n.Name)
+		e.nodes(n.Params)
+		e.node(hashNode(n.Hash))
+		e.strip(n.Strip)
+		e.str(n.Indent)
+
+	case *ContentStatement:
+		e.str(n.Value)
+		e.str(n.Original)
+		e.bool(n.RightStripped)
+		e.bool(n.LeftStripped)
+
+	case *CommentStatement:
+		e.str(n.Value)
+		e.strip(n.Strip)
+
+	case *Expression:
+		e.node(n.Path)
+		e.nodes(n.Params)
+		e.node(hashNode(n.Hash))
+
+	case *SubExpression:
+		e.node(exprNode(n.Expression))
+
+	case *PathExpression:
+		e.str(n.Original)
+		e.int(n.Depth)
+		e.strs(n.Parts)
+		e.bool(n.Data)
+		e.bool(n.Scoped)
+
+	case *BooleanLiteral:
+		e.bool(n.Value)
+		e.str(n.Original)
+
+	case *NumberLiteral:
+		e.float(n.Value)
+		e.bool(n.IsInt)
+		e.str(n.Original)
+
+	case *StringLiteral:
+		e.str(n.Value)
+
+	case *UndefinedLiteral, *NullLiteral:
+		// no value
+
+	case *Hash:
+		e.uint(uint64(len(n.Pairs)))
+		for _, p := range n.Pairs {
+			e.node(hashPairNode(p))
+		}
+
+	case *HashPair:
+		e.str(n.Key)
+		e.node(n.Val)
+
+	default:
+		panic(fmt.Errorf("Unsupported AST node: %s", node))
+	}
+}
+
+//
+// Decoder
+//
+// Decoding errors are raised as panics, and recovered by UnmarshalBinaryNode.
+//
+
+type binaryDecoder struct {
+	buf []byte
+}
+
+func (d *binaryDecoder) uint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		panic(errBinaryTruncated)
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) int() int {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		panic(errBinaryTruncated)
+	}
+	d.buf = d.buf[n:]
+	return int(v)
+}
+
+// len decodes a length, that can't be greater than remaining bytes count
+func (d *binaryDecoder) len() int {
+	v := d.uint()
+	if v > uint64(len(d.buf)) {
+		panic(errBinaryTruncated)
+	}
+	return int(v)
+}
+
+func (d *binaryDecoder) bytes(n int) []byte {
+	if n > len(d.buf) {
+		panic(errBinaryTruncated)
+	}
+	result := d.buf[:n]
+	d.buf = d.buf[n:]
+	return result
+}
+
+func (d *binaryDecoder) bool() bool {
+	return d.bytes(1)[0] != 0
+}
+
+func (d *binaryDecoder) float() float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(d.bytes(8)))
+}
+
+func (d *binaryDecoder) str() string {
+	return string(d.bytes(d.len()))
+}
+
+func (d *binaryDecoder) strs() []string {
+	n := d.len()
+	if n == 0 {
+		return nil
+	}
+
+	result := make([]string, n)
+	for i := range result {
+		result[i] = d.str()
+	}
+	return result
+}
+
+func (d *binaryDecoder) strip() *Strip {
+	b := d.bytes(1)[0]
+	if b&stripPresent == 0 {
+		return nil
+	}
+
+	return &Strip{
+		Open:             b&stripOpen != 0,
+		Close:            b&stripClose != 0,
+		OpenStandalone:   b&stripOpenStandalone != 0,
+		CloseStandalone:  b&stripCloseStandalone != 0,
+		InlineStandalone: b&stripInlineStandalone != 0,
+	}
+}
+
+func (d *binaryDecoder) nodes() []Node {
+	n := d.len()
+	if n == 0 {
+		return nil
+	}
+
+	result := make([]Node, n)
+	for i := range result {
+		result[i] = d.node()
+	}
+	return result
+}
+
+func (d *binaryDecoder) expression() *Expression {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+
+	result, ok := node.(*Expression)
+	if !ok {
+		panic(fmt.Errorf("Unexpected binary AST node %s, expected an expression", node))
+	}
+	return result
+}
+
+func (d *binaryDecoder) program() *Program {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+
+	result, ok := node.(*Program)
+	if !ok {
+		panic(fmt.Errorf("Unexpected binary AST node %s, expected a program", node))
+	}
+	return result
+}
+
+func (d *binaryDecoder) hash() *Hash {
+	node := d.node()
+	if node == nil {
+		return nil
+	}
+
+	result, ok := node.(*Hash)
+	if !ok {
+		panic(fmt.Errorf("Unexpected binary AST node %s, expected a hash", node))
+	}
+	return result
+}
+
+func (d *binaryDecoder) hashPair() *HashPair {
+	node := d.node()
+
+	result, ok := node.(*HashPair)
+	if !ok {
+		panic(fmt.Errorf("Unexpected binary AST node %s, expected a hash pair", node))
+	}
+	return result
+}
+
+func (d *binaryDecoder) node() Node {
+	tag := d.uint()
+	if tag == 0 {
+		return nil
+	}
+
+	loc := Loc{Pos: int(d.uint()), Line: int(d.uint()), Column: int(d.uint())}
+	loc.EndPos = int(d.uint())
+	loc.EndLine = int(d.uint())
+	loc.EndColumn = int(d.uint())
+
+	result := d.nodeData(NodeType(tag-1), loc.Pos, loc.Line)
+	result.(locationSetter).setLocation(loc)
+
+	return result
+}
+
+// nodeData decodes the fields of a node of given type
+func (d *binaryDecoder) nodeData(typ NodeType, pos int, line int) Node {
+	switch typ {
+	case NodeProgram:
+		n := NewProgram(pos, line)
+		n.Body = d.nodes()
+		n.BlockParams = d.strs()
+		n.Chained = d.bool()
+		n.Strip = d.strip()
+		return n
+
+	case NodeMustache:
+		n := NewMustacheStatement(pos, line, d.bool())
+		n.Expression = d.expression()
+		n.Strip = d.strip()
+		return n
+
+	case NodeBlock:
+		n := NewBlockStatement(pos, line)
+		n.Expression = d.expression()
+		n.Program = d.program()
+		n.Inverse = d.program()
+		n.OpenStrip = d.strip()
+		n.InverseStrip = d.strip()
+		n.CloseStrip = d.strip()
+		n.Raw = d.bool()
+		n.RawContent = d.str()
+		n.Delims[0] = d.str()
+		n.Delims[1] = d.str()
+		n.Inheritance = Inheritance(d.uint())
+		return n
+
+	case NodePartial:
+		n := NewPartialStatement(pos, line)
+		n.Name = d.node()
+		n.Params = d.nodes()
+		n.Hash = d.hash()
+		n.Strip = d.strip()
+		n.Indent = d.str()
+		return n
+
+	case NodeContent:
+		n := NewContentStatement(pos, line, d.str())
+		n.Original = d.str()
+		n.RightStripped = d.bool()
+		n.LeftStripped = d.bool()
+		return n
+
+	case NodeComment:
+		n := NewCommentStatement(pos, line, d.str())
+		n.Strip = d.strip()
+		return n
+
+	case NodeExpression:
+		n := NewExpression(pos, line)
+		n.Path = d.node()
+		n.Params = d.nodes()
+		n.Hash = d.hash()
+		return n
+
+	case NodeSubExpression:
+		n := NewSubExpression(pos, line)
+		n.Expression = d.expression()
+		return n
+
+	case NodePath:
+		n := NewPathExpression(pos, line, false)
+		n.Original = d.str()
+		n.Depth = d.int()
+		n.Parts = d.strs()
+		n.Data = d.bool()
+		n.Scoped = d.bool()
+		return n
+
+	case NodeBoolean:
+		val := d.bool()
+		return NewBooleanLiteral(pos, line, val, d.str())
+
+	case NodeNumber:
+		val := d.float()
+		isInt := d.bool()
+		return NewNumberLiteral(pos, line, val, isInt, d.str())
+
+	case NodeString:
+		return NewStringLiteral(pos, line, d.str())
+
+	case NodeUndefined:
+		return NewUndefinedLiteral(pos, line)
+
+	case NodeNull:
+		return NewNullLiteral(pos, line)
+
+	case NodeHash:
+		n := NewHash(pos, line)
+		if count := d.len(); count > 0 {
+			n.Pairs = make([]*HashPair, count)
+			for i := range n.Pairs {
+				n.Pairs[i] = d.hashPair()
+			}
+		}
+		return n
+
+	case NodeHashPair:
+		n := NewHashPair(pos, line)
+		n.Key = d.str()
+		n.Val = d.node()
+		return n
+	}
+
+	panic(fmt.Errorf("Unknown binary AST node tag: %d", typ+1))
+}
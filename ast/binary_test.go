@@ -0,0 +1,43 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/imantung/mario/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinary_RoundTrip(t *testing.T) {
+	sources := []string{
+		`Hello {{name}}!`,
+		`{{{raw}}} {{&amp}} {{! comment }}`,
+		`{{#each items as |item i|}}{{item.name}} {{../title}} {{@index}}{{else}}none{{/each}}`,
+		`{{#if a}}a{{else if b}}b{{else}}c{{/if}}`,
+		`{{format date "short" 12 -1.5 true (upper name) key=value other=(lower x)}}`,
+		"{{> header title=\"Hi\"}}{{> (whichPartial) ctx}}\n  {{> indented}}\n",
+		"  {{#foo}}\n    bar\n  {{~/foo}}\n",
+		`{{{{raw}}}} {{not parsed}} {{{{/raw}}}}`,
+		`{{foo null undefined key=null other=undefined}} {{null.bar}}`,
+	}
+
+	for _, source := range sources {
+		program := mustParse(t, source)
+
+		node, err := ast.UnmarshalBinaryNode(ast.MarshalBinaryNode(program))
+		require.NoError(t, err, source)
+		require.Equal(t, program, node, source)
+	}
+}
+
+func TestBinary_Invalid(t *testing.T) {
+	data := ast.MarshalBinaryNode(mustParse(t, `{{foo bar=baz}}`))
+
+	_, err := ast.UnmarshalBinaryNode(data[:len(data)-3])
+	require.EqualError(t, err, "Truncated binary AST")
+
+	_, err = ast.UnmarshalBinaryNode(append(data, 0))
+	require.EqualError(t, err, "Unexpected 1 trailing bytes in binary AST")
+
+	_, err = ast.UnmarshalBinaryNode([]byte{42, 0, 0, 0, 0, 0, 0})
+	require.EqualError(t, err, "Unknown binary AST node tag: 42")
+}
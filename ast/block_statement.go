@@ -16,13 +16,39 @@ type BlockStatement struct {
 	OpenStrip    *Strip
 	InverseStrip *Strip
 	CloseStrip   *Strip
+
+	// raw block: {{{{helper}}}}content{{{{/helper}}}}
+	Raw bool
+
+	// unparsed block content, for raw blocks and in Mustache mode
+	RawContent string
+
+	// Mustache mode only: delimiters in use at block start
+	Delims [2]string
+
+	// Mustache mode only: inheritance tag
+	Inheritance Inheritance
 }
 
+// Inheritance represents a Mustache inheritance tag kind.
+type Inheritance int
+
+const (
+	// NoInheritance is a regular block
+	NoInheritance Inheritance = iota
+
+	// InheritanceBlock is a block that can be overridden: {{$name}}default content{{/name}}
+	InheritanceBlock
+
+	// InheritanceParent is a partial with overridden blocks: {{<name}}{{$block}}content{{/block}}{{/name}}
+	InheritanceParent
+)
+
 // NewBlockStatement instanciates a new block node.
 func NewBlockStatement(pos int, line int) *BlockStatement {
 	return &BlockStatement{
 		NodeType: NodeBlock,
-		Loc:      Loc{pos, line},
+		Loc:      Loc{Pos: pos, Line: line},
 	}
 }
 
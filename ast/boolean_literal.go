@@ -15,7 +15,7 @@ type BooleanLiteral struct {
 func NewBooleanLiteral(pos int, line int, val bool, original string) *BooleanLiteral {
 	return &BooleanLiteral{
 		NodeType: NodeBoolean,
-		Loc:      Loc{pos, line},
+		Loc:      Loc{Pos: pos, Line: line},
 
 		Value:    val,
 		Original: original,
@@ -17,7 +17,7 @@ type CommentStatement struct {
 func NewCommentStatement(pos int, line int, val string) *CommentStatement {
 	return &CommentStatement{
 		NodeType: NodeComment,
-		Loc:      Loc{pos, line},
+		Loc:      Loc{Pos: pos, Line: line},
 
 		Value: val,
 	}
@@ -19,7 +19,7 @@ type ContentStatement struct {
 func NewContentStatement(pos int, line int, val string) *ContentStatement {
 	return &ContentStatement{
 		NodeType: NodeContent,
-		Loc:      Loc{pos, line},
+		Loc:      Loc{Pos: pos, Line: line},
 
 		Value:    val,
 		Original: val,
@@ -7,16 +7,19 @@ type Expression struct {
 	NodeType
 	Loc
 
-	Path   Node   // PathExpression | StringLiteral | BooleanLiteral | NumberLiteral
+	Path   Node   // PathExpression | StringLiteral | BooleanLiteral | NumberLiteral | UndefinedLiteral | NullLiteral
 	Params []Node // [ Expression ... ]
 	Hash   *Hash
+
+	// index of expression in its program, starting at 1, set when a template resolves its helper calls
+	Index int
 }
 
 // NewExpression instanciates a new expression node.
 func NewExpression(pos int, line int) *Expression {
 	return &Expression{
 		NodeType: NodeExpression,
-		Loc:      Loc{pos, line},
+		Loc:      Loc{Pos: pos, Line: line},
 	}
 }
 
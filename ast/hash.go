@@ -14,7 +14,7 @@ type Hash struct {
 func NewHash(pos int, line int) *Hash {
 	return &Hash{
 		NodeType: NodeHash,
-		Loc:      Loc{pos, line},
+		Loc:      Loc{Pos: pos, Line: line},
 	}
 }
 
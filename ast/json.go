@@ -0,0 +1,893 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// References:
+//   - https://github.com/wycats/handlebars.js/blob/master/docs/compiler-api.md
+//
+// Nodes are marshalled to the JSON shape of handlebars.js compiler AST, as returned by Handlebars.parse(), with
+// these differences:
+//   - node locations have the extra `pos` and `endPos` fields, that are byte positions in source, and their `source`
+//     is always null
+//   - string literal locations start after the opening quote
+//   - an Expression node shares the location of the statement or subexpression it is flattened in
+//   - mustache, block and subexpression expressions are flattened in `path`, `params` and `hash` fields, like
+//     handlebars.js does, but a standalone Expression node is marshalled with the `Expression` type
+//   - Mustache mode block fields are exported as `rawContent`, `delims` and `inheritance` fields
+//   - raw blocks are exported with `raw` and `rawContent` fields
+//
+// Decorators and partial blocks are not supported.
+
+var nodeTypeNames = map[NodeType]string{
+	NodeProgram:       "Program",
+	NodeMustache:      "MustacheStatement",
+	NodeBlock:         "BlockStatement",
+	NodePartial:       "PartialStatement",
+	NodeContent:       "ContentStatement",
+	NodeComment:       "CommentStatement",
+	NodeExpression:    "Expression",
+	NodeSubExpression: "SubExpression",
+	NodePath:          "PathExpression",
+	NodeBoolean:       "BooleanLiteral",
+	NodeNumber:        "NumberLiteral",
+	NodeString:        "StringLiteral",
+	NodeHash:          "Hash",
+	NodeHashPair:      "HashPair",
+	NodeUndefined:     "UndefinedLiteral",
+	NodeNull:          "NullLiteral",
+}
+
+// UnmarshalNode parses given handlebars.js JSON AST node, and returns the corresponding node.
+func UnmarshalNode(data []byte) (Node, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil, nil
+	}
+
+	var header struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	var result Node
+
+	switch header.Type {
+	case "Program":
+		result = &Program{}
+	case "MustacheStatement":
+		result = &MustacheStatement{}
+	case "BlockStatement":
+		result = &BlockStatement{}
+	case "PartialStatement":
+		result = &PartialStatement{}
+	case "ContentStatement":
+		result = &ContentStatement{}
+	case "CommentStatement":
+		result = &CommentStatement{}
+	case "Expression":
+		result = &Expression{}
+	case "SubExpression":
+		result = &SubExpression{}
+	case "PathExpression":
+		result = &PathExpression{}
+	case "BooleanLiteral":
+		result = &BooleanLiteral{}
+	case "NumberLiteral":
+		result = &NumberLiteral{}
+	case "StringLiteral":
+		result = &StringLiteral{}
+	case "UndefinedLiteral":
+		result = &UndefinedLiteral{}
+	case "NullLiteral":
+		result = &NullLiteral{}
+	case "Hash":
+		result = &Hash{}
+	case "HashPair":
+		result = &HashPair{}
+	default:
+		return nil, fmt.Errorf("Unsupported AST node type: %q", header.Type)
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// unmarshalNodes parses given handlebars.js JSON AST nodes
+func unmarshalNodes(raws []json.RawMessage) ([]Node, error) {
+	var result []Node
+
+	for _, raw := range raws {
+		node, err := UnmarshalNode(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, node)
+	}
+
+	return result, nil
+}
+
+// checkNodeType returns an error if given JSON node type does not match expected node type
+func checkNodeType(name string, expected NodeType) error {
+	if name != nodeTypeNames[expected] {
+		return fmt.Errorf("Unexpected AST node type %q, expected %q", name, nodeTypeNames[expected])
+	}
+	return nil
+}
+
+//
+// Location
+//
+
+type jsonPosition struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type jsonLoc struct {
+	Source *string      `json:"source"`
+	Start  jsonPosition `json:"start"`
+	End    jsonPosition `json:"end"`
+	Pos    int          `json:"pos"`
+	EndPos int          `json:"endPos"`
+}
+
+func newJSONLoc(l Loc) *jsonLoc {
+	return &jsonLoc{
+		Start:  jsonPosition{Line: l.Line, Column: l.Column},
+		End:    jsonPosition{Line: l.EndLine, Column: l.EndColumn},
+		Pos:    l.Pos,
+		EndPos: l.EndPos,
+	}
+}
+
+func (l *jsonLoc) loc() Loc {
+	if l == nil {
+		return Loc{}
+	}
+
+	return Loc{
+		Pos:       l.Pos,
+		Line:      l.Start.Line,
+		Column:    l.Start.Column,
+		EndPos:    l.EndPos,
+		EndLine:   l.End.Line,
+		EndColumn: l.End.Column,
+	}
+}
+
+//
+// Expressions
+//
+
+// jsonExpression is the flattened form of an expression
+type jsonExpression struct {
+	Path   Node   `json:"path"`
+	Params []Node `json:"params"`
+	Hash   *Hash  `json:"hash,omitempty"`
+}
+
+func newJSONExpression(node *Expression) jsonExpression {
+	result := jsonExpression{Params: []Node{}}
+
+	if node != nil {
+		result.Path = node.Path
+		result.Hash = node.Hash
+
+		if len(node.Params) > 0 {
+			result.Params = node.Params
+		}
+	}
+
+	return result
+}
+
+// rawJSONExpression is the flattened form of an expression, before unmarshalling its nodes
+type rawJSONExpression struct {
+	Path   json.RawMessage   `json:"path"`
+	Params []json.RawMessage `json:"params"`
+	Hash   *Hash             `json:"hash"`
+}
+
+func (e *rawJSONExpression) expression(loc Loc) (*Expression, error) {
+	result := NewExpression(loc.Pos, loc.Line)
+	result.Loc = loc
+
+	var err error
+
+	if result.Path, err = UnmarshalNode(e.Path); err != nil {
+		return nil, err
+	}
+
+	if result.Params, err = unmarshalNodes(e.Params); err != nil {
+		return nil, err
+	}
+
+	result.Hash = e.Hash
+
+	return result, nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *Expression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		jsonExpression
+		Loc *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeExpression], newJSONExpression(node), newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *Expression) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type string `json:"type"`
+		rawJSONExpression
+		Loc *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeExpression); err != nil {
+		return err
+	}
+
+	expr, err := v.expression(v.Loc.loc())
+	if err != nil {
+		return err
+	}
+
+	*node = *expr
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *SubExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		jsonExpression
+		Loc *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeSubExpression], newJSONExpression(node.Expression), newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *SubExpression) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type string `json:"type"`
+		rawJSONExpression
+		Loc *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeSubExpression); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	expr, err := v.expression(loc)
+	if err != nil {
+		return err
+	}
+
+	*node = *NewSubExpression(loc.Pos, loc.Line)
+	node.Loc = loc
+	node.Expression = expr
+	return nil
+}
+
+// scopedPathRegexp matches a scoped path original string, as in handlebars.js AST helpers
+var scopedPathRegexp = regexp.MustCompile(`^@?(\.|this\b)`)
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *PathExpression) MarshalJSON() ([]byte, error) {
+	parts := node.Parts
+	if parts == nil {
+		parts = []string{}
+	}
+
+	return json.Marshal(struct {
+		Type     string   `json:"type"`
+		Data     bool     `json:"data"`
+		Depth    int      `json:"depth"`
+		Parts    []string `json:"parts"`
+		Original string   `json:"original"`
+		Loc      *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodePath], node.Data, node.Depth, parts, node.Original, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *PathExpression) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type     string   `json:"type"`
+		Data     bool     `json:"data"`
+		Depth    int      `json:"depth"`
+		Parts    []string `json:"parts"`
+		Original string   `json:"original"`
+		Loc      *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodePath); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewPathExpression(loc.Pos, loc.Line, v.Data)
+	node.Loc = loc
+	node.Original = v.Original
+	node.Depth = v.Depth
+	node.Parts = v.Parts
+	node.Scoped = (v.Depth > 0) || scopedPathRegexp.MatchString(v.Original)
+	return nil
+}
+
+//
+// Literals
+//
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *StringLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string   `json:"type"`
+		Value    string   `json:"value"`
+		Original string   `json:"original"`
+		Loc      *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeString], node.Value, node.Value, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *StringLiteral) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type  string   `json:"type"`
+		Value string   `json:"value"`
+		Loc   *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeString); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewStringLiteral(loc.Pos, loc.Line, v.Value)
+	node.Loc = loc
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *BooleanLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string   `json:"type"`
+		Value    bool     `json:"value"`
+		Original bool     `json:"original"`
+		Loc      *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeBoolean], node.Value, node.Value, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *BooleanLiteral) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type  string   `json:"type"`
+		Value bool     `json:"value"`
+		Loc   *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeBoolean); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewBooleanLiteral(loc.Pos, loc.Line, v.Value, "")
+	node.Loc = loc
+	node.Original = node.Canonical()
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *NumberLiteral) MarshalJSON() ([]byte, error) {
+	// original number is kept as is
+	original := json.RawMessage(node.Original)
+	if !json.Valid(original) {
+		original = json.RawMessage(node.Canonical())
+	}
+
+	return json.Marshal(struct {
+		Type     string          `json:"type"`
+		Value    float64         `json:"value"`
+		Original json.RawMessage `json:"original"`
+		Loc      *jsonLoc        `json:"loc"`
+	}{nodeTypeNames[NodeNumber], node.Value, original, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *NumberLiteral) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type     string      `json:"type"`
+		Value    float64     `json:"value"`
+		Original json.Number `json:"original"`
+		Loc      *jsonLoc    `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeNumber); err != nil {
+		return err
+	}
+
+	original := v.Original.String()
+	if original == "" {
+		original = strconv.FormatFloat(v.Value, 'f', -1, 64)
+	}
+
+	_, err := strconv.Atoi(original)
+	isInt := (err == nil)
+
+	loc := v.Loc.loc()
+
+	*node = *NewNumberLiteral(loc.Pos, loc.Line, v.Value, isInt, original)
+	node.Loc = loc
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *UndefinedLiteral) MarshalJSON() ([]byte, error) {
+	// undefined value and original are omitted, like JSON.stringify() does
+	return json.Marshal(struct {
+		Type string   `json:"type"`
+		Loc  *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeUndefined], newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *UndefinedLiteral) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type string   `json:"type"`
+		Loc  *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeUndefined); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewUndefinedLiteral(loc.Pos, loc.Line)
+	node.Loc = loc
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *NullLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string      `json:"type"`
+		Value    interface{} `json:"value"`
+		Original interface{} `json:"original"`
+		Loc      *jsonLoc    `json:"loc"`
+	}{nodeTypeNames[NodeNull], nil, nil, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *NullLiteral) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type string   `json:"type"`
+		Loc  *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeNull); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewNullLiteral(loc.Pos, loc.Line)
+	node.Loc = loc
+	return nil
+}
+
+//
+// Miscellaneous
+//
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *Hash) MarshalJSON() ([]byte, error) {
+	pairs := node.Pairs
+	if pairs == nil {
+		pairs = []*HashPair{}
+	}
+
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Pairs []*HashPair `json:"pairs"`
+		Loc   *jsonLoc    `json:"loc"`
+	}{nodeTypeNames[NodeHash], pairs, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *Hash) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type  string      `json:"type"`
+		Pairs []*HashPair `json:"pairs"`
+		Loc   *jsonLoc    `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeHash); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewHash(loc.Pos, loc.Line)
+	node.Loc = loc
+	node.Pairs = v.Pairs
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *HashPair) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string   `json:"type"`
+		Key   string   `json:"key"`
+		Value Node     `json:"value"`
+		Loc   *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeHashPair], node.Key, node.Val, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *HashPair) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type  string          `json:"type"`
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+		Loc   *jsonLoc        `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeHashPair); err != nil {
+		return err
+	}
+
+	val, err := UnmarshalNode(v.Value)
+	if err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewHashPair(loc.Pos, loc.Line)
+	node.Loc = loc
+	node.Key = v.Key
+	node.Val = val
+	return nil
+}
+
+//
+// Statements
+//
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *Program) MarshalJSON() ([]byte, error) {
+	body := node.Body
+	if body == nil {
+		body = []Node{}
+	}
+
+	return json.Marshal(struct {
+		Type        string   `json:"type"`
+		Body        []Node   `json:"body"`
+		BlockParams []string `json:"blockParams,omitempty"`
+		Chained     bool     `json:"chained,omitempty"`
+		Strip       *Strip   `json:"strip,omitempty"`
+		Loc         *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeProgram], body, node.BlockParams, node.Chained, node.Strip, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *Program) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type        string            `json:"type"`
+		Body        []json.RawMessage `json:"body"`
+		BlockParams []string          `json:"blockParams"`
+		Chained     bool              `json:"chained"`
+		Strip       *Strip            `json:"strip"`
+		Loc         *jsonLoc          `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeProgram); err != nil {
+		return err
+	}
+
+	body, err := unmarshalNodes(v.Body)
+	if err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewProgram(loc.Pos, loc.Line)
+	node.Loc = loc
+	node.Body = body
+	node.BlockParams = v.BlockParams
+	node.Chained = v.Chained
+	node.Strip = v.Strip
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *MustacheStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		jsonExpression
+		Escaped bool     `json:"escaped"`
+		Strip   *Strip   `json:"strip,omitempty"`
+		Loc     *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeMustache], newJSONExpression(node.Expression), !node.Unescaped, node.Strip, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *MustacheStatement) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type string `json:"type"`
+		rawJSONExpression
+		Escaped *bool    `json:"escaped"`
+		Strip   *Strip   `json:"strip"`
+		Loc     *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeMustache); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	expr, err := v.expression(loc)
+	if err != nil {
+		return err
+	}
+
+	unescaped := (v.Escaped != nil) && !*v.Escaped
+
+	*node = *NewMustacheStatement(loc.Pos, loc.Line, unescaped)
+	node.Loc = loc
+	node.Expression = expr
+	node.Strip = v.Strip
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *BlockStatement) MarshalJSON() ([]byte, error) {
+	var delims []string
+	if node.Delims != [2]string{} {
+		delims = node.Delims[:]
+	}
+
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		jsonExpression
+		Program      *Program    `json:"program,omitempty"`
+		Inverse      *Program    `json:"inverse,omitempty"`
+		OpenStrip    *Strip      `json:"openStrip,omitempty"`
+		InverseStrip *Strip      `json:"inverseStrip,omitempty"`
+		CloseStrip   *Strip      `json:"closeStrip,omitempty"`
+		Raw          bool        `json:"raw,omitempty"`
+		RawContent   string      `json:"rawContent,omitempty"`
+		Delims       []string    `json:"delims,omitempty"`
+		Inheritance  Inheritance `json:"inheritance,omitempty"`
+		Loc          *jsonLoc    `json:"loc"`
+	}{
+		nodeTypeNames[NodeBlock], newJSONExpression(node.Expression),
+		node.Program, node.Inverse,
+		node.OpenStrip, node.InverseStrip, node.CloseStrip,
+		node.Raw, node.RawContent, delims, node.Inheritance,
+		newJSONLoc(node.Loc),
+	})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *BlockStatement) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type string `json:"type"`
+		rawJSONExpression
+		Program      *Program    `json:"program"`
+		Inverse      *Program    `json:"inverse"`
+		OpenStrip    *Strip      `json:"openStrip"`
+		InverseStrip *Strip      `json:"inverseStrip"`
+		CloseStrip   *Strip      `json:"closeStrip"`
+		Raw          bool        `json:"raw"`
+		RawContent   string      `json:"rawContent"`
+		Delims       []string    `json:"delims"`
+		Inheritance  Inheritance `json:"inheritance"`
+		Loc          *jsonLoc    `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeBlock); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	expr, err := v.expression(loc)
+	if err != nil {
+		return err
+	}
+
+	*node = *NewBlockStatement(loc.Pos, loc.Line)
+	node.Loc = loc
+	node.Expression = expr
+	node.Program = v.Program
+	node.Inverse = v.Inverse
+	node.OpenStrip = v.OpenStrip
+	node.InverseStrip = v.InverseStrip
+	node.CloseStrip = v.CloseStrip
+	node.Raw = v.Raw
+	node.RawContent = v.RawContent
+	node.Inheritance = v.Inheritance
+
+	if len(v.Delims) == 2 {
+		node.Delims = [2]string{v.Delims[0], v.Delims[1]}
+	}
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *PartialStatement) MarshalJSON() ([]byte, error) {
+	params := node.Params
+	if params == nil {
+		params = []Node{}
+	}
+
+	return json.Marshal(struct {
+		Type   string   `json:"type"`
+		Name   Node     `json:"name"`
+		Params []Node   `json:"params"`
+		Hash   *Hash    `json:"hash,omitempty"`
+		Indent string   `json:"indent"`
+		Strip  *Strip   `json:"strip,omitempty"`
+		Loc    *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodePartial], node.Name, params, node.Hash, node.Indent, node.Strip, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *PartialStatement) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type   string            `json:"type"`
+		Name   json.RawMessage   `json:"name"`
+		Params []json.RawMessage `json:"params"`
+		Hash   *Hash             `json:"hash"`
+		Indent string            `json:"indent"`
+		Strip  *Strip            `json:"strip"`
+		Loc    *jsonLoc          `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodePartial); err != nil {
+		return err
+	}
+
+	name, err := UnmarshalNode(v.Name)
+	if err != nil {
+		return err
+	}
+
+	params, err := unmarshalNodes(v.Params)
+	if err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewPartialStatement(loc.Pos, loc.Line)
+	node.Loc = loc
+	node.Name = name
+	node.Params = params
+	node.Hash = v.Hash
+	node.Indent = v.Indent
+	node.Strip = v.Strip
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *ContentStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type          string   `json:"type"`
+		Value         string   `json:"value"`
+		Original      string   `json:"original"`
+		RightStripped bool     `json:"rightStripped,omitempty"`
+		LeftStripped  bool     `json:"leftStripped,omitempty"`
+		Loc           *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeContent], node.Value, node.Original, node.RightStripped, node.LeftStripped, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *ContentStatement) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type          string   `json:"type"`
+		Value         string   `json:"value"`
+		Original      string   `json:"original"`
+		RightStripped bool     `json:"rightStripped"`
+		LeftStripped  bool     `json:"leftStripped"`
+		Loc           *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeContent); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewContentStatement(loc.Pos, loc.Line, v.Value)
+	node.Loc = loc
+	node.Original = v.Original
+	node.RightStripped = v.RightStripped
+	node.LeftStripped = v.LeftStripped
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (node *CommentStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string   `json:"type"`
+		Value string   `json:"value"`
+		Strip *Strip   `json:"strip,omitempty"`
+		Loc   *jsonLoc `json:"loc"`
+	}{nodeTypeNames[NodeComment], node.Value, node.Strip, newJSONLoc(node.Loc)})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (node *CommentStatement) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Type  string   `json:"type"`
+		Value string   `json:"value"`
+		Strip *Strip   `json:"strip"`
+		Loc   *jsonLoc `json:"loc"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkNodeType(v.Type, NodeComment); err != nil {
+		return err
+	}
+
+	loc := v.Loc.loc()
+
+	*node = *NewCommentStatement(loc.Pos, loc.Line, v.Value)
+	node.Loc = loc
+	node.Strip = v.Strip
+	return nil
+}
@@ -0,0 +1,161 @@
+package ast_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/imantung/mario/ast"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSON_RoundTrip(t *testing.T) {
+	sources := []string{
+		`Hello {{name}}!`,
+		`{{{raw}}} {{&amp}} {{! comment }}`,
+		`{{#each items as |item i|}}{{item.name}} {{../title}} {{@index}}{{else}}none{{/each}}`,
+		`{{#if a}}a{{else if b}}b{{else}}c{{/if}}`,
+		`{{format date "short" 12 -1.5 true (upper name) key=value other=(lower x)}}`,
+		`{{> header title="Hi"}}{{> (whichPartial) ctx}}`,
+		"  {{#foo}}\n    bar\n  {{~/foo}}\n",
+		`{{{{raw}}}} {{not parsed}} {{{{/raw}}}}`,
+		`{{foo null undefined key=null other=undefined}} {{null.bar}}`,
+	}
+
+	for _, source := range sources {
+		program := mustParse(t, source)
+
+		data, err := json.Marshal(program)
+		require.NoError(t, err, source)
+
+		node, err := ast.UnmarshalNode(data)
+		require.NoError(t, err, source)
+		require.IsType(t, &ast.Program{}, node, source)
+
+		require.Equal(t, ast.Print(program), ast.Print(node), source)
+		require.Equal(t, program, node, source)
+	}
+}
+
+func TestJSON_Shape(t *testing.T) {
+	program := mustParse(t, `{{foo bar=1}}`)
+
+	data, err := json.Marshal(program)
+	require.NoError(t, err)
+
+	require.JSONEq(t, `{
+		"type": "Program",
+		"body": [{
+			"type": "MustacheStatement",
+			"path": {"type": "PathExpression", "data": false, "depth": 0, "parts": ["foo"], "original": "foo", "loc": {"source": null, "start": {"line": 1, "column": 2}, "end": {"line": 1, "column": 5}, "pos": 2, "endPos": 5}},
+			"params": [],
+			"hash": {
+				"type": "Hash",
+				"pairs": [{
+					"type": "HashPair",
+					"key": "bar",
+					"value": {"type": "NumberLiteral", "value": 1, "original": 1, "loc": {"source": null, "start": {"line": 1, "column": 10}, "end": {"line": 1, "column": 11}, "pos": 10, "endPos": 11}},
+					"loc": {"source": null, "start": {"line": 1, "column": 6}, "end": {"line": 1, "column": 11}, "pos": 6, "endPos": 11}
+				}],
+				"loc": {"source": null, "start": {"line": 1, "column": 6}, "end": {"line": 1, "column": 11}, "pos": 6, "endPos": 11}
+			},
+			"escaped": true,
+			"strip": {"open": false, "close": false},
+			"loc": {"source": null, "start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 13}, "pos": 0, "endPos": 13}
+		}],
+		"loc": {"source": null, "start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 13}, "pos": 0, "endPos": 13}
+	}`, string(data))
+}
+
+// handlebars.js 4 output of: JSON.stringify(Handlebars.parse('{{#if ok}}{{{ name }}}{{/if}}'))
+const handlebarsJSAST = `{
+  "type": "Program",
+  "body": [{
+    "type": "BlockStatement",
+    "path": {"type": "PathExpression", "data": false, "depth": 0, "parts": ["if"], "original": "if",
+      "loc": {"source": null, "start": {"line": 1, "column": 3}, "end": {"line": 1, "column": 5}}},
+    "params": [{"type": "PathExpression", "data": false, "depth": 0, "parts": ["ok"], "original": "ok",
+      "loc": {"source": null, "start": {"line": 1, "column": 6}, "end": {"line": 1, "column": 8}}}],
+    "program": {
+      "type": "Program",
+      "body": [{
+        "type": "MustacheStatement",
+        "path": {"type": "PathExpression", "data": false, "depth": 0, "parts": ["name"], "original": "name",
+          "loc": {"source": null, "start": {"line": 1, "column": 14}, "end": {"line": 1, "column": 18}}},
+        "params": [],
+        "escaped": false,
+        "strip": {"open": false, "close": false},
+        "loc": {"source": null, "start": {"line": 1, "column": 10}, "end": {"line": 1, "column": 22}}
+      }],
+      "strip": {},
+      "loc": {"source": null, "start": {"line": 1, "column": 10}, "end": {"line": 1, "column": 22}}
+    },
+    "openStrip": {"open": false, "close": false},
+    "closeStrip": {"open": false, "close": false},
+    "loc": {"source": null, "start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 29}}
+  }],
+  "strip": {},
+  "loc": {"source": null, "start": {"line": 1, "column": 0}, "end": {"line": 1, "column": 29}}
+}`
+
+func TestJSON_UnmarshalHandlebarsJS(t *testing.T) {
+	node, err := ast.UnmarshalNode([]byte(handlebarsJSAST))
+	require.NoError(t, err)
+
+	block := node.(*ast.Program).Body[0].(*ast.BlockStatement)
+	require.Equal(t, 1, block.Line)
+	require.Equal(t, "if", block.Expression.HelperName())
+	require.Equal(t, "ok", block.Expression.Params[0].(*ast.PathExpression).Original)
+
+	mustache := block.Program.Body[0].(*ast.MustacheStatement)
+	require.True(t, mustache.Unescaped)
+	require.Equal(t, "name", mustache.Expression.HelperName())
+	require.Equal(t, ast.Loc{Line: 1, Column: 10, EndLine: 1, EndColumn: 22}, mustache.Loc)
+}
+
+func TestJSON_LocHandlebarsJS(t *testing.T) {
+	data, err := json.Marshal(mustParse(t, `{{#if ok}}{{{ name }}}{{/if}}`))
+	require.NoError(t, err)
+
+	var expected, actual interface{}
+	require.NoError(t, json.Unmarshal([]byte(handlebarsJSAST), &expected))
+	require.NoError(t, json.Unmarshal(data, &actual))
+
+	require.Equal(t, jsonLocs(expected, "", nil), jsonLocs(actual, "", nil))
+}
+
+// jsonLocs returns the start and end of all locations in given JSON AST, by path
+func jsonLocs(v interface{}, path string, result map[string]interface{}) map[string]interface{} {
+	if result == nil {
+		result = map[string]interface{}{}
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if loc, ok := child.(map[string]interface{}); ok && (key == "loc") {
+				result[path] = []interface{}{loc["start"], loc["end"]}
+			} else {
+				jsonLocs(child, path+"."+key, result)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			jsonLocs(child, fmt.Sprintf("%s[%d]", path, i), result)
+		}
+	}
+
+	return result
+}
+
+func TestJSON_UnmarshalErrors(t *testing.T) {
+	_, err := ast.UnmarshalNode([]byte(`{"type": "DecoratorBlock"}`))
+	require.EqualError(t, err, `Unsupported AST node type: "DecoratorBlock"`)
+
+	_, err = ast.UnmarshalNode([]byte(`{"type": "Program", "body": [{"type": "Nope"}]}`))
+	require.Error(t, err)
+
+	var program ast.Program
+	err = json.Unmarshal([]byte(`{"type": "Hash", "pairs": []}`), &program)
+	require.EqualError(t, err, `Unexpected AST node type "Hash", expected "Program"`)
+}
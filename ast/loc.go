@@ -2,11 +2,26 @@ package ast
 
 // Loc represents the position of a parsed node in source file.
 type Loc struct {
-	Pos  int // Byte position
-	Line int // Line number
+	Pos    int // Byte position
+	Line   int // Line number
+	Column int // Column number, in characters from line start
+
+	EndPos    int // Byte position following node
+	EndLine   int // Line number of node end
+	EndColumn int // Column number of node end, in characters from line start
 }
 
 // Location returns itself, and permits struct includers to satisfy that part of Node interface.
 func (l Loc) Location() Loc {
 	return l
 }
+
+// setLocation sets the whole location, and permits decoders to set it on any node.
+func (l *Loc) setLocation(loc Loc) {
+	*l = loc
+}
+
+// locationSetter is implemented by all nodes, as they include Loc.
+type locationSetter interface {
+	setLocation(loc Loc)
+}
@@ -18,7 +18,7 @@ type MustacheStatement struct {
 func NewMustacheStatement(pos int, line int, unescaped bool) *MustacheStatement {
 	return &MustacheStatement{
 		NodeType:  NodeMustache,
-		Loc:       Loc{pos, line},
+		Loc:       Loc{Pos: pos, Line: line},
 		Unescaped: unescaped,
 	}
 }
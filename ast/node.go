@@ -45,6 +45,8 @@ type Visitor interface {
 	VisitString(*StringLiteral) interface{}
 	VisitBoolean(*BooleanLiteral) interface{}
 	VisitNumber(*NumberLiteral) interface{}
+	VisitUndefined(*UndefinedLiteral) interface{}
+	VisitNull(*NullLiteral) interface{}
 
 	// miscellaneous
 	VisitHash(*Hash) interface{}
@@ -98,5 +100,13 @@ func LiteralStr(node Node) (string, bool) {
 		return lit.Canonical(), true
 	}
 
+	if lit, ok := node.(*UndefinedLiteral); ok {
+		return lit.Canonical(), true
+	}
+
+	if lit, ok := node.(*NullLiteral); ok {
+		return lit.Canonical(), true
+	}
+
 	return "", false
 }
@@ -42,6 +42,12 @@ const (
 
 	// NodeHashPair is the hash pair node
 	NodeHashPair
+
+	// NodeUndefined is the literal undefined node
+	NodeUndefined
+
+	// NodeNull is the literal null node
+	NodeNull
 )
 
 // NodeType represents an AST Node type.
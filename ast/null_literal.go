@@ -0,0 +1,32 @@
+package ast
+
+import "fmt"
+
+// NullLiteral represents a null node.
+type NullLiteral struct {
+	NodeType
+	Loc
+}
+
+// NewNullLiteral instanciates a new null node.
+func NewNullLiteral(pos int, line int) *NullLiteral {
+	return &NullLiteral{
+		NodeType: NodeNull,
+		Loc:      Loc{Pos: pos, Line: line},
+	}
+}
+
+// String returns a string representation of receiver that can be used for debugging.
+func (node *NullLiteral) String() string {
+	return fmt.Sprintf("Null{Pos:%d}", node.Loc.Pos)
+}
+
+// Accept is the receiver entry point for visitors.
+func (node *NullLiteral) Accept(visitor Visitor) interface{} {
+	return visitor.VisitNull(node)
+}
+
+// Canonical returns the canonical form of null node as a string (ie. "null").
+func (node *NullLiteral) Canonical() string {
+	return "null"
+}
@@ -252,6 +252,28 @@ func (v *printVisitor) VisitNumber(node *NumberLiteral) interface{} {
 	return nil
 }
 
+// VisitUndefined implements corresponding Visitor interface method
+func (v *printVisitor) VisitUndefined(node *UndefinedLiteral) interface{} {
+	if v.original {
+		v.str(node.Canonical())
+	} else {
+		v.str("UNDEFINED")
+	}
+
+	return nil
+}
+
+// VisitNull implements corresponding Visitor interface method
+func (v *printVisitor) VisitNull(node *NullLiteral) interface{} {
+	if v.original {
+		v.str(node.Canonical())
+	} else {
+		v.str("NULL")
+	}
+
+	return nil
+}
+
 // Miscellaneous
 
 // VisitHash implements corresponding Visitor interface method
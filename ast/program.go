@@ -22,7 +22,7 @@ type Program struct {
 func NewProgram(pos int, line int) *Program {
 	return &Program{
 		NodeType: NodeProgram,
-		Loc:      Loc{pos, line},
+		Loc:      Loc{Pos: pos, Line: line},
 	}
 }
 
@@ -0,0 +1,272 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// References:
+//   - https://github.com/golang/tools/blob/master/go/ast/astutil/rewrite.go
+
+// RewriteFunc is the type of the function called by Rewrite for each node. If the function returns false, the
+// traversal is stopped: when called before children, the children are skipped, and when called after children,
+// the whole rewrite is aborted.
+type RewriteFunc func(*Cursor) bool
+
+// Rewrite traverses the AST rooted at given node in depth-first order, calling pre before visiting the children of
+// each node, and post after. Both functions may be nil.
+//
+// The functions can modify the AST with the Cursor methods: replaced nodes are not walked, and inserted nodes are
+// walked only if they are inserted after current node.
+//
+// Rewrite returns the possibly modified root node.
+func Rewrite(root Node, pre, post RewriteFunc) (result Node) {
+	parent := &rewriteRoot{Root: root}
+
+	defer func() {
+		if r := recover(); r != nil && r != errAbortRewrite {
+			panic(r)
+		}
+		result = parent.Root
+	}()
+
+	r := &rewriter{pre: pre, post: post}
+	r.apply(parent, "Root", nil, root)
+
+	return
+}
+
+// Cursor describes a node encountered during Rewrite.
+type Cursor struct {
+	parent  Node
+	name    string
+	iter    *iterator // valid if non-nil
+	node    Node
+	parents []Node
+}
+
+// iterator tracks current position in a nodes slice
+type iterator struct {
+	index, step int
+}
+
+// Node returns current node.
+func (c *Cursor) Node() Node {
+	return c.node
+}
+
+// Parent returns the parent of current node, or nil if current node is the root.
+func (c *Cursor) Parent() Node {
+	if _, ok := c.parent.(*rewriteRoot); ok {
+		return nil
+	}
+	return c.parent
+}
+
+// Parents returns the ancestors of current node, from the root to its direct parent. It is only valid during the
+// call and must be copied to be retained.
+func (c *Cursor) Parents() []Node {
+	return c.parents
+}
+
+// Name returns the name of the parent field that contains current node, for example "Body" for a Program
+// statement, or "Path" for an expression path. It returns "Root" for the root node.
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Index returns the index of current node in the slice field of its parent, or -1 if current node is not part of
+// a slice.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// field returns the parent field holding current node
+func (c *Cursor) field() reflect.Value {
+	return reflect.Indirect(reflect.ValueOf(c.parent)).FieldByName(c.name)
+}
+
+// Replace replaces current node with given node. It panics if given node type is not allowed in parent field.
+//
+// Replacing a node that is not part of a slice with nil removes it, for example to remove an optional block
+// inverse or hash.
+func (c *Cursor) Replace(node Node) {
+	v := c.field()
+	if i := c.Index(); i >= 0 {
+		v = v.Index(i)
+	}
+
+	v.Set(nodeValue(node, v.Type()))
+	c.node = node
+}
+
+// Delete deletes current node from its parent slice. It panics if current node is not part of a slice.
+func (c *Cursor) Delete() {
+	i := c.Index()
+	if i < 0 {
+		panic(fmt.Sprintf("ast: Delete node %s not contained in a slice", c.node))
+	}
+
+	v := c.field()
+	l := v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+
+	c.iter.step--
+}
+
+// InsertAfter inserts given node after current node in its parent slice. It panics if current node is not part of
+// a slice. The inserted node is walked after current node.
+func (c *Cursor) InsertAfter(node Node) {
+	i := c.Index()
+	if i < 0 {
+		panic(fmt.Sprintf("ast: InsertAfter node %s not contained in a slice", c.node))
+	}
+
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+	v.Index(i + 1).Set(nodeValue(node, v.Type().Elem()))
+
+	c.iter.step++
+}
+
+// InsertBefore inserts given node before current node in its parent slice. It panics if current node is not part
+// of a slice. The inserted node is not walked.
+func (c *Cursor) InsertBefore(node Node) {
+	i := c.Index()
+	if i < 0 {
+		panic(fmt.Sprintf("ast: InsertBefore node %s not contained in a slice", c.node))
+	}
+
+	v := c.field()
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	v.Index(i).Set(nodeValue(node, v.Type().Elem()))
+
+	c.iter.index++
+}
+
+// nodeValue returns a value of given type holding given node
+func nodeValue(node Node, typ reflect.Type) reflect.Value {
+	if isNil(node) {
+		return reflect.Zero(typ)
+	}
+
+	v := reflect.ValueOf(node)
+	if !v.Type().AssignableTo(typ) {
+		panic(fmt.Sprintf("ast: can't set node %s in a field of type %s", node, typ))
+	}
+
+	return v
+}
+
+// rewriteRoot holds the root node during a rewrite, so that it can be replaced like any other node
+type rewriteRoot struct {
+	NodeType
+	Loc
+
+	Root Node
+}
+
+func (node *rewriteRoot) String() string                     { return "Root" }
+func (node *rewriteRoot) Accept(visitor Visitor) interface{} { return nil }
+
+var errAbortRewrite = new(int)
+
+// rewriter holds rewrite state
+type rewriter struct {
+	pre     RewriteFunc
+	post    RewriteFunc
+	cursor  Cursor
+	parents []Node
+}
+
+func (r *rewriter) apply(parent Node, name string, iter *iterator, node Node) {
+	if isNil(node) {
+		return
+	}
+
+	saved := r.cursor
+	r.cursor = Cursor{
+		parent:  parent,
+		name:    name,
+		iter:    iter,
+		node:    node,
+		parents: r.parents,
+	}
+
+	if r.pre != nil && !r.pre(&r.cursor) {
+		r.cursor = saved
+		return
+	}
+
+	// the node may have been replaced
+	node = r.cursor.node
+	if !isNil(node) {
+		r.parents = append(r.parents, node)
+		r.applyChildren(node)
+		r.parents = r.parents[:len(r.parents)-1]
+	}
+
+	if r.post != nil && !r.post(&r.cursor) {
+		panic(errAbortRewrite)
+	}
+
+	r.cursor = saved
+}
+
+func (r *rewriter) applyChildren(node Node) {
+	switch n := node.(type) {
+	case *Program:
+		r.applyList(n, "Body")
+
+	case *MustacheStatement:
+		r.apply(n, "Expression", nil, exprNode(n.Expression))
+
+	case *BlockStatement:
+		r.apply(n, "Expression", nil, exprNode(n.Expression))
+		r.apply(n, "Program", nil, programNode(n.Program))
+		r.apply(n, "Inverse", nil, programNode(n.Inverse))
+
+	case *PartialStatement:
+		r.apply(n, "Name", nil, n.Name)
+		r.applyList(n, "Params")
+		r.apply(n, "Hash", nil, hashNode(n.Hash))
+
+	case *Expression:
+		r.apply(n, "Path", nil, n.Path)
+		r.applyList(n, "Params")
+		r.apply(n, "Hash", nil, hashNode(n.Hash))
+
+	case *SubExpression:
+		r.apply(n, "Expression", nil, exprNode(n.Expression))
+
+	case *Hash:
+		r.applyList(n, "Pairs")
+
+	case *HashPair:
+		r.apply(n, "Val", nil, n.Val)
+	}
+}
+
+func (r *rewriter) applyList(parent Node, name string) {
+	it := &iterator{}
+	for it.index = 0; ; it.index += it.step {
+		it.step = 1
+
+		v := reflect.Indirect(reflect.ValueOf(parent)).FieldByName(name)
+		if it.index >= v.Len() {
+			break
+		}
+
+		node, _ := v.Index(it.index).Interface().(Node)
+		r.apply(parent, name, it, node)
+	}
+}
@@ -4,12 +4,12 @@ import "fmt"
 
 // Strip describes node whitespace management.
 type Strip struct {
-	Open  bool
-	Close bool
+	Open  bool `json:"open"`
+	Close bool `json:"close"`
 
-	OpenStandalone   bool
-	CloseStandalone  bool
-	InlineStandalone bool
+	OpenStandalone   bool `json:"openStandalone,omitempty"`
+	CloseStandalone  bool `json:"closeStandalone,omitempty"`
+	InlineStandalone bool `json:"inlineStandalone,omitempty"`
 }
 
 // NewStrip instanciates a Strip for given open and close mustaches.
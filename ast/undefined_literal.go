@@ -0,0 +1,32 @@
+package ast
+
+import "fmt"
+
+// UndefinedLiteral represents an undefined node.
+type UndefinedLiteral struct {
+	NodeType
+	Loc
+}
+
+// NewUndefinedLiteral instanciates a new undefined node.
+func NewUndefinedLiteral(pos int, line int) *UndefinedLiteral {
+	return &UndefinedLiteral{
+		NodeType: NodeUndefined,
+		Loc:      Loc{Pos: pos, Line: line},
+	}
+}
+
+// String returns a string representation of receiver that can be used for debugging.
+func (node *UndefinedLiteral) String() string {
+	return fmt.Sprintf("Undefined{Pos:%d}", node.Loc.Pos)
+}
+
+// Accept is the receiver entry point for visitors.
+func (node *UndefinedLiteral) Accept(visitor Visitor) interface{} {
+	return visitor.VisitUndefined(node)
+}
+
+// Canonical returns the canonical form of undefined node as a string (ie. "undefined").
+func (node *UndefinedLiteral) Canonical() string {
+	return "undefined"
+}
@@ -0,0 +1,185 @@
+package ast
+
+// Children returns the direct children of given node, in source order. Nil children are skipped.
+func Children(node Node) []Node {
+	var result []Node
+
+	add := func(n Node) {
+		if !isNil(n) {
+			result = append(result, n)
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Body {
+			add(s)
+		}
+
+	case *MustacheStatement:
+		add(exprNode(n.Expression))
+
+	case *BlockStatement:
+		add(exprNode(n.Expression))
+		add(programNode(n.Program))
+		add(programNode(n.Inverse))
+
+	case *PartialStatement:
+		add(n.Name)
+		for _, p := range n.Params {
+			add(p)
+		}
+		add(hashNode(n.Hash))
+
+	case *Expression:
+		add(n.Path)
+		for _, p := range n.Params {
+			add(p)
+		}
+		add(hashNode(n.Hash))
+
+	case *SubExpression:
+		add(exprNode(n.Expression))
+
+	case *Hash:
+		for _, p := range n.Pairs {
+			add(hashPairNode(p))
+		}
+
+	case *HashPair:
+		add(n.Val)
+	}
+
+	return result
+}
+
+// WalkFunc is the type of the function called by Walk for each node. The parents slice holds the ancestors of node,
+// from the root to its direct parent: it is only valid during the call and must be copied to be retained.
+//
+// If the function returns false, children of node are not visited.
+type WalkFunc func(node Node, parents []Node) bool
+
+// Walk traverses the AST rooted at given node in depth-first order, calling fn for each node with its ancestors.
+func Walk(root Node, fn WalkFunc) {
+	if isNil(root) {
+		return
+	}
+
+	walk(root, nil, fn)
+}
+
+func walk(node Node, parents []Node, fn WalkFunc) {
+	if !fn(node, parents) {
+		return
+	}
+
+	parents = append(parents, node)
+	for _, child := range Children(node) {
+		walk(child, parents, fn)
+	}
+}
+
+// Inspect traverses the AST rooted at given node in depth-first order. It starts by calling f(node): if f returns
+// true, Inspect is called recursively for each children of node, followed by a call of f(nil).
+func Inspect(root Node, f func(Node) bool) {
+	if isNil(root) {
+		return
+	}
+
+	if !f(root) {
+		return
+	}
+
+	for _, child := range Children(root) {
+		Inspect(child, f)
+	}
+
+	f(nil)
+}
+
+// Parents returns a map of all nodes of the AST rooted at given node to their direct parent. The root node is not
+// present in returned map.
+func Parents(root Node) map[Node]Node {
+	result := make(map[Node]Node)
+
+	Walk(root, func(node Node, parents []Node) bool {
+		if len(parents) > 0 {
+			result[node] = parents[len(parents)-1]
+		}
+		return true
+	})
+
+	return result
+}
+
+// PathTo returns the path from root node to given target node, both included, or nil if target is not in the AST.
+func PathTo(root Node, target Node) []Node {
+	var result []Node
+
+	Walk(root, func(node Node, parents []Node) bool {
+		if result != nil {
+			return false
+		}
+
+		if node == target {
+			result = make([]Node, len(parents), len(parents)+1)
+			copy(result, parents)
+			result = append(result, node)
+			return false
+		}
+
+		return true
+	})
+
+	return result
+}
+
+// isNil returns true if given node is nil, or is an interface holding a nil pointer.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		return n == nil
+	case *Expression:
+		return n == nil
+	case *Hash:
+		return n == nil
+	case *HashPair:
+		return n == nil
+	}
+
+	return false
+}
+
+// helpers that avoid converting nil pointers to non-nil Node interfaces
+
+func exprNode(n *Expression) Node {
+	if n == nil {
+		return nil
+	}
+	return n
+}
+
+func programNode(n *Program) Node {
+	if n == nil {
+		return nil
+	}
+	return n
+}
+
+func hashNode(n *Hash) Node {
+	if n == nil {
+		return nil
+	}
+	return n
+}
+
+func hashPairNode(n *HashPair) Node {
+	if n == nil {
+		return nil
+	}
+	return n
+}
@@ -0,0 +1,183 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/imantung/mario/ast"
+	"github.com/imantung/mario/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, source string) *ast.Program {
+	t.Helper()
+
+	program, err := parser.Parse(source)
+	require.NoError(t, err)
+
+	return program
+}
+
+func TestInspect(t *testing.T) {
+	program := mustParse(t, `{{#if foo}}{{bar baz=(qux 1)}}{{else}}{{> part}}{{/if}}`)
+
+	var paths []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if path, ok := node.(*ast.PathExpression); ok {
+			paths = append(paths, path.Original)
+		}
+		return true
+	})
+
+	require.Equal(t, []string{"if", "foo", "bar", "qux", "part"}, paths)
+}
+
+func TestInspect_SkipChildren(t *testing.T) {
+	program := mustParse(t, `{{foo (bar)}}{{#baz}}{{qux}}{{/baz}}`)
+
+	var paths []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.PathExpression:
+			paths = append(paths, n.Original)
+		case *ast.SubExpression, *ast.BlockStatement:
+			return false
+		}
+		return true
+	})
+
+	require.Equal(t, []string{"foo"}, paths)
+}
+
+func TestWalk_Parents(t *testing.T) {
+	program := mustParse(t, `{{#each items}}{{name}}{{/each}}`)
+
+	var name *ast.PathExpression
+	var parents []ast.Node
+	ast.Walk(program, func(node ast.Node, p []ast.Node) bool {
+		if path, ok := node.(*ast.PathExpression); ok && path.Original == "name" {
+			name = path
+			parents = append([]ast.Node(nil), p...)
+		}
+		return true
+	})
+
+	require.NotNil(t, name)
+	require.Len(t, parents, 5)
+	require.Equal(t, ast.Node(program), parents[0])
+	require.IsType(t, &ast.BlockStatement{}, parents[1])
+	require.IsType(t, &ast.Program{}, parents[2])
+	require.IsType(t, &ast.MustacheStatement{}, parents[3])
+	require.IsType(t, &ast.Expression{}, parents[4])
+
+	require.Equal(t, append(parents, name), ast.PathTo(program, name))
+	require.Equal(t, parents[4], ast.Parents(program)[name])
+}
+
+func TestRewrite_RenameHelper(t *testing.T) {
+	program := mustParse(t, `{{format date}}{{#each items}}{{format this "short"}}{{/each}}`)
+
+	ast.Rewrite(program, func(c *ast.Cursor) bool {
+		if expr, ok := c.Node().(*ast.Expression); ok && expr.HelperName() == "format" {
+			path := expr.Path.(*ast.PathExpression)
+			renamed := ast.NewPathExpression(path.Pos, path.Line, false)
+			renamed.Part("formatDate")
+
+			expr.Path = renamed
+		}
+		return true
+	}, nil)
+
+	var helpers []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if expr, ok := node.(*ast.Expression); ok {
+			helpers = append(helpers, expr.HelperName())
+		}
+		return true
+	})
+
+	require.Equal(t, []string{"formatDate", "each", "formatDate"}, helpers)
+}
+
+func TestRewrite_ReplaceInsertDelete(t *testing.T) {
+	program := mustParse(t, `a{{! comment }}{{foo}}b`)
+
+	result := ast.Rewrite(program, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.CommentStatement:
+			require.Equal(t, "Body", c.Name())
+			require.Equal(t, 1, c.Index())
+			c.Delete()
+
+		case *ast.MustacheStatement:
+			c.InsertBefore(ast.NewContentStatement(n.Pos, n.Line, "<"))
+			c.InsertAfter(ast.NewContentStatement(n.Pos, n.Line, ">"))
+			return false
+
+		case *ast.ContentStatement:
+			if n.Value == "b" {
+				c.Replace(ast.NewContentStatement(n.Pos, n.Line, "c"))
+			}
+		}
+		return true
+	}, nil)
+
+	require.Equal(t, ast.Node(program), result)
+	require.Equal(t, "CONTENT[ 'a' ]\nCONTENT[ '<' ]\n{{ PATH:foo [] }}\nCONTENT[ '>' ]\nCONTENT[ 'c' ]\n", ast.Print(program))
+}
+
+func TestRewrite_RemoveOptionalNode(t *testing.T) {
+	program := mustParse(t, `{{#if foo}}yes{{else}}no{{/if}}`)
+
+	ast.Rewrite(program, nil, func(c *ast.Cursor) bool {
+		if c.Name() == "Inverse" {
+			require.IsType(t, &ast.BlockStatement{}, c.Parent())
+			c.Replace(nil)
+		}
+		return true
+	})
+
+	block := program.Body[0].(*ast.BlockStatement)
+	require.Nil(t, block.Inverse)
+}
+
+func TestRewrite_Root(t *testing.T) {
+	program := mustParse(t, `{{foo}}`)
+	replacement := mustParse(t, `bar`)
+
+	result := ast.Rewrite(program, func(c *ast.Cursor) bool {
+		require.Nil(t, c.Parent())
+		require.Equal(t, -1, c.Index())
+		c.Replace(replacement)
+		return false
+	}, nil)
+
+	require.Equal(t, ast.Node(replacement), result)
+}
+
+func TestRewrite_Abort(t *testing.T) {
+	program := mustParse(t, `{{foo}}{{bar}}`)
+
+	var visited []string
+	ast.Rewrite(program, nil, func(c *ast.Cursor) bool {
+		if path, ok := c.Node().(*ast.PathExpression); ok {
+			visited = append(visited, path.Original)
+			return false
+		}
+		return true
+	})
+
+	require.Equal(t, []string{"foo"}, visited)
+}
+
+func TestRewrite_InvalidReplace(t *testing.T) {
+	program := mustParse(t, `{{foo bar=baz}}`)
+
+	require.Panics(t, func() {
+		ast.Rewrite(program, func(c *ast.Cursor) bool {
+			if c.Name() == "Pairs" {
+				c.Replace(ast.NewContentStatement(0, 0, "nope"))
+			}
+			return true
+		}, nil)
+	})
+}
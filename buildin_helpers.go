@@ -1,9 +1,6 @@
 package mario
 
-import (
-	"log"
-	"reflect"
-)
+import "reflect"
 
 func ifHelper(conditional interface{}, options *Options) interface{} {
 	if options.isIncludableZero() || IsTrue(conditional) {
@@ -21,6 +18,13 @@ func unlessHelper(conditional interface{}, options *Options) interface{} {
 
 func withHelper(context interface{}, options *Options) interface{} {
 	if IsTrue(context) {
+		if options.eval.trackIds {
+			data := options.NewDataFrame()
+			data.Set("contextPath", options.contextPath())
+
+			return options.evalBlock(context, data, nil)
+		}
+
 		return options.FnWith(context)
 	}
 	return options.Inverse()
@@ -33,12 +37,25 @@ func eachHelper(context interface{}, options *Options) interface{} {
 
 	result := ""
 
+	// trackIds mode: sets @contextPath of iteration
+	var contextPath string
+	if options.eval.trackIds {
+		contextPath = options.contextPath()
+	}
+
+	setContextPath := func(data *DataFrame, field interface{}) {
+		if options.eval.trackIds {
+			data.Set("contextPath", appendContextPath(contextPath, Str(field)))
+		}
+	}
+
 	val := reflect.ValueOf(context)
 	switch val.Kind() {
 	case reflect.Array, reflect.Slice:
 		for i := 0; i < val.Len(); i++ {
 			// computes private data
 			data := options.newIterDataFrame(val.Len(), i, nil)
+			setContextPath(data, i)
 
 			// evaluates block
 			result += options.evalBlock(val.Index(i).Interface(), data, i)
@@ -52,6 +69,7 @@ func eachHelper(context interface{}, options *Options) interface{} {
 
 			// computes private data
 			data := options.newIterDataFrame(len(keys), i, key)
+			setContextPath(data, key)
 
 			// evaluates block
 			result += options.evalBlock(ctx, data, key)
@@ -72,6 +90,7 @@ func eachHelper(context interface{}, options *Options) interface{} {
 
 			// computes private data
 			data := options.newIterDataFrame(len(exportedFields), i, key)
+			setContextPath(data, key)
 
 			// evaluates block
 			result += options.evalBlock(ctx, data, key)
@@ -81,8 +100,21 @@ func eachHelper(context interface{}, options *Options) interface{} {
 	return result
 }
 
-func logHelper(message string) interface{} {
-	log.Print(message)
+func logHelper(options *Options) interface{} {
+	level := LogInfo
+
+	value, ok := options.hash["level"]
+	if !ok {
+		value = options.Data("level")
+	}
+
+	if value != nil {
+		if level, ok = ParseLogLevel(value); !ok {
+			options.eval.panicf("Invalid log level: %v", value)
+		}
+	}
+
+	options.eval.log(level, options.Params()...)
 	return ""
 }
 
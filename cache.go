@@ -0,0 +1,285 @@
+package mario
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/imantung/mario/ast"
+)
+
+// Templates cache format:
+//
+//   magic    "MARIOTPL"
+//   version  uint16, big endian
+//   payload  uvarint length, then bytes
+//   checksum sha256 of payload
+//
+// The payload holds the templates count, then for each template, sorted by name: its name, source, Mustache mode,
+// delimiters, standalone tags detection and partials indentation modes, trackIds, stringParams and compat modes,
+// sorted known helpers names and knownHelpersOnly mode, static partials names, and its binary encoded program.
+//
+// cacheVersion must be incremented each time that format, or the ast binary encoding, changes.
+
+const (
+	cacheMagic   = "MARIOTPL"
+	cacheVersion = 1
+)
+
+var (
+	// ErrCacheVersion is returned when reading a templates cache written with another format version.
+	ErrCacheVersion = errors.New("Unsupported templates cache version")
+
+	// ErrCacheChecksum is returned when reading a corrupted templates cache.
+	ErrCacheChecksum = errors.New("Templates cache checksum mismatch")
+)
+
+// WriteCache writes all templates of the set to w, in a versioned binary format that can be loaded with
+// ReadTemplateSetCache. Helpers and interceptors are not written.
+//
+// It returns an error if a template includes a static partial that is not in the set.
+func (set *TemplateSet) WriteCache(w io.Writer) error {
+	var payload cacheEncoder
+
+	names := set.Names()
+	payload.uint(uint64(len(names)))
+
+	for _, name := range names {
+		tpl := set.templates[name]
+
+		partials := tpl.Analyze().Partials
+		for _, partial := range partials {
+			if set.templates[partial] == nil {
+				return fmt.Errorf("Partial not found in template %s: %s", name, partial)
+			}
+		}
+
+		payload.str(name)
+		payload.str(tpl.source)
+		payload.bool(tpl.mustache)
+		payload.str(tpl.delims[0])
+		payload.str(tpl.delims[1])
+		payload.bool(tpl.ignoreStandalone)
+		payload.bool(tpl.preventIndent)
+		payload.bool(tpl.trackIds)
+		payload.bool(tpl.stringParams)
+		payload.bool(tpl.compat)
+		payload.strs(tpl.knownHelpersNames())
+		payload.bool(tpl.knownHelpersOnly)
+		payload.strs(partials)
+		payload.bytes(ast.MarshalBinaryNode(tpl.program))
+	}
+
+	var header cacheEncoder
+	header.buf = append(header.buf, cacheMagic...)
+	header.buf = append(header.buf, byte(cacheVersion>>8), byte(cacheVersion))
+	header.uint(uint64(len(payload.buf)))
+
+	checksum := sha256.Sum256(payload.buf)
+
+	for _, b := range [][]byte{header.buf, payload.buf, checksum[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadTemplateSetCache reads a template set written by WriteCache. Templates are not parsed again.
+//
+// It returns ErrCacheVersion if the cache was written with another format version, and ErrCacheChecksum if it is
+// corrupted. Helpers must be registered globally, or on each template of the set.
+func ReadTemplateSetCache(r io.Reader) (*TemplateSet, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(data, []byte(cacheMagic)) {
+		return nil, errors.New("Not a templates cache")
+	}
+	data = data[len(cacheMagic):]
+
+	if len(data) < 2 {
+		return nil, ErrCacheChecksum
+	}
+	if version := int(data[0])<<8 | int(data[1]); version != cacheVersion {
+		return nil, fmt.Errorf("%w: %d, expected %d", ErrCacheVersion, version, cacheVersion)
+	}
+	data = data[2:]
+
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) != size+sha256.Size {
+		return nil, ErrCacheChecksum
+	}
+
+	payload := data[n : n+int(size)]
+	if checksum := sha256.Sum256(payload); !bytes.Equal(checksum[:], data[n+int(size):]) {
+		return nil, ErrCacheChecksum
+	}
+
+	result := NewTemplateSet()
+	if err := result.readCachePayload(payload); err != nil {
+		return nil, fmt.Errorf("Invalid templates cache: %s", err)
+	}
+
+	return result, nil
+}
+
+// readCachePayload adds all templates encoded in given cache payload
+func (set *TemplateSet) readCachePayload(payload []byte) (err error) {
+	d := cacheDecoder{buf: payload}
+	defer d.recover(&err)
+
+	// static partials, by including template name
+	partials := make(map[string][]string)
+
+	count := d.uint()
+	for i := uint64(0); i < count; i++ {
+		tpl := New()
+
+		name := d.str()
+		tpl.source = d.str()
+		tpl.mustache = d.bool()
+		tpl.delims = [2]string{d.str(), d.str()}
+		tpl.ignoreStandalone = d.bool()
+		tpl.preventIndent = d.bool()
+		tpl.trackIds = d.bool()
+		tpl.stringParams = d.bool()
+		tpl.compat = d.bool()
+		if names := d.strs(); len(names) > 0 {
+			tpl.WithKnownHelpers(names...)
+		}
+		tpl.knownHelpersOnly = d.bool()
+
+		partials[name] = d.strs()
+
+		node, err := ast.UnmarshalBinaryNode(d.bytes())
+		if err != nil {
+			return err
+		}
+
+		program, ok := node.(*ast.Program)
+		if !ok {
+			return fmt.Errorf("Template %s is not a program", name)
+		}
+
+		if err := tpl.setProgram(program); err != nil {
+			return err
+		}
+		set.templates[name] = tpl
+	}
+
+	for _, name := range set.Names() {
+		for _, partial := range partials[name] {
+			if set.templates[partial] == nil {
+				return fmt.Errorf("Partial not found in template %s: %s", name, partial)
+			}
+		}
+	}
+
+	set.link()
+
+	return nil
+}
+
+// cacheEncoder encodes templates cache payload
+type cacheEncoder struct {
+	buf []byte
+}
+
+func (e *cacheEncoder) uint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	e.buf = append(e.buf, b[:n]...)
+}
+
+func (e *cacheEncoder) bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+func (e *cacheEncoder) bytes(v []byte) {
+	e.uint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *cacheEncoder) str(v string) {
+	e.bytes([]byte(v))
+}
+
+func (e *cacheEncoder) strs(v []string) {
+	e.uint(uint64(len(v)))
+	for _, s := range v {
+		e.str(s)
+	}
+}
+
+// cacheDecoder decodes templates cache payload, and panics on truncated input
+type cacheDecoder struct {
+	buf []byte
+}
+
+var errCacheTruncated = errors.New("Truncated templates cache")
+
+func (d *cacheDecoder) recover(err *error) {
+	if r := recover(); r != nil {
+		if r != errCacheTruncated {
+			panic(r)
+		}
+		*err = errCacheTruncated
+	}
+}
+
+func (d *cacheDecoder) uint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		panic(errCacheTruncated)
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *cacheDecoder) bool() bool {
+	if len(d.buf) == 0 {
+		panic(errCacheTruncated)
+	}
+	v := d.buf[0] != 0
+	d.buf = d.buf[1:]
+	return v
+}
+
+func (d *cacheDecoder) bytes() []byte {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		panic(errCacheTruncated)
+	}
+	v := d.buf[:n]
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *cacheDecoder) str() string {
+	return string(d.bytes())
+}
+
+func (d *cacheDecoder) strs() []string {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		panic(errCacheTruncated)
+	}
+
+	var result []string
+	for i := uint64(0); i < n; i++ {
+		result = append(result, d.str())
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+package mario_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func newCachedSet(t *testing.T) *mario.TemplateSet {
+	set := mario.NewTemplateSet()
+
+	_, err := set.Parse("page", "{{#each items as |item|}}\n  {{> card item}}\n{{~/each}}")
+	require.NoError(t, err)
+
+	_, err = set.Parse("card", "<b>{{name}}</b>\n")
+	require.NoError(t, err)
+
+	return set
+}
+
+func TestTemplateSet_Cache(t *testing.T) {
+	set := newCachedSet(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, set.WriteCache(&buf))
+
+	cached, err := mario.ReadTemplateSetCache(&buf)
+	require.NoError(t, err)
+	require.Equal(t, []string{"card", "page"}, cached.Names())
+
+	for _, name := range set.Names() {
+		require.Equal(t, set.Lookup(name).Program(), cached.Lookup(name).Program())
+		require.Equal(t, set.Lookup(name).Source(), cached.Lookup(name).Source())
+	}
+
+	ctx := map[string]interface{}{"items": []map[string]string{{"name": "a"}, {"name": "b"}}}
+
+	var expected, result strings.Builder
+	require.NoError(t, set.Lookup("page").Execute(&expected, ctx))
+	require.NoError(t, cached.Lookup("page").Execute(&result, ctx))
+	require.Equal(t, expected.String(), result.String())
+	require.Equal(t, "  <b>a</b>\n  <b>b</b>\n", result.String())
+
+	deps, err := cached.Dependencies("page")
+	require.NoError(t, err)
+	require.Equal(t, []string{"card"}, deps)
+}
+
+func TestTemplateSet_Cache_Invalid(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, newCachedSet(t).WriteCache(&buf))
+	data := buf.Bytes()
+
+	// version
+	other := append([]byte(nil), data...)
+	other[9]++
+	_, err := mario.ReadTemplateSetCache(bytes.NewReader(other))
+	require.True(t, errors.Is(err, mario.ErrCacheVersion))
+
+	// checksum
+	other = append([]byte(nil), data...)
+	other[len(other)/2]++
+	_, err = mario.ReadTemplateSetCache(bytes.NewReader(other))
+	require.Equal(t, mario.ErrCacheChecksum, err)
+
+	// truncated
+	_, err = mario.ReadTemplateSetCache(bytes.NewReader(data[:len(data)-1]))
+	require.Equal(t, mario.ErrCacheChecksum, err)
+
+	// not a cache
+	_, err = mario.ReadTemplateSetCache(strings.NewReader("{{foo}}"))
+	require.EqualError(t, err, "Not a templates cache")
+}
+
+func TestTemplateSet_Cache_MissingPartial(t *testing.T) {
+	set := mario.NewTemplateSet()
+
+	_, err := set.Parse("page", "{{> header}}")
+	require.NoError(t, err)
+
+	require.EqualError(t, set.WriteCache(&bytes.Buffer{}), "Partial not found in template page: header")
+}
+
+func TestTemplateSet_Cache_Options(t *testing.T) {
+	ctx := map[string]interface{}{
+		"foo": "context",
+		"a":   map[string]interface{}{"b": "c"},
+		"omg": map[string]string{"yes": "OMG!"},
+	}
+
+	for _, test := range []struct {
+		name     string
+		tpl      *mario.Template
+		source   string
+		expected string
+	}{
+		{"preventIndent", mario.New().WithPreventIndent(), "<div>\n  {{> card}}\n</div>", "<div>\n  a\nb\n</div>"},
+		{"trackIds", mario.New().WithTrackIds(), "{{info a.b}}", "a.b"},
+		{"stringParams", mario.New().WithStringParams(), "{{info a.b}}", mario.ParamTypeID},
+		{"compat", mario.New().WithCompat(), "{{#with a}}{{omg.yes}}{{/with}}", "OMG!"},
+		{"knownHelpersOnly", mario.New().WithKnownHelpersOnly(), "{{foo}}", "context"},
+		{"knownHelpers", mario.New().WithKnownHelpersOnly().WithKnownHelpers("foo"), "{{foo}}", "helper"},
+	} {
+		set := mario.NewTemplateSet()
+
+		_, err := test.tpl.Parse(test.source)
+		require.NoError(t, err, test.name)
+		require.NoError(t, set.Add("page", test.tpl), test.name)
+
+		_, err = set.Parse("card", "a\nb\n")
+		require.NoError(t, err, test.name)
+
+		var buf bytes.Buffer
+		require.NoError(t, set.WriteCache(&buf), test.name)
+
+		cached, err := mario.ReadTemplateSetCache(&buf)
+		require.NoError(t, err, test.name)
+
+		for _, tpl := range []*mario.Template{set.Lookup("page"), cached.Lookup("page")} {
+			tpl.WithHelperFunc("foo", fooHelper)
+			tpl.WithHelperFunc("info", func(value interface{}, options *mario.Options) string {
+				return options.ParamPath(0) + options.ParamType(0)
+			})
+
+			var b strings.Builder
+			require.NoError(t, tpl.Execute(&b, ctx), test.name)
+			require.Equal(t, test.expected, b.String(), test.name)
+		}
+	}
+}
@@ -0,0 +1,656 @@
+package mario
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/imantung/mario/ast"
+)
+
+var (
+	optionsType = reflect.TypeOf((*Options)(nil))
+	intType     = reflect.TypeOf(0)
+	boolType    = reflect.TypeOf(true)
+	stringType  = reflect.TypeOf("")
+)
+
+// CheckProblem describes a problem found while checking a template against a type.
+type CheckProblem struct {
+	Partial string // partial name, empty for the checked template itself
+	Loc     ast.Loc
+	Message string
+}
+
+// String returns a string representation of receiver.
+func (p *CheckProblem) String() string {
+	if p.Partial != "" {
+		return fmt.Sprintf("Check error in partial %s on line %d: %s", p.Partial, p.Loc.Line, p.Message)
+	}
+	return fmt.Sprintf("Check error on line %d: %s", p.Loc.Line, p.Message)
+}
+
+// CheckError is returned when a template does not match the type it was checked against.
+type CheckError struct {
+	Problems []*CheckProblem
+}
+
+// Error implements the error interface.
+func (e *CheckError) Error() string {
+	var lines []string
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CheckAgainst statically checks template against the type of the context it will be executed with.
+//
+// Paths are resolved with the same rules as evaluation: lowercased field names, `handlebars` struct tags, methods,
+// map keys and slice indexes, following context shifts of `each`, `with` and sections, and block parameters.
+// Custom block helpers are considered to evaluate their block with current context.
+//
+// It returns a *CheckError listing unresolvable paths, missing partials and helpers arity mismatches.
+func (tpl *Template) CheckAgainst(typ reflect.Type) error {
+	v := newChecker(tpl, typ)
+
+	if tpl.program != nil {
+		tpl.program.Accept(v)
+	}
+
+	if len(v.problems) > 0 {
+		return &CheckError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+// checkScope represents a context pushed on the contexts stack during evaluation
+type checkScope struct {
+	typ     reflect.Type // nil if unknown
+	iter    bool         // scope is an iteration, so @index, @key, @first and @last are set
+	keyType reflect.Type // type of @key
+}
+
+// checker implements the Visitor interface to check a template against a context type
+type checker struct {
+	helpers  map[string]*Helper
+	partials map[string]*Template
+
+	scopes      []checkScope
+	blockParams []map[string]reflect.Type
+
+	// partials being checked, to stop on recursive partials
+	partialsStack []string
+	checking      map[*Template]map[reflect.Type]bool
+
+	problems []*CheckProblem
+	seen     map[string]bool
+}
+
+func newChecker(tpl *Template, typ reflect.Type) *checker {
+	return &checker{
+		helpers:  evaluatorHelpers(tpl.helpers),
+		partials: tpl.partials,
+		scopes:   []checkScope{{typ: knownType(typ)}},
+		checking: make(map[*Template]map[reflect.Type]bool),
+		seen:     make(map[string]bool),
+	}
+}
+
+// problem records a problem at given node
+func (v *checker) problem(node ast.Node, format string, args ...interface{}) {
+	p := &CheckProblem{
+		Loc:     node.Location(),
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	if len(v.partialsStack) > 0 {
+		p.Partial = v.partialsStack[len(v.partialsStack)-1]
+	}
+
+	if key := p.String() + ":" + strconv.Itoa(p.Loc.Pos); !v.seen[key] {
+		v.seen[key] = true
+		v.problems = append(v.problems, p)
+	}
+}
+
+//
+// Scopes
+//
+
+func (v *checker) pushScope(scope checkScope, params map[string]reflect.Type) {
+	v.scopes = append(v.scopes, scope)
+	v.blockParams = append(v.blockParams, params)
+}
+
+func (v *checker) popScope() {
+	v.scopes = v.scopes[:len(v.scopes)-1]
+	v.blockParams = v.blockParams[:len(v.blockParams)-1]
+}
+
+// iterScope returns the nearest iteration scope, or nil if not in an iteration
+func (v *checker) iterScope() *checkScope {
+	for i := len(v.scopes) - 1; i >= 0; i-- {
+		if v.scopes[i].iter {
+			return &v.scopes[i]
+		}
+	}
+	return nil
+}
+
+// blockParam returns type of given block parameter, with a boolean set to false if not found
+func (v *checker) blockParam(name string) (reflect.Type, bool) {
+	for i := len(v.blockParams) - 1; i >= 0; i-- {
+		if typ, ok := v.blockParams[i][name]; ok {
+			return typ, true
+		}
+	}
+	return nil, false
+}
+
+//
+// Types resolution
+//
+
+// knownType returns given type with pointers to pointers collapsed to a single pointer, or nil if values of that
+// type can't be checked statically. The pointer is kept because methods with a pointer receiver can only be called
+// on pointers.
+func knownType(typ reflect.Type) reflect.Type {
+	ptr := false
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		ptr = true
+	}
+
+	if typ == nil || typ.Kind() == reflect.Interface {
+		return nil
+	}
+
+	if ptr {
+		return reflect.PtrTo(typ)
+	}
+
+	return typ
+}
+
+// derefType returns the type pointed to by given type, or given type if it is not a pointer
+func derefType(typ reflect.Type) reflect.Type {
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	return typ
+}
+
+// memberType returns the type of given field of given type, mirroring evaluator.evalField(), and true if a value of
+// that member is addressable. The addressable argument tells if a value of given type is addressable, ie: it was
+// reached through a pointer or a slice: methods with a pointer receiver are only called on addressable values.
+//
+// Returned type is a function type if field is a method or a function. Last returned value is false if member is not
+// found.
+func memberType(typ reflect.Type, addressable bool, name string) (reflect.Type, bool, bool) {
+	if typ = knownType(typ); typ == nil {
+		return nil, false, true
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		addressable = true
+	}
+
+	// "[foo bar]"" => "foo bar"
+	if (len(name) >= 2) && (name[0] == '[') && (name[len(name)-1] == ']') {
+		name = name[1 : len(name)-1]
+	}
+
+	// method
+	recv := reflect.Zero(typ)
+	if addressable {
+		recv = reflect.New(typ)
+	}
+	method := recv.MethodByName(name)
+	if !method.IsValid() {
+		method = recv.MethodByName(strings.Title(name))
+	}
+	if method.IsValid() {
+		return method.Type(), false, true
+	}
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if tField, ok := typ.FieldByName(strings.Title(name)); ok && (tField.PkgPath == "") {
+			return tField.Type, addressable, true
+		}
+
+		for i := 0; i < typ.NumField(); i++ {
+			if tField := typ.Field(i); tField.Tag.Get("handlebars") == name {
+				return tField.Type, addressable, true
+			}
+		}
+	case reflect.Map:
+		if stringType.AssignableTo(typ.Key()) {
+			// map values are never addressable
+			return typ.Elem(), false, true
+		}
+	case reflect.Array:
+		if _, err := strconv.Atoi(name); err == nil {
+			return typ.Elem(), addressable, true
+		}
+	case reflect.Slice:
+		if _, err := strconv.Atoi(name); err == nil {
+			// slice elements are always addressable
+			return typ.Elem(), true, true
+		}
+	}
+
+	return nil, false, false
+}
+
+// elemType returns type of elements iterated by `each` helper or by a section, and type of iteration key
+func elemType(typ reflect.Type) (reflect.Type, reflect.Type) {
+	typ = derefType(typ)
+
+	switch typ.Kind() {
+	case reflect.Array, reflect.Slice:
+		return knownType(typ.Elem()), intType
+	case reflect.Map:
+		return knownType(typ.Elem()), knownType(typ.Key())
+	case reflect.Struct:
+		return nil, stringType
+	}
+	return nil, nil
+}
+
+// isIterable returns true if a section on given type iterates
+func isIterable(typ reflect.Type) bool {
+	typ = derefType(typ)
+	return typ != nil && (typ.Kind() == reflect.Array || typ.Kind() == reflect.Slice)
+}
+
+// checkArity checks that function with given type can be called with given number of params
+func (v *checker) checkArity(node ast.Node, name string, fnType reflect.Type, nbParams int) {
+	numIn := fnType.NumIn()
+
+	if numIn == nbParams {
+		return
+	}
+
+	if (numIn == nbParams+1) && optionsType.AssignableTo(fnType.In(numIn-1)) {
+		return
+	}
+
+	v.problem(node, "Helper '%s' called with wrong number of arguments, needed %d but got %d", name, numIn, nbParams)
+}
+
+// funcResult returns type of value returned by given function type
+func funcResult(fnType reflect.Type) reflect.Type {
+	if fnType.NumOut() == 0 {
+		return nil
+	}
+	return knownType(fnType.Out(0))
+}
+
+// resolveParts resolves path parts from given type, and returns resolved type with the index of the first unresolved part, or -1
+func (v *checker) resolveParts(typ reflect.Type, parts []string, node ast.Node, nbParams int) (reflect.Type, int) {
+	// contexts are pushed as interfaces, so only pointers are addressable
+	addressable := false
+
+	for i, part := range parts {
+		if typ == nil {
+			return nil, -1
+		}
+
+		member, memberAddressable, ok := memberType(typ, addressable, part)
+		if !ok {
+			return nil, i
+		}
+		addressable = memberAddressable
+
+		if member != nil && member.Kind() == reflect.Func {
+			if i == len(parts)-1 {
+				v.checkArity(node, part, member, nbParams)
+			} else {
+				v.checkArity(node, part, member, 0)
+			}
+			member = funcResult(member)
+		}
+
+		typ = knownType(member)
+	}
+
+	return typ, -1
+}
+
+// resolveInScope resolves path parts in given scope type, mirroring evaluator.evalCtxPath()
+func (v *checker) resolveInScope(typ reflect.Type, parts []string, node ast.Node, nbParams int) (reflect.Type, int) {
+	if isIterable(typ) && len(parts) > 0 {
+		if _, err := strconv.Atoi(parts[0]); err != nil {
+			// array context
+			if _, failed := v.resolveParts(derefType(typ).Elem(), parts, node, nbParams); failed != -1 {
+				return nil, failed
+			}
+			return nil, -1
+		}
+	}
+
+	return v.resolveParts(typ, parts, node, nbParams)
+}
+
+// resolvePath returns the type of given path expression, reporting a problem if it can't be resolved
+func (v *checker) resolvePath(node *ast.PathExpression, nbParams int) reflect.Type {
+	// block parameter
+	if !node.Data && (node.Depth == 0) && (len(node.Parts) > 0) {
+		if typ, ok := v.blockParam(node.Parts[0]); ok {
+			return v.resolveOrReport(node, typ, node.Parts[1:], nbParams)
+		}
+	}
+
+	if node.Data {
+		if node.IsDataRoot() {
+			return v.resolveOrReport(node, v.scopes[0].typ, node.Parts[1:], nbParams)
+		}
+
+		if iter := v.iterScope(); iter != nil && len(node.Parts) == 1 {
+			switch node.Parts[0] {
+			case "index":
+				return intType
+			case "key":
+				return iter.keyType
+			case "first", "last":
+				return boolType
+			}
+		}
+
+		// private data can't be checked statically
+		return nil
+	}
+
+	// contexts stack
+	for depth := node.Depth; depth < len(v.scopes); depth++ {
+		scope := v.scopes[len(v.scopes)-1-depth]
+
+		if len(node.Parts) == 0 {
+			return scope.typ
+		}
+
+		typ, failed := v.resolveInScope(scope.typ, node.Parts, node, nbParams)
+		if failed == -1 {
+			return typ
+		}
+
+		if failed > 0 {
+			// first part resolved, so we must not try with parent context
+			v.problem(node, "Unresolvable path: %s", node.Original)
+			return nil
+		}
+	}
+
+	if node.Depth >= len(v.scopes) {
+		v.problem(node, "Invalid path depth: %s", node.Original)
+	} else {
+		v.problem(node, "Unresolvable path: %s", node.Original)
+	}
+
+	return nil
+}
+
+// resolveOrReport resolves parts from given type, and reports a problem if that fails
+func (v *checker) resolveOrReport(node *ast.PathExpression, typ reflect.Type, parts []string, nbParams int) reflect.Type {
+	result, failed := v.resolveParts(typ, parts, node, nbParams)
+	if failed != -1 {
+		v.problem(node, "Unresolvable path: %s", node.Original)
+		return nil
+	}
+	return result
+}
+
+// exprType returns the type of value produced by given node
+func (v *checker) exprType(node ast.Node) reflect.Type {
+	typ, _ := node.Accept(v).(reflect.Type)
+	return typ
+}
+
+// checkParams checks expression params and hash, and returns params types
+func (v *checker) checkParams(node *ast.Expression) []reflect.Type {
+	var result []reflect.Type
+
+	for _, param := range node.Params {
+		result = append(result, v.exprType(param))
+	}
+
+	if node.Hash != nil {
+		node.Hash.Accept(v)
+	}
+
+	return result
+}
+
+// helper returns the helper called by given expression, or nil if this is not a helper call
+func (v *checker) helper(node *ast.Expression) *Helper {
+	if name := node.HelperName(); name != "" {
+		return v.helpers[name]
+	}
+	return nil
+}
+
+// checkProgram checks a block program in a new scope
+func (v *checker) checkProgram(program *ast.Program, scope *checkScope, params []reflect.Type) {
+	if program == nil {
+		return
+	}
+
+	blockParams := make(map[string]reflect.Type)
+	for i, name := range program.BlockParams {
+		if i < len(params) {
+			blockParams[name] = params[i]
+		} else {
+			blockParams[name] = nil
+		}
+	}
+
+	if scope == nil {
+		// same context
+		cur := v.scopes[len(v.scopes)-1]
+		scope = &cur
+		scope.iter = false
+	}
+
+	v.pushScope(*scope, blockParams)
+	program.Accept(v)
+	v.popScope()
+}
+
+//
+// Visitor interface
+//
+
+// Statements
+
+// VisitProgram implements corresponding Visitor interface method
+func (v *checker) VisitProgram(w io.Writer, node *ast.Program) error {
+	for _, n := range node.Body {
+		n.Accept(v)
+	}
+	return nil
+}
+
+// VisitMustache implements corresponding Visitor interface method
+func (v *checker) VisitMustache(node *ast.MustacheStatement) interface{} {
+	return node.Expression.Accept(v)
+}
+
+// VisitBlock implements corresponding Visitor interface method
+func (v *checker) VisitBlock(node *ast.BlockStatement) interface{} {
+	expr := node.Expression
+
+	if helper := v.helper(expr); helper != nil {
+		if !helper.anyParams {
+			v.checkArity(expr, expr.HelperName(), helper.Type(), len(expr.Params))
+		}
+		params := v.checkParams(expr)
+
+		var paramType reflect.Type
+		if len(params) > 0 {
+			paramType = params[0]
+		}
+
+		switch expr.HelperName() {
+		case "each":
+			scope := &checkScope{iter: true}
+			if paramType != nil {
+				scope.typ, scope.keyType = elemType(paramType)
+			}
+			v.checkProgram(node.Program, scope, []reflect.Type{scope.typ, scope.keyType})
+		case "with":
+			v.checkProgram(node.Program, &checkScope{typ: paramType}, []reflect.Type{paramType})
+		default:
+			v.checkProgram(node.Program, nil, nil)
+		}
+	} else {
+		typ := v.exprType(expr)
+
+		if isIterable(typ) {
+			elem, key := elemType(typ)
+			v.checkProgram(node.Program, &checkScope{typ: elem, iter: true, keyType: key}, []reflect.Type{elem, key})
+		} else {
+			v.checkProgram(node.Program, &checkScope{typ: typ}, []reflect.Type{typ})
+		}
+	}
+
+	if node.Inverse != nil {
+		node.Inverse.Accept(v)
+	}
+
+	return nil
+}
+
+// VisitPartial implements corresponding Visitor interface method
+func (v *checker) VisitPartial(node *ast.PartialStatement) interface{} {
+	name, ok := ast.HelperNameStr(node.Name)
+	if !ok {
+		// dynamic partial: check partial name expression only
+		v.exprType(node.Name)
+		return nil
+	}
+
+	partial := v.partials[name]
+	if partial == nil {
+		v.problem(node, "Partial not found: %s", name)
+		return nil
+	}
+
+	scope := v.scopes[len(v.scopes)-1]
+	scope.iter = false
+
+	if len(node.Params) > 0 {
+		scope.typ = v.exprType(node.Params[0])
+	} else if node.Hash != nil {
+		node.Hash.Accept(v)
+		scope.typ = nil
+	}
+
+	// stop on recursive partials
+	if v.checking[partial] == nil {
+		v.checking[partial] = make(map[reflect.Type]bool)
+	}
+	if v.checking[partial][scope.typ] || partial.program == nil {
+		return nil
+	}
+	v.checking[partial][scope.typ] = true
+	defer delete(v.checking[partial], scope.typ)
+
+	v.partialsStack = append(v.partialsStack, name)
+	v.pushScope(scope, nil)
+	partial.program.Accept(v)
+	v.popScope()
+	v.partialsStack = v.partialsStack[:len(v.partialsStack)-1]
+
+	return nil
+}
+
+// VisitContent implements corresponding Visitor interface method
+func (v *checker) VisitContent(node *ast.ContentStatement) interface{} {
+	return nil
+}
+
+// VisitComment implements corresponding Visitor interface method
+func (v *checker) VisitComment(node *ast.CommentStatement) interface{} {
+	return nil
+}
+
+// Expressions
+
+// VisitExpression implements corresponding Visitor interface method
+func (v *checker) VisitExpression(node *ast.Expression) interface{} {
+	if helper := v.helper(node); helper != nil {
+		if !helper.anyParams {
+			v.checkArity(node, node.HelperName(), helper.Type(), len(node.Params))
+		}
+		v.checkParams(node)
+
+		return funcResult(helper.Type())
+	}
+
+	v.checkParams(node)
+
+	if path := node.FieldPath(); path != nil {
+		return v.resolvePath(path, len(node.Params))
+	}
+
+	// literal field lookup can't be checked statically
+	return nil
+}
+
+// VisitSubExpression implements corresponding Visitor interface method
+func (v *checker) VisitSubExpression(node *ast.SubExpression) interface{} {
+	return node.Expression.Accept(v)
+}
+
+// VisitPath implements corresponding Visitor interface method
+func (v *checker) VisitPath(node *ast.PathExpression) interface{} {
+	return v.resolvePath(node, 0)
+}
+
+// Literals
+
+// VisitString implements corresponding Visitor interface method
+func (v *checker) VisitString(node *ast.StringLiteral) interface{} {
+	return stringType
+}
+
+// VisitBoolean implements corresponding Visitor interface method
+func (v *checker) VisitBoolean(node *ast.BooleanLiteral) interface{} {
+	return boolType
+}
+
+// VisitNumber implements corresponding Visitor interface method
+func (v *checker) VisitNumber(node *ast.NumberLiteral) interface{} {
+	return reflect.TypeOf(node.Number())
+}
+
+// VisitUndefined implements corresponding Visitor interface method
+func (v *checker) VisitUndefined(node *ast.UndefinedLiteral) interface{} {
+	return nil
+}
+
+// VisitNull implements corresponding Visitor interface method
+func (v *checker) VisitNull(node *ast.NullLiteral) interface{} {
+	return nil
+}
+
+// Miscellaneous
+
+// VisitHash implements corresponding Visitor interface method
+func (v *checker) VisitHash(node *ast.Hash) interface{} {
+	for _, pair := range node.Pairs {
+		pair.Accept(v)
+	}
+	return nil
+}
+
+// VisitHashPair implements corresponding Visitor interface method
+func (v *checker) VisitHashPair(node *ast.HashPair) interface{} {
+	return node.Val.Accept(v)
+}
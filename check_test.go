@@ -0,0 +1,137 @@
+package mario_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+type checkAuthor struct {
+	FirstName string
+	LastName  string
+	Nick      string `handlebars:"alias"`
+}
+
+func (a checkAuthor) FullName() string {
+	return a.FirstName + " " + a.LastName
+}
+
+type checkComment struct {
+	Author checkAuthor
+	Body   string
+}
+
+// Summary has a pointer receiver: it can only be called on addressable values
+func (c *checkComment) Summary() string {
+	return c.Body
+}
+
+type checkPost struct {
+	Title    string
+	Author   *checkAuthor
+	Comments []checkComment
+	Tags     map[string]string
+	Extra    interface{}
+}
+
+func TestTemplate_CheckAgainst(t *testing.T) {
+	typ := reflect.TypeOf(checkPost{})
+
+	testcases := []struct {
+		template      string
+		partials      map[string]string
+		expectedError string
+	}{
+		{template: `{{title}} {{author.firstName}} {{author.fullName}} {{author.alias}} {{Author.LastName}}`},
+		{template: `{{#each comments}}{{@index}} {{body}} {{author.firstName}} {{../title}}{{/each}}`},
+		{template: `{{#each comments as |comment i|}}{{i}} {{comment.body}}{{/each}}`},
+		{template: `{{#with author}}{{firstName}} {{title}}{{/with}}`},
+		{template: `{{#comments}}{{body}} {{title}}{{/comments}}`},
+		{template: `{{tags.foo}} {{extra.anything.goes}} {{comments.[0].body}} {{@root.title}}`},
+		{template: `{{> header author}}`, partials: map[string]string{"header": `{{fullName}}`}},
+		{
+			template:      `{{titel}}`,
+			expectedError: `Check error on line 1: Unresolvable path: titel`,
+		},
+		{
+			template:      "{{title}}\n{{author.nmae}}",
+			expectedError: `Check error on line 2: Unresolvable path: author.nmae`,
+		},
+		{
+			template:      `{{#each comments}}{{bdy}}{{/each}}{{#with author}}{{../titl}}{{/with}}`,
+			expectedError: "Check error on line 1: Unresolvable path: bdy\nCheck error on line 1: Unresolvable path: ../titl",
+		},
+		{
+			template:      `{{author.fullName "foo"}}`,
+			expectedError: `Check error on line 1: Helper 'fullName' called with wrong number of arguments, needed 0 but got 1`,
+		},
+		{
+			template:      `{{#with author title "foo"}}{{/with}}`,
+			expectedError: `Check error on line 1: Helper 'with' called with wrong number of arguments, needed 2 but got 3`,
+		},
+		{
+			template:      `{{> header}}{{> footer}}`,
+			partials:      map[string]string{"header": `{{fullName}}`},
+			expectedError: "Check error in partial header on line 1: Unresolvable path: fullName\nCheck error on line 1: Partial not found: footer",
+		},
+	}
+
+	for i, tt := range testcases {
+		tpl := mario.Must(mario.New().Parse(tt.template))
+		for name, source := range tt.partials {
+			tpl.WithPartial(name, mario.Must(mario.New().Parse(source)))
+		}
+
+		err := tpl.CheckAgainst(typ)
+		if tt.expectedError == "" {
+			require.NoError(t, err, i)
+		} else {
+			require.EqualError(t, err, tt.expectedError, i)
+		}
+	}
+}
+
+func TestTemplate_CheckAgainst_PointerReceiver(t *testing.T) {
+	post := checkPost{Comments: []checkComment{{Body: "foo"}}}
+
+	testcases := []struct {
+		template      string
+		ctx           interface{}
+		expected      string
+		expectedError string
+	}{
+		// slice elements are addressable
+		{template: `{{comments.[0].summary}}`, ctx: post, expected: "foo"},
+		// pushed contexts are not
+		{
+			template:      `{{#each comments}}{{summary}}{{/each}}`,
+			ctx:           post,
+			expectedError: `Check error on line 1: Unresolvable path: summary`,
+		},
+		{
+			template:      `{{summary}}`,
+			ctx:           checkComment{Body: "foo"},
+			expectedError: `Check error on line 1: Unresolvable path: summary`,
+		},
+		{template: `{{summary}}`, ctx: &checkComment{Body: "foo"}, expected: "foo"},
+	}
+
+	for i, tt := range testcases {
+		tpl := mario.Must(mario.New().Parse(tt.template))
+
+		err := tpl.CheckAgainst(reflect.TypeOf(tt.ctx))
+		if tt.expectedError != "" {
+			require.EqualError(t, err, tt.expectedError, i)
+		} else {
+			require.NoError(t, err, i)
+		}
+
+		// checker mirrors evaluation
+		var b strings.Builder
+		require.NoError(t, tpl.Execute(&b, tt.ctx), i)
+		require.Equal(t, tt.expected, b.String(), i)
+	}
+}
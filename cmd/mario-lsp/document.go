@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/imantung/mario/ast"
+	"github.com/imantung/mario/lexer"
+	"github.com/imantung/mario/parser"
+)
+
+// reference is a helper or partial name referenced in a document
+type reference struct {
+	name  string
+	start int // byte offset
+	end   int // byte offset
+}
+
+// document is an opened handlebars template
+type document struct {
+	uri  string
+	text string
+
+	// byte offset of each line start
+	lines []int
+
+	program   *ast.Program
+	parseErrs []*parser.Error
+
+	helpers  []reference
+	partials []reference
+}
+
+// newDocument parses given text and collects its references
+func newDocument(uri string, text string) *document {
+	result := &document{
+		uri:   uri,
+		text:  text,
+		lines: []int{0},
+	}
+
+	for i, c := range text {
+		if c == '\n' {
+			result.lines = append(result.lines, i+1)
+		}
+	}
+
+	// all syntax errors are reported, and references are collected from the partial AST
+	result.program, result.parseErrs = parser.ParseWithRecovery(text, parser.Options{})
+	if result.program != nil {
+		result.collectReferences()
+	}
+
+	return result
+}
+
+//
+// Positions
+//
+
+// position converts a byte offset to a LSP position
+func (doc *document) position(offset int) Position {
+	if offset > len(doc.text) {
+		offset = len(doc.text)
+	}
+
+	line := sort.Search(len(doc.lines), func(i int) bool { return doc.lines[i] > offset }) - 1
+
+	return Position{
+		Line:      line,
+		Character: utf16Len(doc.text[doc.lines[line]:offset]),
+	}
+}
+
+// offset converts a LSP position to a byte offset
+func (doc *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(doc.lines) {
+		return len(doc.text)
+	}
+
+	offset := doc.lines[pos.Line]
+	for units := 0; units < pos.Character && offset < len(doc.text); {
+		r, w := utf8.DecodeRuneInString(doc.text[offset:])
+		if r == '\n' {
+			break
+		}
+
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+		offset += w
+	}
+
+	return offset
+}
+
+// rangeOf converts byte offsets to a LSP range
+func (doc *document) rangeOf(start int, end int) Range {
+	return Range{doc.position(start), doc.position(end)}
+}
+
+// lineRange returns range of given zero-based line
+func (doc *document) lineRange(line int) Range {
+	if line >= len(doc.lines) {
+		line = len(doc.lines) - 1
+	}
+
+	end := len(doc.text)
+	if line+1 < len(doc.lines) {
+		end = doc.lines[line+1] - 1
+	}
+
+	return doc.rangeOf(doc.lines[line], end)
+}
+
+// utf16Len returns the number of UTF-16 code units of given string
+func utf16Len(s string) int {
+	result := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			result += 2
+		} else {
+			result++
+		}
+	}
+	return result
+}
+
+//
+// Diagnostics
+//
+
+// diagnostics returns parse errors and lint warnings
+func (doc *document) diagnostics(helpers map[string]string, partials map[string]string) []Diagnostic {
+	result := []Diagnostic{}
+
+	for _, err := range doc.parseErrs {
+		diagnostic := Diagnostic{
+			Range:    doc.lineRange(err.Loc.Line - 1),
+			Severity: severityError,
+			Source:   "mario",
+			Message:  err.Message,
+		}
+
+		if err.Open != nil {
+			// unclosed block is reported at its open tag
+			diagnostic.Range = doc.lineRange(err.Open.Line - 1)
+			diagnostic.RelatedInformation = []DiagnosticRelatedInformation{{
+				Location: Location{URI: doc.uri, Range: doc.rangeOf(err.Loc.Pos, err.Loc.Pos)},
+				Message:  "Expected close tag",
+			}}
+		}
+
+		result = append(result, diagnostic)
+	}
+
+	for _, ref := range doc.helpers {
+		if _, ok := helpers[ref.name]; !ok {
+			result = append(result, Diagnostic{
+				Range:    doc.rangeOf(ref.start, ref.end),
+				Severity: severityWarning,
+				Source:   "mario",
+				Message:  fmt.Sprintf("Unknown helper: %s", ref.name),
+			})
+		}
+	}
+
+	if partials != nil {
+		for _, ref := range doc.partials {
+			if _, ok := partials[ref.name]; !ok {
+				result = append(result, Diagnostic{
+					Range:    doc.rangeOf(ref.start, ref.end),
+					Severity: severityWarning,
+					Source:   "mario",
+					Message:  fmt.Sprintf("Partial not found: %s", ref.name),
+				})
+			}
+		}
+	}
+
+	return result
+}
+
+// partialAt returns partial reference at given offset, or nil
+func (doc *document) partialAt(offset int) *reference {
+	for i, ref := range doc.partials {
+		if ref.start <= offset && offset <= ref.end {
+			return &doc.partials[i]
+		}
+	}
+	return nil
+}
+
+// wordAt returns identifier at given offset, with its range
+func (doc *document) wordAt(offset int) (string, int, int) {
+	isIDChar := func(c byte) bool {
+		return !strings.ContainsRune(" \n\t\r!\"#%&'()*+,./;<=>@[\\]^`{|}~", rune(c))
+	}
+
+	start, end := offset, offset
+	for start > 0 && isIDChar(doc.text[start-1]) {
+		start--
+	}
+	for end < len(doc.text) && isIDChar(doc.text[end]) {
+		end++
+	}
+
+	return doc.text[start:end], start, end
+}
+
+//
+// Symbols
+//
+
+// symbols returns blocks as nested symbols
+func (doc *document) symbols() []DocumentSymbol {
+	type openBlock struct {
+		symbol DocumentSymbol
+		start  int
+	}
+
+	var stack []*openBlock
+	result := []DocumentSymbol{}
+
+	closeBlock := func(end int) {
+		block := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		block.symbol.Range = doc.rangeOf(block.start, end)
+
+		if len(stack) > 0 {
+			parent := &stack[len(stack)-1].symbol
+			parent.Children = append(parent.Children, block.symbol)
+		} else {
+			result = append(result, block.symbol)
+		}
+	}
+
+	tokens := lexer.Collect(doc.text)
+
+	for i, tok := range tokens {
+		switch tok.Kind {
+		case lexer.TokenOpenBlock, lexer.TokenOpenInverse, lexer.TokenOpenRawBlock:
+			if i+1 >= len(tokens) {
+				break
+			}
+
+			name := tokens[i+1]
+			detail := "block"
+			if tok.Kind == lexer.TokenOpenInverse {
+				detail = "inverse block"
+			} else if tok.Kind == lexer.TokenOpenRawBlock {
+				detail = "raw block"
+			}
+
+			stack = append(stack, &openBlock{
+				symbol: DocumentSymbol{
+					Name:           name.Val,
+					Detail:         detail,
+					Kind:           symbolKindNamespace,
+					SelectionRange: doc.rangeOf(name.Pos, name.Pos+len(name.Val)),
+				},
+				start: tok.Pos,
+			})
+		case lexer.TokenOpenEndBlock, lexer.TokenOpenEndRawBlock:
+			if len(stack) == 0 {
+				break
+			}
+
+			end := len(doc.text)
+			for _, next := range tokens[i+1:] {
+				if next.Kind == lexer.TokenClose || next.Kind == lexer.TokenCloseRawBlock {
+					end = next.Pos + len(next.Val)
+					break
+				}
+			}
+
+			closeBlock(end)
+		}
+	}
+
+	// unclosed blocks
+	for len(stack) > 0 {
+		closeBlock(len(doc.text))
+	}
+
+	return result
+}
+
+//
+// References
+//
+
+// collectReferences collects helpers and partials references in document program
+func (doc *document) collectReferences() {
+	ast.Inspect(doc.program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.PartialStatement:
+			if name, ok := ast.HelperNameStr(n.Name); ok {
+				doc.partials = append(doc.partials, pathReference(n.Name, name))
+			}
+
+		case *ast.Expression:
+			// only expressions with params or hash are for sure helper calls
+			if name := n.HelperName(); name != "" && (len(n.Params) > 0 || n.Hash != nil) {
+				doc.helpers = append(doc.helpers, pathReference(n.Path, name))
+			}
+		}
+
+		return true
+	})
+}
+
+// pathReference returns a reference to given path node
+func pathReference(node ast.Node, name string) reference {
+	start := node.Location().Pos
+	end := start + len(name)
+
+	if path, ok := node.(*ast.PathExpression); ok {
+		end = start + len(path.Original)
+	}
+
+	return reference{name: name, start: start, end: end}
+}
@@ -0,0 +1,19 @@
+// Command mario-lsp is a Language Server Protocol server for handlebars templates.
+//
+// It talks JSON-RPC on stdin/stdout, and provides diagnostics, completion, go-to-definition of partials, hover
+// documentation of helpers and document symbols of blocks.
+package main
+
+import (
+	"log"
+	"os"
+)
+
+func main() {
+	log.SetOutput(os.Stderr)
+	log.SetPrefix("mario-lsp: ")
+
+	if err := newServer(os.Stdin, os.Stdout).run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/imantung/mario"
+)
+
+// buildinHelpersDoc documents build-in helpers
+var buildinHelpersDoc = map[string]string{
+	"if":     "`{{#if conditional}}...{{else}}...{{/if}}`\n\nRenders block if conditional is truthy, else renders inverse block. Use `includeZero=true` to consider `0` as truthy.",
+	"unless": "`{{#unless conditional}}...{{/unless}}`\n\nInverse of the `if` helper: renders block if conditional is falsy.",
+	"with":   "`{{#with context}}...{{/with}}`\n\nRenders block with given context.",
+	"each":   "`{{#each list}}...{{/each}}`\n\nIterates over an array, a slice, a map or a struct. Sets `@index`, `@key`, `@first` and `@last`.",
+	"log":    "`{{log message}}`\n\nLogs message while rendering template.",
+	"lookup": "`{{lookup obj field}}`\n\nResolves field of given object dynamically.",
+	"equal":  "`{{#equal a b}}...{{/equal}}`\n\nRenders block if string representations of both arguments are equal.",
+}
+
+var (
+	rCompletePartial = regexp.MustCompile(`\{\{~?>\s*[^\s}]*$`)
+	rCompleteHelper  = regexp.MustCompile(`(\{\{~?[#^&{]?|\()\s*[^\s}()]*$`)
+)
+
+// server is a Language Server Protocol server
+type server struct {
+	conn *conn
+
+	// opened documents
+	docs map[string]*document
+
+	// known helpers names, with documentation
+	helpers map[string]string
+
+	// partials names found in workspace, with their uri, nil if there is no workspace
+	partials map[string]string
+
+	// partials files extensions
+	extensions []string
+
+	shutdown bool
+}
+
+func newServer(r io.Reader, w io.Writer) *server {
+	result := &server{
+		conn:       newConn(r, w),
+		docs:       make(map[string]*document),
+		helpers:    make(map[string]string),
+		extensions: []string{".hbs", ".handlebars"},
+	}
+
+	for _, name := range mario.HelperNames() {
+		result.helpers[name] = buildinHelpersDoc[name]
+	}
+
+	return result
+}
+
+// run handles messages until exit notification, or end of input
+func (s *server) run() error {
+	for {
+		msg, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if rerr, ok := err.(*responseError); ok {
+				// invalid JSON
+				if err := s.conn.reply(nil, nil, rerr); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("Exit notification received before shutdown request")
+			}
+			return nil
+		}
+
+		result, err := s.handle(msg)
+		if msg.ID != nil {
+			if err := s.conn.reply(msg.ID, result, err); err != nil {
+				return err
+			}
+		} else if err != nil {
+			log.Printf("%s: %s", msg.Method, err)
+		}
+	}
+}
+
+// handle dispatches message to the corresponding handler
+func (s *server) handle(msg *message) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.initialize(&params), nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.update(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(&params), nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(&params), nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(&params), nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, err
+		}
+		if doc := s.docs[params.TextDocument.URI]; doc != nil {
+			return doc.symbols(), nil
+		}
+		return nil, nil
+	}
+
+	if msg.ID == nil {
+		// ignore unknown notifications
+		return nil, nil
+	}
+
+	return nil, &responseError{codeMethodNotFound, "Method not found: " + msg.Method}
+}
+
+// initialize configures server and scans workspace for partials
+func (s *server) initialize(params *InitializeParams) *InitializeResult {
+	if opts := params.InitializationOptions; opts != nil {
+		for name, doc := range opts.Helpers {
+			s.helpers[name] = doc
+		}
+
+		if len(opts.Extensions) > 0 {
+			s.extensions = opts.Extensions
+		}
+	}
+
+	if params.RootURI != "" {
+		s.scanWorkspace(uriToPath(params.RootURI))
+	}
+
+	return &InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       textDocumentSyncFull,
+			CompletionProvider:     &CompletionOptions{TriggerCharacters: []string{"{", ">", "#", "("}},
+			HoverProvider:          true,
+			DefinitionProvider:     true,
+			DocumentSymbolProvider: true,
+		},
+		ServerInfo: ServerInfo{Name: "mario-lsp"},
+	}
+}
+
+// scanWorkspace registers all templates files of given directory as partials
+func (s *server) scanWorkspace(root string) {
+	s.partials = make(map[string]string)
+
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !s.isTemplateFile(path) {
+			return nil
+		}
+
+		s.addPartial(root, path)
+
+		return nil
+	})
+}
+
+// isTemplateFile returns true if given path has a template extension
+func (s *server) isTemplateFile(path string) bool {
+	for _, ext := range s.extensions {
+		if strings.HasSuffix(path, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPartial registers file as a partial, both with its base name and its path relative to root, without extension
+func (s *server) addPartial(root string, path string) {
+	uri := pathToURI(path)
+	ext := filepath.Ext(path)
+
+	s.partials[strings.TrimSuffix(filepath.Base(path), ext)] = uri
+
+	if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		s.partials[filepath.ToSlash(strings.TrimSuffix(rel, ext))] = uri
+	}
+}
+
+// update parses document and publishes its diagnostics
+func (s *server) update(uri string, text string) error {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+
+	return s.conn.notify("textDocument/publishDiagnostics", &PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: doc.diagnostics(s.helpers, s.partials),
+	})
+}
+
+// completion proposes helpers or partials names
+func (s *server) completion(params *TextDocumentPositionParams) []CompletionItem {
+	result := []CompletionItem{}
+
+	doc := s.docs[params.TextDocument.URI]
+	if doc == nil {
+		return result
+	}
+
+	offset := doc.offset(params.Position)
+	before := doc.text[doc.lines[doc.position(offset).Line]:offset]
+
+	if rCompletePartial.MatchString(before) {
+		for _, name := range sortedNames(s.partials) {
+			result = append(result, CompletionItem{Label: name, Kind: completionKindFile})
+		}
+	} else if rCompleteHelper.MatchString(before) {
+		for _, name := range sortedNames(s.helpers) {
+			item := CompletionItem{Label: name, Kind: completionKindFunction}
+			if doc := s.helpers[name]; doc != "" {
+				item.Documentation = &MarkupContent{Kind: "markdown", Value: doc}
+			}
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// hover returns documentation of helper under cursor
+func (s *server) hover(params *TextDocumentPositionParams) *Hover {
+	doc := s.docs[params.TextDocument.URI]
+	if doc == nil {
+		return nil
+	}
+
+	word, start, end := doc.wordAt(doc.offset(params.Position))
+
+	help, ok := s.helpers[word]
+	if !ok {
+		return nil
+	}
+
+	if help == "" {
+		help = "`" + word + "` helper"
+	}
+
+	r := doc.rangeOf(start, end)
+
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: help},
+		Range:    &r,
+	}
+}
+
+// definition returns location of partial under cursor
+func (s *server) definition(params *TextDocumentPositionParams) *Location {
+	doc := s.docs[params.TextDocument.URI]
+	if doc == nil {
+		return nil
+	}
+
+	ref := doc.partialAt(doc.offset(params.Position))
+	if ref == nil {
+		return nil
+	}
+
+	uri, ok := s.partials[ref.name]
+	if !ok {
+		return nil
+	}
+
+	return &Location{URI: uri}
+}
+
+// sortedNames returns sorted keys of given map
+func sortedNames(m map[string]string) []string {
+	var result []string
+	for name := range m {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// uriToPath converts a file uri to a path
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// pathToURI converts a path to a file uri
+func pathToURI(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// session runs server on given messages, and returns all messages sent by server
+func session(t *testing.T, msgs ...string) []map[string]interface{} {
+	var input bytes.Buffer
+	for _, msg := range msgs {
+		fmt.Fprintf(&input, "Content-Length: %d\r\n\r\n%s", len(msg), msg)
+	}
+
+	var output bytes.Buffer
+	require.NoError(t, newServer(&input, &output).run())
+
+	var result []map[string]interface{}
+
+	c := newConn(&output, nil)
+	for {
+		msg, err := c.read()
+		if err != nil {
+			break
+		}
+
+		raw, err := json.Marshal(msg)
+		require.NoError(t, err)
+
+		decoded := make(map[string]interface{})
+		require.NoError(t, json.Unmarshal(raw, &decoded))
+		result = append(result, decoded)
+	}
+
+	return result
+}
+
+// jsonPath returns value at given dotted path
+func jsonPath(v interface{}, path string) interface{} {
+	for _, part := range strings.Split(path, ".") {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			v = val[part]
+		case []interface{}:
+			var i int
+			fmt.Sscanf(part, "%d", &i)
+			if i >= len(val) {
+				return nil
+			}
+			v = val[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mario-lsp")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "shared"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "shared", "header.hbs"), []byte("<h1>{{title}}</h1>"), 0644))
+
+	rootURI := pathToURI(dir)
+	uri := rootURI + "/page.hbs"
+	text := "{{> header}}\n{{#each items}}\n  {{#if ok}}{{format name}}{{/if}}\n{{/each}}\n{{> footer}}{{"
+
+	msgs := session(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"rootUri":"`+rootURI+`","initializationOptions":{"helpers":{"upper":"Uppercases a string"}}}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"`+uri+`","version":1,"text":`+quote(text)+`}}}`,
+		`{"jsonrpc":"2.0","method":"textDocument/didChange","params":{"textDocument":{"uri":"`+uri+`"},"contentChanges":[{"text":`+quote(text[:len(text)-2])+`}]}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/completion","params":{"textDocument":{"uri":"`+uri+`"},"position":{"line":0,"character":4}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/completion","params":{"textDocument":{"uri":"`+uri+`"},"position":{"line":1,"character":3}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"textDocument/hover","params":{"textDocument":{"uri":"`+uri+`"},"position":{"line":1,"character":5}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"textDocument/definition","params":{"textDocument":{"uri":"`+uri+`"},"position":{"line":0,"character":6}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"textDocument/documentSymbol","params":{"textDocument":{"uri":"`+uri+`"}}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"foo/bar","params":{}}`,
+		`{"jsonrpc":"2.0","id":8,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	require.Len(t, msgs, 10)
+
+	// initialize
+	require.Equal(t, true, jsonPath(msgs[0], "result.capabilities.hoverProvider"))
+
+	// didOpen: parse error
+	require.Equal(t, "textDocument/publishDiagnostics", msgs[1]["method"])
+	require.Equal(t, 1.0, jsonPath(msgs[1], "params.diagnostics.0.severity"))
+	require.Equal(t, 4.0, jsonPath(msgs[1], "params.diagnostics.0.range.start.line"))
+
+	// didChange: lint warnings
+	require.Equal(t, "Unknown helper: format", jsonPath(msgs[2], "params.diagnostics.0.message"))
+	require.Equal(t, 2.0, jsonPath(msgs[2], "params.diagnostics.0.range.start.line"))
+	require.Equal(t, 14.0, jsonPath(msgs[2], "params.diagnostics.0.range.start.character"))
+	require.Equal(t, "Partial not found: footer", jsonPath(msgs[2], "params.diagnostics.1.message"))
+
+	// completion of partials
+	require.Equal(t, "header", jsonPath(msgs[3], "result.0.label"))
+	require.Equal(t, "shared/header", jsonPath(msgs[3], "result.1.label"))
+
+	// completion of helpers
+	var labels []string
+	for _, item := range msgs[4]["result"].([]interface{}) {
+		labels = append(labels, item.(map[string]interface{})["label"].(string))
+	}
+	require.Equal(t, []string{"each", "equal", "if", "log", "lookup", "unless", "upper", "with"}, labels)
+
+	// hover
+	require.Contains(t, jsonPath(msgs[5], "result.contents.value"), "Iterates over")
+
+	// definition
+	require.Equal(t, rootURI+"/shared/header.hbs", jsonPath(msgs[6], "result.uri"))
+
+	// symbols
+	require.Equal(t, "each", jsonPath(msgs[7], "result.0.name"))
+	require.Equal(t, 3.0, jsonPath(msgs[7], "result.0.range.end.line"))
+	require.Equal(t, "if", jsonPath(msgs[7], "result.0.children.0.name"))
+
+	// unknown method
+	require.Equal(t, -32601.0, jsonPath(msgs[8], "error.code"))
+
+	// shutdown
+	require.Nil(t, msgs[9]["result"])
+	require.Equal(t, 8.0, msgs[9]["id"])
+}
+
+func TestDocument_Diagnostics(t *testing.T) {
+	doc := newDocument("file:///page.hbs", "{{#each items}}\n  {{foo bar=}}\n  {{baz %}}\n  {{format name}}")
+
+	diagnostics := doc.diagnostics(map[string]string{"each": ""}, nil)
+	require.Len(t, diagnostics, 4)
+
+	// all syntax errors
+	require.Equal(t, severityError, diagnostics[0].Severity)
+	require.Equal(t, 1, diagnostics[0].Range.Start.Line)
+	require.Equal(t, severityError, diagnostics[1].Severity)
+	require.Equal(t, 2, diagnostics[1].Range.Start.Line)
+
+	// unclosed block, with expected close tag position
+	require.Contains(t, diagnostics[2].Message, "to close block 'each' opened on line 1")
+	require.Equal(t, 0, diagnostics[2].Range.Start.Line)
+	require.Len(t, diagnostics[2].RelatedInformation, 1)
+	require.Equal(t, Position{Line: 3, Character: 17}, diagnostics[2].RelatedInformation[0].Location.Range.Start)
+
+	// lint warnings of partial AST
+	require.Equal(t, severityWarning, diagnostics[3].Severity)
+	require.Equal(t, "Unknown helper: format", diagnostics[3].Message)
+}
+
+func TestServer_ExitWithoutShutdown(t *testing.T) {
+	msg := `{"jsonrpc":"2.0","method":"exit"}`
+	input := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(msg), msg))
+
+	require.Error(t, newServer(input, ioutil.Discard).run())
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
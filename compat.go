@@ -0,0 +1,56 @@
+package mario
+
+import (
+	"reflect"
+
+	"github.com/imantung/mario/ast"
+)
+
+// WithCompat enables the handlebars.js `compat` mode, where context paths are resolved with recursive lookup.
+//
+// In that mode, the first part of a path that is not scoped (`this.`, `./`) and has no depth (`../`) is looked up in
+// current context, then in each parent context up to the root one, until a non-nil value is found. Remaining parts are
+// resolved with that value only. Helpers parameters are resolved the same way, and the mode of the executed template
+// applies to its partials.
+//
+// For example, `{{#each users}}{{company.name}}{{/each}}` renders the root `company.name` for each user that has no
+// `company` field.
+func (tpl *Template) WithCompat() *Template {
+	tpl.compat = true
+	return tpl
+}
+
+// evalCompatPath evaluates a context path expression in compat mode
+func (v *evaluator) evalCompatPath(node *ast.PathExpression, exprRoot bool) interface{} {
+	if node.Scoped || (node.Depth > 0) || (len(node.Parts) == 0) {
+		ctx := v.ancestorCtx(node.Depth)
+
+		v.beginAttempt("context", node.Depth, ctx)
+		value, _ := v.evalPath(ctx, node.Parts, exprRoot)
+		return compatResult(value)
+	}
+
+	for depth := 0; depth < len(v.ctx); depth++ {
+		ctx := v.ancestorCtx(depth)
+
+		v.beginAttempt("context", depth, ctx)
+		value, _ := v.evalPath(ctx, node.Parts[:1], exprRoot)
+		if _, isNil := indirect(value); !value.IsValid() || isNil {
+			continue
+		}
+
+		// first part found: don't look up remaining parts in parent contexts
+		value, _ = v.evalPath(value, node.Parts[1:], exprRoot)
+		return compatResult(value)
+	}
+
+	return nil
+}
+
+// compatResult returns the interface of given resolved value, or nil if it was not resolved
+func compatResult(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+	return value.Interface()
+}
@@ -0,0 +1,46 @@
+package mario_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompat(t *testing.T) {
+	ctx := map[string]interface{}{
+		"foo":  "root",
+		"omg":  map[string]string{"yes": "OMG!"},
+		"a":    map[string]interface{}{"b": map[string]string{"x": "y"}, "omg": nil},
+		"list": []map[string]string{{"name": "Mario"}, {"foo": "item"}},
+	}
+
+	for _, test := range []struct {
+		source   string
+		compat   string
+		standard string
+	}{
+		{`{{#with a}}{{#with b}}{{foo}}{{/with}}{{/with}}`, "root", "root"},
+		{`{{#each list}}{{foo}},{{/each}}`, "root,item,", "root,item,"},
+		{`{{#with a}}{{echo foo}}{{/with}}`, "root", "root"},
+		{`{{#with a}}{{this.foo}}|{{./foo}}{{/with}}`, "|", "root|root"},
+		{`{{#with a}}{{#with b}}{{../foo}}{{/with}}{{/with}}`, "", "root"},
+		{`{{#with a}}{{omg.yes}}{{/with}}`, "OMG!", ""},
+	} {
+		for _, compat := range []bool{true, false} {
+			tpl := mario.New()
+			expected := test.standard
+			if compat {
+				tpl.WithCompat()
+				expected = test.compat
+			}
+
+			tpl = mario.Must(tpl.Parse(test.source)).WithHelperFunc("echo", func(s string) string { return s })
+
+			var b strings.Builder
+			require.NoError(t, tpl.Execute(&b, ctx), test.source)
+			require.Equal(t, expected, b.String(), "%s (compat: %t)", test.source, compat)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import "reflect"
 type DataFrame struct {
 	parent *DataFrame
 	data   map[string]interface{}
+	log    Logger
 }
 
 // NewDataFrame instanciates a new private data frame.
@@ -47,6 +48,21 @@ func (p *DataFrame) Set(key string, val interface{}) {
 	p.data[key] = val
 }
 
+// SetLogger sets the logger used by the log helper, for executions with that data frame.
+func (p *DataFrame) SetLogger(logger Logger) {
+	p.log = logger
+}
+
+// logger returns the logger set on data frame or its parents, or nil
+func (p *DataFrame) logger() Logger {
+	for f := p; f != nil; f = f.parent {
+		if f.log != nil {
+			return f.log
+		}
+	}
+	return nil
+}
+
 // Get gets a data value.
 func (p *DataFrame) Get(key string) interface{} {
 	return p.find([]string{key})
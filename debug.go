@@ -0,0 +1,325 @@
+package mario
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/imantung/mario/ast"
+	"github.com/imantung/mario/parser"
+)
+
+// DebugEventKind represents a DebugEvent type.
+type DebugEventKind int
+
+const (
+	// DebugVisit is sent when a node is visited
+	DebugVisit DebugEventKind = iota
+
+	// DebugPushContext is sent when a context is pushed to the contexts stack
+	DebugPushContext
+
+	// DebugPopContext is sent when a context is popped from the contexts stack
+	DebugPopContext
+
+	// DebugSetDataFrame is sent when a new private data frame is set
+	DebugSetDataFrame
+
+	// DebugPopDataFrame is sent when parent private data frame is set back
+	DebugPopDataFrame
+
+	// DebugHelperCall is sent after a helper call
+	DebugHelperCall
+
+	// DebugLookup is sent after a path lookup
+	DebugLookup
+)
+
+// DebugFunc receives evaluation events.
+type DebugFunc func(*DebugEvent)
+
+// DebugEvent represents an evaluation step.
+type DebugEvent struct {
+	Kind  DebugEventKind
+	Node  ast.Node // current node
+	Depth int      // contexts stack size
+
+	Value  interface{}            // pushed or popped context, data frame values, or helper result
+	Helper string                 // called helper name
+	Params []interface{}          // helper params
+	Hash   map[string]interface{} // helper hash
+	Lookup *Lookup                // path lookup explanation
+}
+
+// String returns a string representation of receiver that can be used for debugging.
+func (e *DebugEvent) String() string {
+	indent := strings.Repeat("  ", e.Depth)
+
+	switch e.Kind {
+	case DebugVisit:
+		return fmt.Sprintf("%svisit %s", indent, e.Node)
+	case DebugPushContext:
+		return fmt.Sprintf("%spush context %s", indent, debugValue(e.Value))
+	case DebugPopContext:
+		return fmt.Sprintf("%spop context %s", indent, debugValue(e.Value))
+	case DebugSetDataFrame:
+		return fmt.Sprintf("%sset data frame %s", indent, debugValue(e.Value))
+	case DebugPopDataFrame:
+		return fmt.Sprintf("%spop data frame, back to %s", indent, debugValue(e.Value))
+	case DebugHelperCall:
+		return fmt.Sprintf("%scall helper %s params=%s hash=%s => %s", indent, e.Helper, debugValue(e.Params), debugValue(e.Hash), debugValue(e.Value))
+	case DebugLookup:
+		return indent + strings.Replace(e.Lookup.String(), "\n", "\n"+indent, -1)
+	}
+
+	return fmt.Sprintf("%sevent %d", indent, e.Kind)
+}
+
+// NewDebugLogger returns a DebugFunc that writes all events to given writer, one per line.
+func NewDebugLogger(w io.Writer) DebugFunc {
+	return func(e *DebugEvent) {
+		fmt.Fprintln(w, e.String())
+	}
+}
+
+// debugValue returns a short representation of given value
+func debugValue(value interface{}) string {
+	if value == nil {
+		return "nil"
+	}
+
+	result := fmt.Sprintf("(%T) %+v", value, value)
+	if len(result) > 100 {
+		result = result[:97] + "..."
+	}
+
+	return result
+}
+
+//
+// Lookups
+//
+
+// Lookup explains how a path was resolved.
+type Lookup struct {
+	Path       string           // path as written in template
+	BlockParam string           // block parameter name, if path starts with a block parameter
+	Attempts   []*LookupAttempt // all tries, in order
+	Found      bool             // path was resolved to a non nil value
+	Value      interface{}      // resolved value
+}
+
+// LookupAttempt is a try to resolve a path against one context.
+type LookupAttempt struct {
+	Source   string // "context", "@root" or "data"
+	Depth    int    // context depth for "context" source, data frame depth for "data" source
+	Context  string // context type
+	Resolved int    // number of path parts resolved
+	Part     string // first unresolved part
+	Reason   string // why part was not resolved, empty on success
+}
+
+// String returns a string representation of receiver.
+func (l *Lookup) String() string {
+	result := fmt.Sprintf("lookup %q: ", l.Path)
+	if l.Found {
+		result += "found " + debugValue(l.Value)
+	} else {
+		result += "not found"
+	}
+
+	if l.BlockParam != "" {
+		result += fmt.Sprintf(" (block parameter %q)", l.BlockParam)
+	}
+
+	for _, attempt := range l.Attempts {
+		result += "\n  " + attempt.String()
+	}
+
+	return result
+}
+
+// String returns a string representation of receiver.
+func (a *LookupAttempt) String() string {
+	result := a.Source
+	if a.Source != "@root" {
+		result += " " + strconv.Itoa(a.Depth)
+	}
+
+	result += " (" + a.Context + "): "
+
+	if a.Reason == "" {
+		return result + "resolved"
+	}
+
+	if a.Part == "" {
+		return result + a.Reason
+	}
+
+	return result + fmt.Sprintf("%d part(s) resolved, %q failed: %s", a.Resolved, a.Part, a.Reason)
+}
+
+// Explain explains how given path expression is resolved against given context.
+func Explain(path string, ctx interface{}) (result *Lookup, err error) {
+	defer errRecover(&err)
+
+	program, err := parser.Parse("{{" + path + "}}")
+	if err != nil {
+		return nil, err
+	}
+
+	var node *ast.PathExpression
+	if len(program.Body) == 1 {
+		if mustache, ok := program.Body[0].(*ast.MustacheStatement); ok && len(mustache.Expression.Params) == 0 && mustache.Expression.Hash == nil {
+			node = mustache.Expression.FieldPath()
+		}
+	}
+
+	if node == nil {
+		return nil, fmt.Errorf("Not a path expression: %s", path)
+	}
+
+	eval := createEvaluator(New(), ctx, NewDataFrame())
+	eval.debug = func(e *DebugEvent) {
+		if e.Kind == DebugLookup && e.Node == node {
+			result = e.Lookup
+		}
+	}
+
+	eval.evalPathExpression(node, false)
+
+	return result, nil
+}
+
+// beginLookup starts recording a lookup of given path
+func (v *evaluator) beginLookup(node *ast.PathExpression) {
+	v.lookups = append(v.lookups, &Lookup{Path: node.Original})
+}
+
+// endLookup stops recording current lookup, and sends it
+func (v *evaluator) endLookup(node *ast.PathExpression, result interface{}) {
+	lookup := v.lookups[len(v.lookups)-1]
+	v.lookups = v.lookups[:len(v.lookups)-1]
+
+	lookup.Value = result
+	lookup.Found = result != nil
+
+	if !lookup.Found {
+		for _, attempt := range lookup.Attempts {
+			if attempt.Reason == "" {
+				attempt.Resolved = len(node.Parts)
+				attempt.Reason = "value is nil"
+			}
+		}
+	}
+
+	v.debugEvent(&DebugEvent{Kind: DebugLookup, Node: node, Lookup: lookup})
+}
+
+// curLookup returns current lookup, or nil if lookups are not recorded
+func (v *evaluator) curLookup() *Lookup {
+	if len(v.lookups) == 0 {
+		return nil
+	}
+	return v.lookups[len(v.lookups)-1]
+}
+
+// beginAttempt records a new attempt to resolve current lookup in given context
+func (v *evaluator) beginAttempt(source string, depth int, ctx reflect.Value) {
+	if lookup := v.curLookup(); lookup != nil {
+		context := "invalid"
+		if ctx.IsValid() {
+			context = ctx.Type().String()
+		}
+
+		lookup.Attempts = append(lookup.Attempts, &LookupAttempt{
+			Source:  source,
+			Depth:   depth,
+			Context: context,
+		})
+	}
+}
+
+// failAttempt records that current attempt failed to resolve given part, at index i of path, in given context
+func (v *evaluator) failAttempt(ctx reflect.Value, part string, i int) {
+	lookup := v.curLookup()
+	if lookup == nil || len(lookup.Attempts) == 0 {
+		return
+	}
+
+	attempt := lookup.Attempts[len(lookup.Attempts)-1]
+	if attempt.Reason != "" {
+		// array context: only first failure is kept
+		return
+	}
+
+	attempt.Resolved = i
+	attempt.Part = part
+	attempt.Reason = missReason(ctx, part)
+}
+
+// missReason returns why given field can't be resolved in given context
+func missReason(ctx reflect.Value, name string) string {
+	ctx, isNil := indirect(ctx)
+	if !ctx.IsValid() || isNil {
+		return "nil value"
+	}
+
+	switch ctx.Kind() {
+	case reflect.Struct:
+		return fmt.Sprintf("%s has no exported field, method or handlebars tag named %q", ctx.Type(), name)
+	case reflect.Map:
+		nameVal := reflect.ValueOf(name)
+		if !nameVal.Type().AssignableTo(ctx.Type().Key()) {
+			return fmt.Sprintf("%s keys are not strings", ctx.Type())
+		}
+		return fmt.Sprintf("%s has no key %q", ctx.Type(), name)
+	case reflect.Array, reflect.Slice:
+		i, err := strconv.Atoi(name)
+		if err != nil {
+			return fmt.Sprintf("%q is not an index", name)
+		}
+		return fmt.Sprintf("index %d out of range, length is %d", i, ctx.Len())
+	}
+
+	return fmt.Sprintf("%s value has no field %q", ctx.Type(), name)
+}
+
+// debugHelperCall sends a helper call event, if debugging
+func (v *evaluator) debugHelperCall(name string, options *Options, result interface{}) {
+	if v.debug == nil {
+		return
+	}
+
+	v.debugEvent(&DebugEvent{
+		Kind:   DebugHelperCall,
+		Helper: name,
+		Params: options.Params(),
+		Hash:   options.Hash(),
+		Value:  result,
+	})
+}
+
+// debugInterface returns interface of given value, or nil if value is invalid
+func debugInterface(value reflect.Value) interface{} {
+	if !value.IsValid() || !value.CanInterface() {
+		return nil
+	}
+	return value.Interface()
+}
+
+// debugEvent sends given event, if debugging
+func (v *evaluator) debugEvent(e *DebugEvent) {
+	if v.debug == nil {
+		return
+	}
+
+	if e.Node == nil {
+		e.Node = v.curNode
+	}
+	e.Depth = len(v.ctx)
+
+	v.debug(e)
+}
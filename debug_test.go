@@ -0,0 +1,135 @@
+package mario_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+type debugPerson struct {
+	Name    string
+	Friends []debugFriend
+}
+
+type debugFriend struct {
+	Nickname string
+}
+
+func TestExplain(t *testing.T) {
+	ctx := map[string]interface{}{
+		"person": debugPerson{Name: "Mario", Friends: []debugFriend{{Nickname: "Luigi"}}},
+		"title":  nil,
+	}
+
+	lookup, err := mario.Explain("person.name", ctx)
+	require.NoError(t, err)
+	require.True(t, lookup.Found)
+	require.Equal(t, "Mario", lookup.Value)
+	require.Len(t, lookup.Attempts, 1)
+
+	lookup, err = mario.Explain("person.age", ctx)
+	require.NoError(t, err)
+	require.False(t, lookup.Found)
+	require.Len(t, lookup.Attempts, 1)
+	require.Equal(t, "context", lookup.Attempts[0].Source)
+	require.Equal(t, 1, lookup.Attempts[0].Resolved)
+	require.Equal(t, "age", lookup.Attempts[0].Part)
+	require.Equal(t, `mario_test.debugPerson has no exported field, method or handlebars tag named "age"`, lookup.Attempts[0].Reason)
+
+	lookup, err = mario.Explain("person.friends.[3].nickname", ctx)
+	require.NoError(t, err)
+	require.False(t, lookup.Found)
+	require.Equal(t, "index 3 out of range, length is 1", lookup.Attempts[0].Reason)
+
+	lookup, err = mario.Explain("title", ctx)
+	require.NoError(t, err)
+	require.False(t, lookup.Found)
+	require.Equal(t, "value is nil", lookup.Attempts[0].Reason)
+
+	lookup, err = mario.Explain("@root.person.name", ctx)
+	require.NoError(t, err)
+	require.True(t, lookup.Found)
+	require.Equal(t, "@root", lookup.Attempts[0].Source)
+
+	_, err = mario.Explain("foo bar", ctx)
+	require.EqualError(t, err, "Not a path expression: foo bar")
+
+	_, err = mario.Explain("foo}}", ctx)
+	require.Error(t, err)
+}
+
+func TestTemplate_WithDebug(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse("{{#each people}}{{name}}{{upper nickname}}{{/each}}"))
+	tpl.WithHelperFunc("upper", strings.ToUpper)
+
+	var events []*mario.DebugEvent
+	tpl.WithDebug(func(e *mario.DebugEvent) {
+		events = append(events, e)
+	})
+
+	var b strings.Builder
+	err := tpl.Execute(&b, map[string]interface{}{
+		"nickname": "Bros",
+		"people":   []map[string]string{{"name": "Mario"}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "MarioBROS", b.String())
+
+	kinds := make(map[mario.DebugEventKind]int)
+	var lookups []*mario.Lookup
+	var calls []*mario.DebugEvent
+
+	for _, e := range events {
+		kinds[e.Kind]++
+
+		switch e.Kind {
+		case mario.DebugLookup:
+			lookups = append(lookups, e.Lookup)
+		case mario.DebugHelperCall:
+			calls = append(calls, e)
+		}
+	}
+
+	require.Equal(t, 1, kinds[mario.DebugPushContext])
+	require.Equal(t, 1, kinds[mario.DebugPopContext])
+	require.Equal(t, 1, kinds[mario.DebugSetDataFrame])
+	require.Equal(t, 1, kinds[mario.DebugPopDataFrame])
+	require.NotZero(t, kinds[mario.DebugVisit])
+
+	// events are sent after calls, so inner helper comes first
+	require.Len(t, calls, 2)
+	require.Equal(t, "upper", calls[0].Helper)
+	require.Equal(t, []interface{}{"Bros"}, calls[0].Params)
+	require.Equal(t, "BROS", calls[0].Value)
+	require.Equal(t, "each", calls[1].Helper)
+
+	// "nickname" is not found in current context, then found in parent context
+	var nickname *mario.Lookup
+	for _, lookup := range lookups {
+		if lookup.Path == "nickname" {
+			nickname = lookup
+		}
+	}
+	require.NotNil(t, nickname)
+	require.True(t, nickname.Found)
+	require.Len(t, nickname.Attempts, 2)
+	require.Equal(t, 0, nickname.Attempts[0].Depth)
+	require.Equal(t, `map[string]string has no key "nickname"`, nickname.Attempts[0].Reason)
+	require.Equal(t, 1, nickname.Attempts[1].Depth)
+	require.Equal(t, "", nickname.Attempts[1].Reason)
+}
+
+func TestNewDebugLogger(t *testing.T) {
+	var b strings.Builder
+
+	tpl := mario.Must(mario.New().Parse("{{missing}}"))
+	tpl.WithDebug(mario.NewDebugLogger(&b))
+
+	err := tpl.Execute(&strings.Builder{}, map[string]string{"name": "Mario"})
+	require.NoError(t, err)
+
+	require.Contains(t, b.String(), `lookup "missing": not found`)
+	require.Contains(t, b.String(), `context 0 (map[string]string): 0 part(s) resolved, "missing" failed: map[string]string has no key "missing"`)
+}
@@ -18,6 +18,10 @@ var (
 	zero reflect.Value
 )
 
+// MaxPartialDepth is the maximum number of nested partials evaluations, that prevents a recursive partial that never
+// ends from overflowing the stack.
+const MaxPartialDepth = 1000
+
 // evaluator evaluates a handlebars template with context
 type evaluator struct {
 	helpers  map[string]*Helper
@@ -32,27 +36,88 @@ type evaluator struct {
 	// block parameters stack
 	blockParams []map[string]interface{}
 
+	// trackIds mode, with block parameters paths stack
+	trackIds         bool
+	blockParamsPaths []map[string]string
+
+	// stringParams mode
+	stringParams bool
+
+	// handlebars.js compat mode, with recursive context lookup
+	compat bool
+
+	// standalone partials are not indented
+	preventIndent bool
+
+	// number of nested partials being evaluated
+	partialDepth int
+
 	// block statements stack
 	blocks []*ast.BlockStatement
 
 	// expressions stack
 	exprs []*ast.Expression
 
+	// expressions resolved as helper calls or not when parsing current template
+	helperCalls helperCalls
+
 	// memoize expressions that were function calls
 	exprFunc map[*ast.Expression]bool
 
 	// used for info on panic
 	curNode ast.Node
+
+	// records output chunks, when tracing
+	tracer *tracer
+
+	// receives evaluation events, when debugging
+	debug DebugFunc
+
+	// path lookups being recorded, when debugging
+	lookups []*Lookup
+
+	// records helpers, partials and blocks statistics, when profiling
+	profile *profileStack
+
+	// helpers and partials interceptors
+	interceptors interceptors
+
+	// log helper logger and minimum level
+	logger   Logger
+	logLevel LogLevel
+
+	// Mustache compatibility mode
+	mustache bool
+
+	// Mustache inheritance: blocks overridden by parent tags, outermost first
+	overrides []map[string]*ast.Program
 }
 
 // CreateEvaluator to return create new instance of evaluator from template and context
 func createEvaluator(tpl *Template, ctx interface{}, frame *DataFrame) *evaluator {
+	var profile *profileStack
+	if tpl.profiler != nil {
+		profile = newProfileStack(tpl.profiler)
+	}
+
 	return &evaluator{
-		helpers:   evaluatorHelpers(tpl.helpers),
-		partials:  tpl.partials,
-		ctx:       []reflect.Value{reflect.ValueOf(ctx)},
-		dataFrame: frame,
-		exprFunc:  make(map[*ast.Expression]bool),
+		helpers:     evaluatorHelpers(tpl.helpers),
+		partials:    tpl.partials,
+		ctx:         []reflect.Value{reflect.ValueOf(ctx)},
+		dataFrame:   frame,
+		exprFunc:    make(map[*ast.Expression]bool),
+		helperCalls: tpl.helperCalls,
+		debug:       tpl.debug,
+		profile:     profile,
+
+		interceptors:  tpl.interceptors,
+		logger:        tpl.logger,
+		logLevel:      tpl.logLevel,
+		trackIds:      tpl.trackIds,
+		stringParams:  tpl.stringParams,
+		compat:        tpl.compat,
+		preventIndent: tpl.preventIndent,
+		mustache:      tpl.mustache,
 	}
 }
 
@@ -69,7 +134,12 @@ func evaluatorHelpers(h map[string]*Helper) map[string]*Helper {
 
 // at sets current node
 func (v *evaluator) at(node ast.Node) {
+	changed := node != v.curNode
 	v.curNode = node
+
+	if (v.debug != nil) && changed {
+		v.debugEvent(&DebugEvent{Kind: DebugVisit})
+	}
 }
 
 //
@@ -79,6 +149,10 @@ func (v *evaluator) at(node ast.Node) {
 // pushCtx pushes new context to the stack
 func (v *evaluator) pushCtx(ctx reflect.Value) {
 	v.ctx = append(v.ctx, ctx)
+
+	if v.debug != nil {
+		v.debugEvent(&DebugEvent{Kind: DebugPushContext, Value: debugInterface(ctx)})
+	}
 }
 
 // popCtx pops last context from stack
@@ -90,6 +164,10 @@ func (v *evaluator) popCtx() reflect.Value {
 	var result reflect.Value
 	result, v.ctx = v.ctx[len(v.ctx)-1], v.ctx[:len(v.ctx)-1]
 
+	if v.debug != nil {
+		v.debugEvent(&DebugEvent{Kind: DebugPopContext, Value: debugInterface(result)})
+	}
+
 	return result
 }
 
@@ -120,11 +198,19 @@ func (v *evaluator) ancestorCtx(depth int) reflect.Value {
 // setDataFrame sets new data frame
 func (v *evaluator) setDataFrame(frame *DataFrame) {
 	v.dataFrame = frame
+
+	if v.debug != nil {
+		v.debugEvent(&DebugEvent{Kind: DebugSetDataFrame, Value: frame.data})
+	}
 }
 
 // popDataFrame sets back parent data frame
 func (v *evaluator) popDataFrame() {
 	v.dataFrame = v.dataFrame.parent
+
+	if v.debug != nil {
+		v.debugEvent(&DebugEvent{Kind: DebugPopDataFrame, Value: v.dataFrame.data})
+	}
 }
 
 //
@@ -253,6 +339,10 @@ func (v *evaluator) evalProgram(program *ast.Program, ctx interface{}, data *Dat
 	// push contexts
 	if len(blockParams) > 0 {
 		v.pushBlockParams(blockParams)
+
+		if v.trackIds {
+			v.pushBlockParamsPaths(program.BlockParams, data)
+		}
 	}
 
 	ctxVal := reflect.ValueOf(ctx)
@@ -278,6 +368,10 @@ func (v *evaluator) evalProgram(program *ast.Program, ctx interface{}, data *Dat
 
 	if len(blockParams) > 0 {
 		v.popBlockParams()
+
+		if v.trackIds {
+			v.popBlockParamsPaths()
+		}
 	}
 
 	return result
@@ -295,10 +389,12 @@ func (v *evaluator) evalPath(ctx reflect.Value, parts []string, exprRoot bool) (
 			part = part[1 : len(part)-1]
 		}
 
-		ctx = v.evalField(ctx, part, exprRoot)
-		if !ctx.IsValid() {
-			break
+		value := v.evalField(ctx, part, exprRoot)
+		if !value.IsValid() {
+			v.failAttempt(ctx, part, i)
+			return value, partResolved
 		}
+		ctx = value
 
 		// we resolved at least one part of path
 		partResolved = true
@@ -380,11 +476,19 @@ func (v *evaluator) evalFieldFunc(name string, funcVal reflect.Value, exprRoot b
 		panic(err)
 	}
 
+	if exprRoot && v.mustache {
+		if result, ok := v.evalLambda(funcVal); ok {
+			return result
+		}
+	}
+
 	var options *Options
+	node := v.curNode
 	if exprRoot {
 		// create function arg with all params/hash
 		expr := v.curExpr()
 		options = v.helperOptions(expr)
+		node = expr
 
 		// ok, that expression was a function call
 		v.exprFunc[expr] = true
@@ -394,7 +498,7 @@ func (v *evaluator) evalFieldFunc(name string, funcVal reflect.Value, exprRoot b
 		options = newEmptyOptions(v)
 	}
 
-	return v.callFunc(name, funcVal, options)
+	return v.callFunc(name, funcVal, options, node)
 }
 
 // evalStructTag checks for the existence of a struct tag containing the
@@ -430,6 +534,11 @@ func (v *evaluator) findBlockParam(node *ast.PathExpression) (string, interface{
 func (v *evaluator) evalPathExpression(node *ast.PathExpression, exprRoot bool) interface{} {
 	var result interface{}
 
+	if v.debug != nil {
+		v.beginLookup(node)
+		defer func() { v.endLookup(node, result) }()
+	}
+
 	if name, value := v.findBlockParam(node); value != nil {
 		// block parameter value
 
@@ -444,6 +553,10 @@ func (v *evaluator) evalPathExpression(node *ast.PathExpression, exprRoot bool)
 		//   {"foo": {"baz": "bat"}}
 		newCtx := map[string]interface{}{name: value}
 
+		if lookup := v.curLookup(); lookup != nil {
+			lookup.BlockParam = name
+		}
+
 		v.pushCtx(reflect.ValueOf(newCtx))
 		result = v.evalCtxPathExpression(node, exprRoot)
 		v.popCtx()
@@ -487,6 +600,7 @@ func (v *evaluator) evalDataPathExpression(node *ast.PathExpression, exprRoot bo
 
 	// resolve data
 	// @note Can be changed to v.evalCtx() as context can't be an array
+	v.beginAttempt("data", node.Depth, reflect.ValueOf(frame.data))
 	result, _ := v.evalCtxPath(reflect.ValueOf(frame.data), node.Parts, exprRoot)
 	return result
 }
@@ -499,10 +613,15 @@ func (v *evaluator) evalCtxPathExpression(node *ast.PathExpression, exprRoot boo
 		// `@root` - remove the first part
 		parts := node.Parts[1:len(node.Parts)]
 
+		v.beginAttempt("@root", 0, v.rootCtx())
 		result, _ := v.evalCtxPath(v.rootCtx(), parts, exprRoot)
 		return result
 	}
 
+	if v.compat {
+		return v.evalCompatPath(node, exprRoot)
+	}
+
 	return v.evalDepthPath(node.Depth, node.Parts, exprRoot)
 }
 
@@ -515,6 +634,7 @@ func (v *evaluator) evalDepthPath(depth int, parts []string, exprRoot bool) inte
 
 	for (result == nil) && ctx.IsValid() && (depth <= len(v.ctx) && !partResolved) {
 		// try with context
+		v.beginAttempt("context", depth, ctx)
 		result, partResolved = v.evalCtxPath(ctx, parts, exprRoot)
 
 		// As soon as we find the first part of a path, we must not try to resolve with parent context if result is finally `nil`
@@ -566,6 +686,9 @@ func (v *evaluator) evalCtxPath(ctx reflect.Value, parts []string, exprRoot bool
 
 // isHelperCall returns true if given expression is a helper call
 func (v *evaluator) isHelperCall(node *ast.Expression) bool {
+	if call := v.helperCalls.lookup(node); call != nil {
+		return call.known
+	}
 	if helperName := node.HelperName(); helperName != "" {
 		_, exist := v.helpers[helperName]
 		return exist
@@ -573,8 +696,17 @@ func (v *evaluator) isHelperCall(node *ast.Expression) bool {
 	return false
 }
 
-// callFunc calls function with given options
-func (v *evaluator) callFunc(name string, funcVal reflect.Value, options *Options) reflect.Value {
+// callHelperFunc calls helper function with given options
+func (v *evaluator) callHelperFunc(name string, helper *Helper, options *Options, node ast.Node) reflect.Value {
+	if helper.anyParams {
+		return v.funcResult(name, helper.Call([]reflect.Value{reflect.ValueOf(options)}), node)
+	}
+
+	return v.callFunc(name, helper.Value, options, node)
+}
+
+// callFunc calls function with given options. Node is the template node that calls that function.
+func (v *evaluator) callFunc(name string, funcVal reflect.Value, options *Options, node ast.Node) reflect.Value {
 	params := options.Params()
 
 	funcType := funcVal.Type()
@@ -635,37 +767,75 @@ func (v *evaluator) callFunc(name string, funcVal reflect.Value, options *Option
 		args[numIn-1] = reflect.ValueOf(options)
 	}
 
-	result := funcVal.Call(args)
+	return v.funcResult(name, funcVal.Call(args), node)
+}
+
+// funcResult returns the value returned by a function call, and panics with a HelperError if that function also
+// returned a non-nil error
+func (v *evaluator) funcResult(name string, result []reflect.Value, node ast.Node) reflect.Value {
+	if len(result) == 2 {
+		if err, _ := result[1].Interface().(error); err != nil {
+			helperErr := &HelperError{Name: name, Err: err}
+			if node != nil {
+				helperErr.Loc = node.Location()
+			}
+			panic(helperErr)
+		}
+	}
 
 	return result[0]
 }
 
 // callHelper invoqs helper function for given expression node
 func (v *evaluator) callHelper(name string, helper *Helper, node *ast.Expression) interface{} {
-	result := v.callFunc(name, helper.Value, v.helperOptions(node))
-	if !result.IsValid() {
-		return nil
+	options := v.helperOptions(node)
+
+	if v.profile != nil {
+		v.profile.enter("helper", name, 0)
+		defer v.profile.exit()
 	}
 
+	var result interface{}
+
+	if len(v.interceptors.helper) > 0 {
+		result = v.interceptHelper(name, helper, node, options)
+	} else if value := v.callHelperFunc(name, helper, options, node); value.IsValid() {
+		result = value.Interface()
+	}
+
+	v.debugHelperCall(name, options, result)
+
 	// @todo We maybe want to ensure here that helper returned a string or a SafeString
-	return result.Interface()
+	return result
 }
 
 // helperOptions computes helper options argument from an expression
 func (v *evaluator) helperOptions(node *ast.Expression) *Options {
-	var params []interface{}
-	var hash map[string]interface{}
+	var result *Options
+
+	if v.stringParams {
+		result = v.stringParamsOptions(node)
+	} else {
+		var params []interface{}
+		var hash map[string]interface{}
+
+		for _, paramNode := range node.Params {
+			param := paramNode.Accept(v)
+			params = append(params, param)
+		}
 
-	for _, paramNode := range node.Params {
-		param := paramNode.Accept(v)
-		params = append(params, param)
+		if node.Hash != nil {
+			hash, _ = node.Hash.Accept(v).(map[string]interface{})
+		}
+
+		result = newOptions(v, params, hash)
 	}
 
-	if node.Hash != nil {
-		hash, _ = node.Hash.Accept(v).(map[string]interface{})
+	if v.trackIds {
+		result.paramIDs, result.hashIDs = v.trackedIDs(node)
 	}
 
-	return newOptions(v, params, hash)
+	return result
 }
 
 //
@@ -695,19 +865,66 @@ func (v *evaluator) partialContext(node *ast.PartialStatement) reflect.Value {
 }
 
 // evalPartial evaluates a partial
-func (v *evaluator) evalPartial(partialTpl *Template, node *ast.PartialStatement) string {
+func (v *evaluator) evalPartial(name string, partialTpl *Template, node *ast.PartialStatement) string {
+	if v.profile != nil {
+		v.profile.enter("partial", name, 0)
+		defer v.profile.exit()
+	}
 
-	// push partial context
 	ctx := v.partialContext(node)
+
+	if len(v.interceptors.partial) > 0 {
+		return v.interceptPartial(name, partialTpl, node, ctx)
+	}
+
+	return v.renderPartial(partialTpl, node, ctx)
+}
+
+// renderPartial evaluates a partial template with given context
+func (v *evaluator) renderPartial(partialTpl *Template, node *ast.PartialStatement, ctx reflect.Value) string {
+	if v.partialDepth >= MaxPartialDepth {
+		v.panicf("Partial recursion too deep: more than %d nested partials", MaxPartialDepth)
+	}
+
+	v.partialDepth++
+	defer func() { v.partialDepth-- }()
+
+	if v.tracer != nil {
+		v.tracer.partialSource(partialTpl.source)
+	}
+
+	// push partial context
 	if ctx.IsValid() {
 		v.pushCtx(ctx)
 	}
 
-	// evaluate partial template
-	result, _ := partialTpl.Program().Accept(v).(string)
+	// partial expressions were resolved when parsing partial template
+	helperCalls := v.helperCalls
+	v.helperCalls = partialTpl.helperCalls
+	defer func() { v.helperCalls = helperCalls }()
+
+	var result string
+
+	if v.preventIndent && (node.Indent != "") {
+		// only output indentation before partial
+		result, _ = partialTpl.Program().Accept(v).(string)
+		result = node.Indent + result
+	} else if v.mustache && (node.Indent != "") && (partialTpl.source != "") {
+		// Mustache spec: the partial source is indented, not the interpolated values
+		indented, err := partialTpl.indentedProgram(node.Indent)
+		if err != nil {
+			v.panic(err)
+		}
+
+		v.helperCalls = indented.helperCalls
+		result, _ = indented.program.Accept(v).(string)
+	} else {
+		// evaluate partial template
+		result, _ = partialTpl.Program().Accept(v).(string)
 
-	// ident partial
-	result = indentLines(result, node.Indent)
+		// ident partial
+		result = indentLines(result, node.Indent)
+	}
 
 	if ctx.IsValid() {
 		v.popCtx()
@@ -747,6 +964,30 @@ func (v *evaluator) wasFuncCall(node *ast.Expression) bool {
 	return v.exprFunc[node]
 }
 
+// statementHelper returns name of helper or function called by given statement, if any
+func (v *evaluator) statementHelper(node ast.Node) string {
+	var expr *ast.Expression
+
+	switch n := node.(type) {
+	case *ast.MustacheStatement:
+		expr = n.Expression
+	case *ast.BlockStatement:
+		expr = n.Expression
+	default:
+		return ""
+	}
+
+	if v.isHelperCall(expr) {
+		return expr.HelperName()
+	}
+
+	if v.wasFuncCall(expr) {
+		return expr.Canonical()
+	}
+
+	return ""
+}
+
 //
 // Visitor interface
 //
@@ -756,8 +997,20 @@ func (v *evaluator) wasFuncCall(node *ast.Expression) bool {
 // VisitProgram implements corresponding Visitor interface method
 func (v *evaluator) VisitProgram(w io.Writer, node *ast.Program) (err error) {
 	v.at(node)
+
+	if v.tracer != nil {
+		v.tracer.pushProgram()
+		defer v.tracer.popProgram()
+	}
+
 	for _, n := range node.Body {
-		if str := Str(n.Accept(v)); str != "" {
+		str := Str(n.Accept(v))
+
+		if v.tracer != nil {
+			v.tracer.statement(n, str, v.statementHelper(n))
+		}
+
+		if str != "" {
 			if _, err = fmt.Fprint(w, str); err != nil {
 				return
 			}
@@ -791,6 +1044,15 @@ func (v *evaluator) VisitMustache(node *ast.MustacheStatement) interface{} {
 func (v *evaluator) VisitBlock(node *ast.BlockStatement) interface{} {
 	v.at(node)
 
+	if v.profile != nil {
+		v.profile.enter("block", profileBlockName(node), node.Loc.Line)
+		defer v.profile.exit()
+	}
+
+	if node.Inheritance != ast.NoInheritance {
+		return v.evalInheritance(node)
+	}
+
 	v.pushBlock(node)
 
 	var result interface{}
@@ -848,6 +1110,11 @@ func (v *evaluator) VisitPartial(node *ast.PartialStatement) interface{} {
 		}
 	}
 
+	if v.mustache && ((name == "") || (v.partials[name] == nil)) {
+		// Mustache spec: missing partials render an empty string
+		return ""
+	}
+
 	if name == "" {
 		v.panicf("Unexpected partial name: %q", node.Name)
 	}
@@ -857,7 +1124,12 @@ func (v *evaluator) VisitPartial(node *ast.PartialStatement) interface{} {
 		v.panicf("Partial not found: %s", name)
 	}
 
-	return v.evalPartial(partial, node)
+	if v.tracer != nil {
+		v.tracer.enterPartial(name)
+		defer v.tracer.exitPartial()
+	}
+
+	return v.evalPartial(name, partial, node)
 }
 
 // VisitContent implements corresponding Visitor interface method
@@ -888,7 +1160,18 @@ func (v *evaluator) VisitExpression(node *ast.Expression) interface{} {
 	v.pushExpr(node)
 
 	// helper call
-	if helperName := node.HelperName(); helperName != "" {
+	if call := v.helperCalls.lookup(node); call != nil {
+		if call.known {
+			if call.helper == nil {
+				v.panicf("Known helper not registered: %s", call.name)
+			}
+
+			result = v.callHelper(call.name, call.helper, node)
+		}
+
+		// resolved when parsing: known helpers are never looked up in context
+		done = call.known
+	} else if helperName := node.HelperName(); helperName != "" {
 		if helper, exist := v.helpers[helperName]; exist {
 			result = v.callHelper(helperName, helper, node)
 			done = true
@@ -957,6 +1240,20 @@ func (v *evaluator) VisitNumber(node *ast.NumberLiteral) interface{} {
 	return node.Number()
 }
 
+// VisitUndefined implements corresponding Visitor interface method
+func (v *evaluator) VisitUndefined(node *ast.UndefinedLiteral) interface{} {
+	v.at(node)
+
+	return nil
+}
+
+// VisitNull implements corresponding Visitor interface method
+func (v *evaluator) VisitNull(node *ast.NullLiteral) interface{} {
+	v.at(node)
+
+	return nil
+}
+
 // Miscellaneous
 
 // VisitHash implements corresponding Visitor interface method
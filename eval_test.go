@@ -1,6 +1,7 @@
 package mario_test
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -82,6 +83,15 @@ func TestEval(t *testing.T) {
 			},
 			expectedError: "Evaluation error: String{Value:'bar', Pos:7}: Helper 'foo' called with wrong number of arguments, needed 2 but got 1",
 		},
+		{
+			template: `{{foo 1 2 3}}`,
+			helpers: map[string]interface{}{
+				"foo": func(options *mario.Options) string {
+					return "foo"
+				},
+			},
+			expectedError: "Evaluation error: Number{Value:3, Pos:10}: Helper 'foo' called with wrong number of arguments, needed 1 but got 3",
+		},
 		{
 			template: "{{foo}}",
 			data: map[string]interface{}{
@@ -98,6 +108,66 @@ func TestEval(t *testing.T) {
 			},
 			expectedError: "Helper function must return a string or a SafeString: ",
 		},
+		{
+			template: "{{isNil null}} {{isNil undefined}} {{isNil foo}} {{isNilKey key=null}}",
+			data:     map[string]string{"foo": "bar"},
+			helpers: map[string]interface{}{
+				"isNil": func(value interface{}) bool {
+					return value == nil
+				},
+				"isNilKey": func(options *mario.Options) bool {
+					return options.HashProp("key") == nil
+				},
+			},
+			expected: "true true false true",
+		},
+		{
+			template: "{{ptr null}}",
+			helpers: map[string]interface{}{
+				"ptr": func(str *string) bool {
+					return str == nil
+				},
+			},
+			expected: "true",
+		},
+		{
+			template: "{{#if (equal foo undefined)}}missing{{/if}} {{null}} {{null.bar}}",
+			data: map[string]interface{}{
+				"null": map[string]string{"bar": "baz"},
+			},
+			expected: "missing map[bar:baz] baz",
+		},
+		{
+			template: "{{upper foo}}",
+			data:     map[string]string{"foo": "bar"},
+			helpers: map[string]interface{}{
+				"upper": func(str string) (string, error) {
+					return strings.ToUpper(str), nil
+				},
+			},
+			expected: "BAR",
+		},
+		{
+			template: "{{#if true}}\n  {{upper foo}}\n{{/if}}",
+			helpers: map[string]interface{}{
+				"upper": func(str string) (string, error) {
+					return "", errors.New("empty string")
+				},
+			},
+			expectedError: "Evaluation error on line 2: Helper 'upper' failed: empty string",
+		},
+		{
+			template: "{{foo}} {{bar}}",
+			data: map[string]interface{}{
+				"foo": func() (int, error) {
+					return 1, nil
+				},
+				"bar": func(options *mario.Options) (int, error) {
+					return 0, errors.New("no bar")
+				},
+			},
+			expectedError: "Evaluation error on line 1: Helper 'bar' failed: no bar",
+		},
 
 		// @todo Test with a "../../path" (depth 2 path) while context is only depth 1
 	}
@@ -121,6 +191,29 @@ func TestEval(t *testing.T) {
 	}
 }
 
+func TestEvalHelperError(t *testing.T) {
+	t.Parallel()
+
+	errNotFound := errors.New("not found")
+
+	tpl := mario.Must(mario.New().Parse("{{#each ids}}\n{{user this}}\n{{/each}}"))
+	tpl.WithHelperFunc("user", func(id int) (string, error) {
+		if id > 1 {
+			return "", errNotFound
+		}
+		return "Mario", nil
+	})
+
+	var b strings.Builder
+	err := tpl.Execute(&b, map[string]interface{}{"ids": []int{1, 2}})
+	require.True(t, errors.Is(err, errNotFound))
+
+	var helperErr *mario.HelperError
+	require.True(t, errors.As(err, &helperErr))
+	require.Equal(t, "user", helperErr.Name)
+	require.Equal(t, 2, helperErr.Loc.Line)
+}
+
 func TestEvalStruct(t *testing.T) {
 	t.Parallel()
 
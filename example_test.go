@@ -173,3 +173,28 @@ func ExampleHelper_safe_string() {
 	// Output:
 	// <a href='http://www.aymerick.com/'>This is a &lt;em&gt;cool&lt;/em&gt; website</a>
 }
+
+func ExampleTemplate_WithMustache() {
+	source := `{{=<% %>=}}<%#wrap%>Hi <%name%><%/wrap%>`
+	data := map[string]interface{}{
+		"name": "Mario",
+		"wrap": func(text string) string {
+			return "<b>" + text + "</b>"
+		},
+	}
+
+	tpl, err := mario.New().WithMustache().Parse(source)
+	if err != nil {
+		panic(err)
+	}
+
+	var b strings.Builder
+	if err := tpl.Execute(&b, data); err != nil {
+		panic(err)
+	}
+
+	fmt.Println(b.String())
+
+	// Output:
+	// <b>Hi Mario</b>
+}
@@ -29,8 +29,21 @@ type Test struct {
 }
 
 func launchTests(t *testing.T, tests []Test) {
+	launchTestsWithSetup(t, tests, nil)
+}
+
+// launchTestsWithSetup launches tests with templates and partials set up with given function before parsing
+func launchTestsWithSetup(t *testing.T, tests []Test, setup func(*mario.Template)) {
 	t.Parallel()
 
+	newTemplate := func() *mario.Template {
+		tpl := mario.New()
+		if setup != nil {
+			setup(tpl)
+		}
+		return tpl
+	}
+
 	for _, test := range tests {
 		var err error
 		var tpl *mario.Template
@@ -44,7 +57,7 @@ func launchTests(t *testing.T, tests []Test) {
 		}
 
 		// parse template
-		tpl, err = mario.New().Parse(test.input)
+		tpl, err = newTemplate().Parse(test.input)
 		if err != nil {
 			t.Errorf("Test '%s' failed - Failed to parse template\ninput:\n\t'%s'\nerror:\n\t%s", test.name, test.input, err)
 		} else {
@@ -53,7 +66,7 @@ func launchTests(t *testing.T, tests []Test) {
 			}
 
 			for name, source := range test.partials {
-				tpl.WithPartial(name, mario.Must(mario.New().Parse(source)))
+				tpl.WithPartial(name, mario.Must(newTemplate().Parse(source)))
 			}
 
 			// setup private data frame
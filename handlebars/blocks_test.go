@@ -1,6 +1,10 @@
 package handlebars
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/imantung/mario"
+)
 
 //
 // Those tests come from:
@@ -174,26 +178,6 @@ var blocksTests = []Test{
 		nil, nil, nil,
 		"1\n3\n5\nOK.",
 	},
-	// // @todo compat mode
-	// {
-	// 	"block with deep recursive lookup lookup",
-	// 	"{{#outer}}Goodbye {{#inner}}cruel {{omg}}{{/inner}}{{/outer}}",
-	// 	map[string]interface{}{"omg": "OMG!", "outer": []map[string]interface{}{{"inner": []map[string]string{{"text": "goodbye"}}}}},
-	// 	nil,
-	// 	nil,
-	//  nil,
-	// 	"Goodbye cruel OMG!",
-	// },
-	// // @todo compat mode
-	// {
-	// 	"block with deep recursive pathed lookup",
-	// 	"{{#outer}}Goodbye {{#inner}}cruel {{omg.yes}}{{/inner}}{{/outer}}",
-	// 	map[string]interface{}{"omg": map[string]string{"yes": "OMG!"}, "outer": []map[string]interface{}{{"inner": []map[string]string{{"yes": "no", "text": "goodbye"}}}}},
-	// 	nil,
-	// 	nil,
-	//  nil,
-	// 	"Goodbye cruel OMG!",
-	// },
 	{
 		"block with missed recursive lookup",
 		"{{#outer}}Goodbye {{#inner}}cruel {{omg.yes}}{{/inner}}{{/outer}}",
@@ -206,3 +190,52 @@ var blocksTests = []Test{
 func TestBlocks(t *testing.T) {
 	launchTests(t, blocksTests)
 }
+
+var blocksCompatTests = []Test{
+	{
+		"block with deep recursive lookup lookup",
+		"{{#outer}}Goodbye {{#inner}}cruel {{omg}}{{/inner}}{{/outer}}",
+		map[string]interface{}{"omg": "OMG!", "outer": []map[string]interface{}{{"inner": []map[string]string{{"text": "goodbye"}}}}},
+		nil, nil, nil,
+		"Goodbye cruel OMG!",
+	},
+	{
+		"block with deep recursive pathed lookup",
+		"{{#outer}}Goodbye {{#inner}}cruel {{omg.yes}}{{/inner}}{{/outer}}",
+		map[string]interface{}{"omg": map[string]string{"yes": "OMG!"}, "outer": []map[string]interface{}{{"inner": []map[string]string{{"yes": "no", "text": "goodbye"}}}}},
+		nil, nil, nil,
+		"Goodbye cruel OMG!",
+	},
+	{
+		"block with missed recursive lookup",
+		"{{#outer}}Goodbye {{#inner}}cruel {{omg.yes}}{{/inner}}{{/outer}}",
+		map[string]interface{}{"omg": map[string]string{"no": "OMG!"}, "outer": []map[string]interface{}{{"inner": []map[string]string{{"yes": "no", "text": "goodbye"}}}}},
+		nil, nil, nil,
+		"Goodbye cruel ",
+	},
+}
+
+func TestBlocksCompat(t *testing.T) {
+	launchTestsWithSetup(t, blocksCompatTests, func(tpl *mario.Template) { tpl.WithCompat() })
+}
+
+var blocksIgnoreStandaloneTests = []Test{
+	{
+		"block standalone else sections can be disabled (1)",
+		"{{#people}}\n{{name}}\n{{^}}\n{{none}}\n{{/people}}\n",
+		map[string]interface{}{"none": "No people"},
+		nil, nil, nil,
+		"\nNo people\n\n",
+	},
+	{
+		"block standalone else sections can be disabled (2)",
+		"{{#none}}\n{{.}}\n{{^}}\nFail\n{{/none}}\n",
+		map[string]interface{}{"none": "No people"},
+		nil, nil, nil,
+		"\nNo people\n\n",
+	},
+}
+
+func TestBlocksIgnoreStandalone(t *testing.T) {
+	launchTestsWithSetup(t, blocksIgnoreStandaloneTests, func(tpl *mario.Template) { tpl.WithIgnoreStandalone() })
+}
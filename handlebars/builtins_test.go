@@ -1,6 +1,11 @@
 package handlebars
 
-import "testing"
+import (
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+)
 
 //
 // Those tests come from:
@@ -279,14 +284,9 @@ var builtinsTests = []Test{
 
 	// @todo "each on implicit context" should throw error
 
-	// SKIP: #log - "should call logger at default level"
-	// SKIP: #log - "should call logger at data level"
-	// SKIP: #log - "should output to info"
-	// SKIP: #log - "should log at data level"
-	// SKIP: #log - "should handle missing logger"
+	// @note #log tests are in TestBuiltinsLog
 
 	// @note Test added
-	// @todo Check log output
 	{
 		"#log",
 		"{{log blah}}",
@@ -339,3 +339,93 @@ var builtinsTests = []Test{
 func TestBuiltins(t *testing.T) {
 	launchTests(t, builtinsTests)
 }
+
+type logTest struct {
+	name     string
+	input    string
+	level    interface{} // @level data
+	minLevel mario.LogLevel
+	logged   bool
+	expected mario.LogLevel
+	params   []interface{}
+}
+
+var logTests = []logTest{
+	{"#log - should call logger at default level", "{{log blah}}", nil, mario.LogInfo, true, mario.LogInfo, []interface{}{"whee"}},
+	{"#log - should call logger at data level", "{{log blah}}", "03", mario.LogInfo, true, mario.LogError, []interface{}{"whee"}},
+	{"#log - should handle string log levels", "{{log blah}}", "error", mario.LogInfo, true, mario.LogError, []interface{}{"whee"}},
+	{"#log - should handle hash log levels", `{{log blah level="error"}}`, nil, mario.LogInfo, true, mario.LogError, []interface{}{"whee"}},
+	{"#log - hash level overrides data level", `{{log blah level="warn"}}`, "error", mario.LogInfo, true, mario.LogWarn, []interface{}{"whee"}},
+	{"#log - should handle hash log levels below threshold", `{{log blah level="debug"}}`, nil, mario.LogInfo, false, 0, nil},
+	{"#log - should not output below threshold", "{{log blah}}", nil, mario.LogWarn, false, 0, nil},
+	{"#log - should log debug with debug threshold", "{{log blah}}", "debug", mario.LogDebug, true, mario.LogDebug, []interface{}{"whee"}},
+	{"#log - should pass multiple log arguments", `{{log blah "foo" 1}}`, nil, mario.LogInfo, true, mario.LogInfo, []interface{}{"whee", "foo", 1}},
+	{"#log - should pass zero log arguments", "{{log}}", nil, mario.LogInfo, true, mario.LogInfo, nil},
+}
+
+func TestBuiltinsLog(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range logTests {
+		var logged bool
+		var level mario.LogLevel
+		var params []interface{}
+
+		logger := mario.LoggerFunc(func(l mario.LogLevel, p ...interface{}) {
+			logged, level, params = true, l, p
+		})
+
+		tpl := mario.Must(mario.New().Parse(test.input)).WithLogger(logger).WithLogLevel(test.minLevel)
+
+		frame := mario.NewDataFrame()
+		if test.level != nil {
+			frame.Set("level", test.level)
+		}
+
+		var b strings.Builder
+		if err := tpl.ExecuteWith(&b, map[string]string{"blah": "whee"}, frame); err != nil {
+			t.Errorf("Test '%s' failed: %s", test.name, err)
+			continue
+		}
+
+		if b.String() != "" {
+			t.Errorf("Test '%s' failed - unexpected output: %q", test.name, b.String())
+		}
+
+		if logged != test.logged {
+			t.Errorf("Test '%s' failed - logged: %t, expected %t", test.name, logged, test.logged)
+			continue
+		}
+
+		if logged && ((level != test.expected) || (mario.Str(params) != mario.Str(test.params))) {
+			t.Errorf("Test '%s' failed - logged %s %q, expected %s %q", test.name, level, params, test.expected, test.params)
+		}
+	}
+}
+
+func TestBuiltinsLog_ExecutionLogger(t *testing.T) {
+	t.Parallel()
+
+	var tplLogs, execLogs []string
+
+	tpl := mario.Must(mario.New().Parse(`{{#each items}}{{log this}}{{/each}}`)).
+		WithLogger(mario.LoggerFunc(func(l mario.LogLevel, p ...interface{}) { tplLogs = append(tplLogs, mario.Str(p)) }))
+
+	// logger set on data frame is used for that execution only
+	frame := mario.NewDataFrame()
+	frame.SetLogger(mario.LoggerFunc(func(l mario.LogLevel, p ...interface{}) { execLogs = append(execLogs, mario.Str(p)) }))
+
+	ctx := map[string][]string{"items": {"a", "b"}}
+
+	var b strings.Builder
+	if err := tpl.ExecuteWith(&b, ctx, frame); err != nil {
+		t.Fatal(err)
+	}
+	if err := tpl.Execute(&b, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(execLogs, ",") != "a,b" || strings.Join(tplLogs, ",") != "a,b" {
+		t.Errorf("Unexpected logs - execution: %q, template: %q", execLogs, tplLogs)
+	}
+}
@@ -1,6 +1,10 @@
 package handlebars
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/imantung/mario"
+)
 
 //
 // Those tests come from:
@@ -163,20 +167,53 @@ var partialsTests = []Test{
 		map[string]string{"dude": "{{name}}\n {{> url}}", "url": "{{url}}!\n"},
 		"Dudes:\n  Yehuda\n   http://yehuda!\n  Alan\n   http://alan!\n",
 	},
-
-	// // @todo preventIndent option
-	// {
-	// 	"standalone partials (3) - prevent nested indented partials",
-	// 	"Dudes:\n{{#dudes}}\n  {{>dude}}\n{{/dudes}}",
-	// 	map[string]interface{}{"dudes": []map[string]string{{"name": "Yehuda", "url": "http://yehuda"}, {"name": "Alan", "url": "http://alan"}}},
-	// 	nil, nil,
-	// 	map[string]string{"dude": "{{name}}\n {{> url}}", "url": "{{url}}!\n"},
-	// 	"Dudes:\n  Yehuda\n http://yehuda!\n  Alan\n http://alan!\n",
-	// },
-
-	// @todo "compat mode"
 }
 
 func TestPartials(t *testing.T) {
 	launchTests(t, partialsTests)
 }
+
+var partialsCompatTests = []Test{
+	{
+		"partials with compat",
+		"Dudes: {{#dudes}}{{> dude}}{{/dudes}}",
+		map[string]interface{}{"root": "yes", "dudes": []map[string]string{{"name": "Yehuda", "url": "http://yehuda"}, {"name": "Alan", "url": "http://alan"}}},
+		nil, nil,
+		map[string]string{"dude": "{{name}} ({{url}}) {{root}} "},
+		"Dudes: Yehuda (http://yehuda) yes Alan (http://alan) yes ",
+	},
+}
+
+func TestPartialsCompat(t *testing.T) {
+	launchTestsWithSetup(t, partialsCompatTests, func(tpl *mario.Template) { tpl.WithCompat() })
+}
+
+var partialsPreventIndentTests = []Test{
+	{
+		"standalone partials (3) - prevent nested indented partials",
+		"Dudes:\n{{#dudes}}\n  {{>dude}}\n{{/dudes}}",
+		map[string]interface{}{"dudes": []map[string]string{{"name": "Yehuda", "url": "http://yehuda"}, {"name": "Alan", "url": "http://alan"}}},
+		nil, nil,
+		map[string]string{"dude": "{{name}}\n {{> url}}", "url": "{{url}}!\n"},
+		"Dudes:\n  Yehuda\n http://yehuda!\n  Alan\n http://alan!\n",
+	},
+}
+
+func TestPartialsPreventIndent(t *testing.T) {
+	launchTestsWithSetup(t, partialsPreventIndentTests, func(tpl *mario.Template) { tpl.WithPreventIndent() })
+}
+
+var partialsIgnoreStandaloneTests = []Test{
+	{
+		"standalone partials can be disabled",
+		"Dudes:\n{{#dudes}}\n  {{>dude}}\n{{/dudes}}",
+		map[string]interface{}{"dudes": []map[string]string{{"name": "Yehuda", "url": "http://yehuda"}, {"name": "Alan", "url": "http://alan"}}},
+		nil, nil,
+		map[string]string{"dude": "{{name}}\n"},
+		"Dudes:\n\n  Yehuda\n\n\n  Alan\n\n",
+	},
+}
+
+func TestPartialsIgnoreStandalone(t *testing.T) {
+	launchTestsWithSetup(t, partialsIgnoreStandaloneTests, func(tpl *mario.Template) { tpl.WithIgnoreStandalone() })
+}
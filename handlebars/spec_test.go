@@ -0,0 +1,698 @@
+package handlebars
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+)
+
+//
+// Those tests are transcribed from:
+//   https://github.com/wycats/handlebars.js/tree/master/spec
+//
+// Fixtures are stored in the spec/ directory, with the handlebars-spec JSON layout. JS helpers are replaced by
+// names of Go implementations, from the specHelpers registry.
+//
+
+const specExpectedFailuresFile = "expected_failures.txt"
+
+var updateSpecFailures = flag.Bool("update-spec-failures", false, "rewrite spec/"+specExpectedFailuresFile+" with current failures")
+
+// specSummary is the spec conformance summary, printed after all tests ran
+var specSummary string
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	if specSummary != "" {
+		fmt.Println(specSummary)
+	}
+
+	os.Exit(code)
+}
+
+// specTest is a test of a spec fixture file
+type specTest struct {
+	Description    string                 `json:"description"`
+	It             string                 `json:"it"`
+	Template       string                 `json:"template"`
+	Data           interface{}            `json:"data"`
+	PrivateData    map[string]interface{} `json:"privateData"`
+	Helpers        map[string]string      `json:"helpers"`
+	Partials       map[string]string      `json:"partials"`
+	CompileOptions map[string]interface{} `json:"compileOptions"`
+	Expected       string                 `json:"expected"`
+	Exception      bool                   `json:"exception"`
+}
+
+// specCompileOptions applies supported compile options on a template
+var specCompileOptions = map[string]func(tpl *mario.Template, value interface{}){
+	"knownHelpers": func(tpl *mario.Template, value interface{}) {
+		known, _ := value.(map[string]interface{})
+		for _, name := range sortedSpecKeys(known) {
+			if known[name] == true {
+				tpl.WithKnownHelpers(name)
+			}
+		}
+	},
+	"knownHelpersOnly": specFlag((*mario.Template).WithKnownHelpersOnly),
+	"stringParams":     specFlag((*mario.Template).WithStringParams),
+	"trackIds":         specFlag((*mario.Template).WithTrackIds),
+	"compat":           specFlag((*mario.Template).WithCompat),
+	"preventIndent":    specFlag((*mario.Template).WithPreventIndent),
+	"ignoreStandalone": specFlag((*mario.Template).WithIgnoreStandalone),
+}
+
+// specFlag returns a compile option that calls given template method when option value is true
+func specFlag(enable func(*mario.Template) *mario.Template) func(tpl *mario.Template, value interface{}) {
+	return func(tpl *mario.Template, value interface{}) {
+		if value == true {
+			enable(tpl)
+		}
+	}
+}
+
+// specHelpers are the Go implementations of spec helpers
+var specHelpers = map[string]interface{}{
+	// basic
+	"undefinedNullTypes": func(undef interface{}, null interface{}, options *mario.Options) string {
+		return fmt.Sprintf("%t %t object", undef == nil, null == nil)
+	},
+	"barPrefix": func(value string) string {
+		return "bar " + value
+	},
+
+	// data
+	"dataAdjectiveNoun": func(options *mario.Options) string {
+		return options.DataStr("adjective") + " " + options.ValueStr("noun")
+	},
+	"letData": func(options *mario.Options) string {
+		frame := options.NewDataFrame()
+		for k, v := range options.Hash() {
+			frame.Set(k, v)
+		}
+		return options.FnData(frame)
+	},
+	"helloParam": func(context string) string {
+		return "Hello " + context
+	},
+	"helloHashNoun": func(options *mario.Options) string {
+		return "Hello " + options.HashStr("noun")
+	},
+	"dataAdjectiveParamExclaim": func(noun string, options *mario.Options) string {
+		return options.DataStr("adjective") + " " + noun + specIf(mario.IsTrue(options.Value("exclaim")), "!")
+	},
+	"dataAdjectiveWorldExclaim": func(options *mario.Options) string {
+		return options.DataStr("adjective") + " world" + specIf(mario.IsTrue(options.Value("exclaim")), "!")
+	},
+	"dataAdjectiveParamExclaimValue": func(thing string, options *mario.Options) string {
+		return options.DataStr("adjective") + " " + thing + options.ValueStr("exclaim")
+	},
+	"fnThis": func(options *mario.Options) string {
+		return options.Fn()
+	},
+	"fnExclaimQuestion": func(options *mario.Options) string {
+		return options.FnWith(map[string]string{"exclaim": "?"})
+	},
+	"accessDataFnExclaimQuestion": func(options *mario.Options) string {
+		return options.DataStr("accessData") + " " + options.FnWith(map[string]string{"exclaim": "?"})
+	},
+	"fnSadWorld": func(options *mario.Options) string {
+		frame := options.NewDataFrame()
+		frame.Set("adjective", "sad")
+		return options.FnCtxData(map[string]string{"exclaim": "?", "zomg": "world"}, frame)
+	},
+	"fnSad": func(options *mario.Options) string {
+		frame := options.NewDataFrame()
+		frame.Set("adjective", "sad")
+		return options.FnCtxData(map[string]string{"exclaim": "?"}, frame)
+	},
+	"depthFrame": func(options *mario.Options) string {
+		depth, _ := options.Data("depth").(float64)
+		frame := options.NewDataFrame()
+		frame.Set("depth", depth+1)
+		return options.FnData(frame)
+	},
+
+	// helpers
+	"fn": func(options *mario.Options) string {
+		return options.Fn()
+	},
+	"fnThreeParams": func(a, b, c interface{}, options *mario.Options) string {
+		return options.Fn() + mario.Str(a) + mario.Str(b) + mario.Str(c)
+	},
+	"linkPrefix": func(prefix string, options *mario.Options) mario.SafeString {
+		return mario.SafeString(`<a href="` + prefix + "/" + options.ValueStr("url") + `">` + options.ValueStr("text") + "</a>")
+	},
+	"linkPrefixFn": func(prefix string, options *mario.Options) string {
+		return `<a href="` + prefix + "/" + options.ValueStr("url") + `">` + options.Fn() + "</a>"
+	},
+	"linkPeople": func(options *mario.Options) string {
+		return `<a href="/people/` + options.ValueStr("id") + `">` + options.Fn() + "</a>"
+	},
+	"linkName": func(options *mario.Options) string {
+		return `<a href="` + options.ValueStr("name") + `">` + options.Fn() + "</a>"
+	},
+	"goodbyesFn": func(options *mario.Options) string {
+		out := ""
+		for _, bye := range []string{"Goodbye", "goodbye", "GOODBYE"} {
+			out += bye + " " + options.FnWith(bye) + "! "
+		}
+		return out
+	},
+	"fnWithGoodbyeText": func(options *mario.Options) string {
+		return options.FnWith(map[string]string{"text": "GOODBYE"})
+	},
+	"formThis": func(options *mario.Options) string {
+		return "<form>" + options.Fn() + "</form>"
+	},
+	"formContext": func(context interface{}, options *mario.Options) string {
+		return "<form>" + options.FnWith(context) + "</form>"
+	},
+	"list": func(context []interface{}, options *mario.Options) string {
+		if len(context) == 0 {
+			return "<p>" + options.Inverse() + "</p>"
+		}
+
+		out := "<ul>"
+		for _, item := range context {
+			out += "<li>" + options.FnWith(item) + "</li>"
+		}
+		return out + "</ul>"
+	},
+	"world": func() string {
+		return "world"
+	},
+	"helpersString": func() string {
+		return "helpers"
+	},
+	"helperString": func() string {
+		return "helper"
+	},
+	"helloTimes": func(times interface{}) string {
+		return "Hello " + mario.Str(times) + " times"
+	},
+	"helloTimesTimes": func(times, times2 interface{}) string {
+		return "Hello " + mario.Str(times) + " " + mario.Str(times2) + " times"
+	},
+	"helloLiterals": func(param string, times interface{}, bool1, bool2 bool) string {
+		return fmt.Sprintf("Hello %s %s times: %t %t", param, mario.Str(times), bool1, bool2)
+	},
+	"goodbyeParams": func(cruel, world string) string {
+		return "Goodbye " + cruel + " " + world
+	},
+	"goodbyeParamsFn": func(cruel, world string, options *mario.Options) string {
+		return options.FnWith(map[string]string{"greeting": "Goodbye", "adj": cruel, "noun": world})
+	},
+	"goodbyeHash": func(options *mario.Options) string {
+		return "GOODBYE " + options.HashStr("cruel") + " " + options.HashStr("world") + " " + options.HashStr("times") + " TIMES"
+	},
+	"goodbyeHashPrint": func(options *mario.Options) string {
+		switch options.HashProp("print") {
+		case true:
+			return "GOODBYE " + options.HashStr("cruel") + " " + options.HashStr("world")
+		case false:
+			return "NOT PRINTING"
+		default:
+			return "THIS SHOULD NOT HAPPEN"
+		}
+	},
+	"goodbyeHashFn": func(options *mario.Options) string {
+		return "GOODBYE " + options.HashStr("cruel") + " " + options.Fn() + " " + options.HashStr("times") + " TIMES"
+	},
+	"foo": func() string {
+		return "foo"
+	},
+	"typeOf": func(arg interface{}) string {
+		switch arg.(type) {
+		case nil:
+			return "undefined"
+		case string:
+			return "string"
+		case bool:
+			return "boolean"
+		case int, float64:
+			return "number"
+		default:
+			return "object"
+		}
+	},
+	"upperGoodbye": func(options *mario.Options) string {
+		return strings.ToUpper(options.ValueStr("goodbye"))
+	},
+	"upperGoodbyeFn": func(options *mario.Options) string {
+		return strings.ToUpper(options.ValueStr("goodbye")) + options.Fn()
+	},
+	"cruelUpper": func(world string) string {
+		return "cruel " + strings.ToUpper(world)
+	},
+
+	// partials
+	"dudeString": func() string {
+		return "dude"
+	},
+	"missingString": func() string {
+		return "missing"
+	},
+
+	// subexpressions
+	"double": func(value string) string {
+		return value + value
+	},
+	"lol": func() string {
+		return "LOL"
+	},
+	"bork": func() string {
+		return "BORK"
+	},
+	"valIs": func(value interface{}) string {
+		return "val is " + mario.Str(value)
+	},
+	"valIsThree": func(p1, p2, p3 interface{}) string {
+		return "val is " + mario.Str(p1) + ", " + mario.Str(p2) + " and " + mario.Str(p3)
+	},
+	"valIsHashFun": func(options *mario.Options) string {
+		return "val is " + options.HashStr("fun")
+	},
+	"strictEqual": func(x, y interface{}) interface{} {
+		return x == y
+	},
+	"dash": func(a, b string) string {
+		return a + "-" + b
+	},
+	"concat": func(a, b string) string {
+		return a + b
+	},
+	"identity": func(value interface{}) interface{} {
+		return value
+	},
+	"input": func(options *mario.Options) mario.SafeString {
+		return mario.SafeString(`<input aria-label="` + mario.Escape(options.HashStr("aria-label")) + `" placeholder="` + mario.Escape(options.HashStr("placeholder")) + `" />`)
+	},
+	"safeString": func(value string) mario.SafeString {
+		return mario.SafeString(value)
+	},
+
+	// track ids
+	"trackIdsNone": func(passiveVoice, noun interface{}, options *mario.Options) string {
+		if (options.ParamID(0) != nil) || (options.ParamID(1) != nil) {
+			return "failure"
+		}
+		return "success"
+	},
+	"trackIdsParam": func(passiveVoice interface{}, options *mario.Options) string {
+		return "HELP ME MY BOSS " + specID(options.ParamID(0)) + ":" + specJS(passiveVoice)
+	},
+	"trackIdsParams": func(passiveVoice, noun interface{}, options *mario.Options) string {
+		return "HELP ME MY BOSS " + specID(options.ParamID(0)) + ":" + specJS(passiveVoice) + " " +
+			specID(options.ParamID(1)) + ":" + specJS(noun)
+	},
+	"trackIdsThreeParams": func(passiveVoice, noun, blah interface{}, options *mario.Options) string {
+		return "HELP ME MY BOSS " + specID(options.ParamID(0)) + ":" + specJS(passiveVoice) + " " +
+			specID(options.ParamID(1)) + ":" + specJS(noun) + " " + specID(options.ParamID(2)) + ":" + specJS(blah)
+	},
+	"trackIdsFourParams": func(passiveVoice, noun, thiz, thiz2 interface{}, options *mario.Options) string {
+		return "HELP ME MY BOSS " + specID(options.ParamID(0)) + ":" + specJS(passiveVoice) + " " +
+			specID(options.ParamID(1)) + ":" + specJS(noun) + " " + specID(options.ParamID(2)) + ":" + specJS(thiz) + " " +
+			specID(options.ParamID(3)) + ":" + specJS(thiz2)
+	},
+	"trackIdsHash": func(options *mario.Options) string {
+		return "HELP ME MY BOSS " + specID(options.HashID("bat")) + ":" + specJS(options.HashProp("bat")) + " " +
+			specID(options.HashID("baz")) + ":" + specJS(options.HashProp("baz"))
+	},
+	"trackIdsConstants": func(passiveVoice, noun interface{}, options *mario.Options) string {
+		return "HELP ME MY BOSS " + specID(options.ParamID(0)) + ":" + specJS(passiveVoice) + " " +
+			specID(options.ParamID(1)) + ":" + specJS(noun) + " " + specID(options.HashID("key")) + ":" + specJS(options.HashProp("key"))
+	},
+	"one": func() interface{} {
+		return 1
+	},
+	// block params with paths can't be set by a Go helper
+	"blockParamIsZomg": func(options *mario.Options) string {
+		return options.Fn()
+	},
+	"nameContextPath": func(name string, options *mario.Options) string {
+		return name + ":" + options.DataStr("contextPath") + "\n"
+	},
+	"nameParamID": func(name string, options *mario.Options) string {
+		return name + ":" + specID(options.ParamID(0)) + "\n"
+	},
+
+	// string params
+	"helpMeBoss": func(passiveVoice, noun string) string {
+		return "HELP ME MY BOSS " + passiveVoice + " " + noun
+	},
+	"helpMeBossFn": func(passiveVoice, noun string, options *mario.Options) string {
+		return "HELP ME MY BOSS " + passiveVoice + " " + noun + ": " + options.Fn()
+	},
+	"readingHackerNews": func(desire, noun string, options *mario.Options) string {
+		return "STOP ME FROM READING HACKER NEWS I " + mario.Str(options.Eval(options.ParamContext(0), desire)) + " " + noun
+	},
+	"readingHackerNewsFn": func(desire, noun string, options *mario.Options) string {
+		return "STOP ME FROM READING HACKER NEWS I " + mario.Str(options.Eval(options.ParamContext(0), desire)) + " " + noun +
+			" " + options.Fn()
+	},
+	"withParamContext": func(context string, options *mario.Options) string {
+		return options.FnWith(options.Eval(options.ParamContext(0), context))
+	},
+	"checkParamsTypes": func(desire, noun, trueBool, falseBool interface{}, options *mario.Options) string {
+		return specCheck(
+			options.ParamType(0), "StringLiteral",
+			options.ParamType(1), "PathExpression",
+			options.ParamType(2), "BooleanLiteral",
+			options.ParamType(3), "BooleanLiteral",
+		)
+	},
+	"checkHashTypes": func(exclamation string, options *mario.Options) string {
+		return specCheck(
+			exclamation, "he.says",
+			options.ParamType(0), "PathExpression",
+			options.HashType("desire"), "StringLiteral",
+			options.HashType("noun"), "PathExpression",
+			options.HashType("bool"), "BooleanLiteral",
+			options.HashProp("desire"), "need",
+			options.HashProp("noun"), "dad.joke",
+			options.HashProp("bool"), true,
+		)
+	},
+	"checkHashContexts": func(exclamation string, options *mario.Options) string {
+		return specCheck(
+			exclamation, "he.says",
+			options.ParamType(0), "PathExpression",
+			options.Eval(options.HashContext("noun"), "dale") != nil, true,
+			options.HashProp("desire"), "need",
+			options.HashProp("noun"), "dad.joke",
+			options.HashProp("bool"), true,
+		)
+	},
+	"withString": func(context interface{}, options *mario.Options) string {
+		return "WITH"
+	},
+	"viewString": func() string {
+		return "VIEW"
+	},
+	"checkDataParam": func(bar string, options *mario.Options) string {
+		if specCheck(bar, "@bar", options.ParamType(0), "PathExpression") != "Helper called" {
+			return "failure"
+		}
+		return "Foo!"
+	},
+
+	// strict
+	"undefinedHashValue": func(options *mario.Options) string {
+		if value, ok := options.Hash()["value"]; !ok || (value != nil) {
+			return "failure"
+		}
+		return "success"
+	},
+
+	// regressions
+	"fnEmptyContext": func(options *mario.Options) string {
+		return options.FnWith("")
+	},
+	"inverseEmptyContext": func(options *mario.Options) string {
+		return options.Inverse()
+	},
+	"jsString": func(value interface{}) string {
+		return specJS(value)
+	},
+	"safeStringFn": func(options *mario.Options) mario.SafeString {
+		return mario.SafeString(options.Fn())
+	},
+	"hashLength": func(options *mario.Options) string {
+		return options.HashStr("length")
+	},
+}
+
+// specJS converts given value to a string like JS does
+func specJS(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "undefined"
+	case map[string]interface{}:
+		return "[object Object]"
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			if item != nil {
+				parts[i] = specJS(item)
+			}
+		}
+		return strings.Join(parts, ",")
+	default:
+		return mario.Str(v)
+	}
+}
+
+// specID converts given track id to a string like JS does
+func specID(id interface{}) string {
+	if id == nil {
+		return "null"
+	}
+	return fmt.Sprint(id)
+}
+
+// specCheck returns "Helper called" if all given actual and expected values pairs are equal, or describes the first
+// mismatch
+func specCheck(pairs ...interface{}) string {
+	for i := 0; i < len(pairs); i += 2 {
+		if pairs[i] != pairs[i+1] {
+			return fmt.Sprintf("Expected %v, got %v", pairs[i+1], pairs[i])
+		}
+	}
+	return "Helper called"
+}
+
+func specIf(cond bool, s string) string {
+	if cond {
+		return s
+	}
+	return ""
+}
+
+// TestSpec runs handlebars.js spec fixtures, and checks that failures are the expected ones
+func TestSpec(t *testing.T) {
+	expectedFailures, err := readSpecExpectedFailures()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir("spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures []string
+	seen := make(map[string]bool)
+	total := 0
+
+	for _, file := range files {
+		if path.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		tests, err := readSpecFile(file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range tests {
+			id := fmt.Sprintf("%s: %s - %s", strings.TrimSuffix(file.Name(), ".json"), test.Description, test.It)
+			if seen[id] {
+				t.Fatalf("Duplicate spec test: %s", id)
+			}
+			seen[id] = true
+			total++
+
+			err := runSpecTest(test)
+			if err != nil {
+				failures = append(failures, id)
+			}
+
+			t.Run(id, func(t *testing.T) {
+				switch {
+				case *updateSpecFailures && (err != nil):
+					t.Skipf("failure: %s", err)
+				case *updateSpecFailures:
+					return
+				case (err != nil) && expectedFailures[id]:
+					t.Skipf("expected failure: %s", err)
+				case err != nil:
+					t.Errorf("%s\ntemplate:\n\t%q", err, test.Template)
+				case expectedFailures[id]:
+					t.Errorf("Test now passes, remove it from spec/%s", specExpectedFailuresFile)
+				}
+			})
+		}
+	}
+
+	for id := range expectedFailures {
+		if !seen[id] && !*updateSpecFailures {
+			t.Errorf("Unknown test in spec/%s: %s", specExpectedFailuresFile, id)
+		}
+	}
+
+	if *updateSpecFailures {
+		if err := writeSpecExpectedFailures(failures); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	passed := total - len(failures)
+	specSummary = fmt.Sprintf("handlebars.js spec conformance: %d/%d passed (%.1f%%)", passed, total, 100*float64(passed)/float64(total))
+}
+
+// runSpecTest returns an error if given test fails
+func runSpecTest(test specTest) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Panic: %v", r)
+		}
+	}()
+
+	// an unsupported compile option is a failure, even for a test that expects an error
+	for name := range test.CompileOptions {
+		if specCompileOptions[name] == nil {
+			return fmt.Errorf("Unsupported compile option: %s", name)
+		}
+	}
+
+	output, err := renderSpecTest(test)
+	if test.Exception {
+		if err == nil {
+			return fmt.Errorf("Expected an error, got output %q", output)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if output != test.Expected {
+		return fmt.Errorf("Expected %q, got %q", test.Expected, output)
+	}
+
+	return nil
+}
+
+// renderSpecTest renders template of given test
+func renderSpecTest(test specTest) (string, error) {
+	// compile options are applied before parsing, on template and partials
+	newTemplate := func() (*mario.Template, error) {
+		tpl := mario.New()
+		for _, name := range sortedSpecKeys(test.CompileOptions) {
+			apply := specCompileOptions[name]
+			if apply == nil {
+				return nil, fmt.Errorf("Unsupported compile option: %s", name)
+			}
+			apply(tpl, test.CompileOptions[name])
+		}
+		return tpl, nil
+	}
+
+	tpl, err := newTemplate()
+	if err != nil {
+		return "", err
+	}
+	if _, err := tpl.Parse(test.Template); err != nil {
+		return "", err
+	}
+
+	for name, impl := range test.Helpers {
+		fn := specHelpers[impl]
+		if fn == nil {
+			return "", fmt.Errorf("Unknown spec helper: %s", impl)
+		}
+		tpl.WithHelperFunc(name, fn)
+	}
+
+	for name, source := range test.Partials {
+		partial, err := newTemplate()
+		if err != nil {
+			return "", err
+		}
+		if _, err := partial.Parse(source); err != nil {
+			return "", err
+		}
+		tpl.WithPartial(name, partial)
+	}
+
+	var privData *mario.DataFrame
+	if test.PrivateData != nil {
+		privData = mario.NewDataFrame()
+		for k, v := range test.PrivateData {
+			privData.Set(k, v)
+		}
+	}
+
+	var b strings.Builder
+	if err := tpl.ExecuteWith(&b, test.Data, privData); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+func readSpecFile(name string) ([]specTest, error) {
+	data, err := ioutil.ReadFile(path.Join("spec", name))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []specTest
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	return result, nil
+}
+
+// readSpecExpectedFailures reads ids of tests that are expected to fail, one per line
+func readSpecExpectedFailures() (map[string]bool, error) {
+	f, err := os.Open(path.Join("spec", specExpectedFailuresFile))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]bool)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result[line] = true
+	}
+
+	return result, scanner.Err()
+}
+
+func writeSpecExpectedFailures(ids []string) error {
+	sort.Strings(ids)
+
+	content := "# handlebars.js spec tests that are expected to fail.\n" +
+		"# Regenerate with: go test ./handlebars -run TestSpec -update-spec-failures\n\n" +
+		strings.Join(ids, "\n") + "\n"
+
+	return ioutil.WriteFile(path.Join("spec", specExpectedFailuresFile), []byte(content), 0644)
+}
+
+func sortedSpecKeys(m map[string]interface{}) []string {
+	var result []string
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
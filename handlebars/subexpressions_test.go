@@ -1,6 +1,7 @@
 package handlebars
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/imantung/mario"
@@ -183,9 +184,7 @@ var subexpressionsTests = []Test{
 		`<input aria-label="Name" placeholder="Example User" />`,
 	},
 
-	// @todo "in string params mode"
-
-	// @todo "as hashes in string params mode"
+	// "in string params mode" and "as hashes in string params mode": see TestSubexpressionsStringParams
 
 	{
 		"subexpression functions on the context",
@@ -207,3 +206,50 @@ var subexpressionsTests = []Test{
 func TestSubexpressions(t *testing.T) {
 	launchTests(t, subexpressionsTests)
 }
+
+func TestSubexpressionsStringParams(t *testing.T) {
+	t.Parallel()
+
+	// "in string params mode"
+	tpl := mario.Must(mario.New().WithStringParams().Parse(`{{snog (blorg foo x=y) yeah a=b}}`))
+	tpl.WithHelperFunc("snog", func(a string, b string, options *mario.Options) string {
+		if (options.ParamType(0) != mario.ParamTypeSexpr) || (options.ParamType(1) != mario.ParamTypeID) {
+			t.Errorf("string params for outer helper processed incorrectly: %q, %q", options.ParamType(0), options.ParamType(1))
+		}
+		return a + b
+	})
+	tpl.WithHelperFunc("blorg", func(a string, options *mario.Options) string {
+		if options.ParamType(0) != mario.ParamTypeID {
+			t.Errorf("string params for inner helper processed incorrectly: %q", options.ParamType(0))
+		}
+		return a
+	})
+
+	var b strings.Builder
+	if err := tpl.Execute(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "fooyeah" {
+		t.Errorf("Unexpected output: %q", b.String())
+	}
+
+	// "as hashes in string params mode"
+	tpl = mario.Must(mario.New().WithStringParams().Parse(`{{blog fun=(bork)}}`))
+	tpl.WithHelperFunc("blog", func(options *mario.Options) string {
+		if options.HashType("fun") != mario.ParamTypeSexpr {
+			t.Errorf("Unexpected hash type: %q", options.HashType("fun"))
+		}
+		return "val is " + options.HashStr("fun")
+	})
+	tpl.WithHelperFunc("bork", func() string {
+		return "BORK"
+	})
+
+	b.Reset()
+	if err := tpl.Execute(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "val is BORK" {
+		t.Errorf("Unexpected output: %q", b.String())
+	}
+}
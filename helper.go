@@ -3,12 +3,17 @@ package mario
 import (
 	"fmt"
 	"reflect"
+
+	"github.com/imantung/mario/ast"
 )
 
 // Helper implement functionality that is not part of the Handlebars language itself
 // https://handlebarsjs.com/guide/expressions.html#helpers
 type Helper struct {
 	reflect.Value
+
+	// accepts any number of parameters, available with Options.Params(), like the log helper
+	anyParams bool
 }
 
 // CreateHelper from function
@@ -29,9 +34,44 @@ func isValidFunction(fnVal reflect.Value) error {
 	if fnVal.Kind() != reflect.Func {
 		return fmt.Errorf("Helper must be a function: %s", name)
 	}
-	if fnType.NumOut() != 1 {
+	if !returnsValue(fnType) && !returnsValueAndError(fnType) {
 		return fmt.Errorf("Helper function must return a string or a SafeString: %s", name)
 	}
 	// TODO: Check if first returned value is a string, SafeString or interface{} ?
 	return nil
 }
+
+// returnsValue returns true if given function type returns a single value
+func returnsValue(fnType reflect.Type) bool {
+	return fnType.NumOut() == 1
+}
+
+// returnsValueAndError returns true if given function type returns a value and an error
+func returnsValueAndError(fnType reflect.Type) bool {
+	return (fnType.NumOut() == 2) && (fnType.Out(1) == errorType)
+}
+
+// HelperError is the error returned by template execution when a helper or a context function returns a non-nil
+// error as its second result.
+type HelperError struct {
+	Name string  // helper or function name
+	Loc  ast.Loc // location of the call in template source
+	Err  error   // error returned by helper
+}
+
+// Error implements the error interface.
+func (err *HelperError) Error() string {
+	return fmt.Sprintf("Evaluation error on line %d: Helper '%s' failed: %s", err.Loc.Line, err.Name, err.Err)
+}
+
+// Unwrap returns the error returned by helper.
+func (err *HelperError) Unwrap() error {
+	return err.Err
+}
+
+// anyParamsHelper creates a helper that only takes an *Options argument, but accepts any number of parameters
+func anyParamsHelper(fn func(*Options) interface{}) *Helper {
+	helper := CreateHelper(fn)
+	helper.anyParams = true
+	return helper
+}
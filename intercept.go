@@ -0,0 +1,289 @@
+package mario
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/imantung/mario/ast"
+)
+
+// RenderCall describes a template execution.
+type RenderCall struct {
+	Template *Template
+	Ctx      interface{}
+	Data     *DataFrame
+	Duration time.Duration // set when next() returns
+}
+
+// HelperCall describes a helper invocation.
+type HelperCall struct {
+	Name     string
+	Params   []interface{}
+	Hash     map[string]interface{}
+	Options  *Options
+	Duration time.Duration // set when next() returns
+}
+
+// PartialCall describes a partial include.
+type PartialCall struct {
+	Name     string
+	Template *Template
+	Ctx      interface{}   // partial context
+	Duration time.Duration // set when next() returns
+}
+
+// RenderInterceptor is called around a template execution. It can skip rendering by not calling next(), or replace
+// the evaluation error. A panic during evaluation is seen as an error returned by next().
+type RenderInterceptor func(call *RenderCall, next func() error) error
+
+// HelperInterceptor is called around a helper invocation. It can short-circuit the helper by not calling next(),
+// or replace its result or error. A panicking helper is seen as an error returned by next().
+type HelperInterceptor func(call *HelperCall, next func() (interface{}, error)) (interface{}, error)
+
+// PartialInterceptor is called around a partial include. It can short-circuit the partial by not calling next(),
+// or replace its output or error. A panic during partial evaluation is seen as an error returned by next().
+type PartialInterceptor func(call *PartialCall, next func() (string, error)) (string, error)
+
+// interceptors holds all interceptors registered on a template
+type interceptors struct {
+	render  []RenderInterceptor
+	helper  []HelperInterceptor
+	partial []PartialInterceptor
+}
+
+// WithRenderInterceptor adds an interceptor called around each execution of template. Interceptors are called in
+// registration order, the first one being the outermost.
+func (tpl *Template) WithRenderInterceptor(fn RenderInterceptor) *Template {
+	tpl.interceptors.render = append(tpl.interceptors.render, fn)
+	return tpl
+}
+
+// WithHelperInterceptor adds an interceptor called around each helper invocation, including in partials. Interceptors
+// are called in registration order, the first one being the outermost.
+func (tpl *Template) WithHelperInterceptor(fn HelperInterceptor) *Template {
+	tpl.interceptors.helper = append(tpl.interceptors.helper, fn)
+	return tpl
+}
+
+// WithPartialInterceptor adds an interceptor called around each partial include, including in partials. Interceptors
+// are called in registration order, the first one being the outermost.
+func (tpl *Template) WithPartialInterceptor(fn PartialInterceptor) *Template {
+	tpl.interceptors.partial = append(tpl.interceptors.partial, fn)
+	return tpl
+}
+
+// interceptRender executes template through render interceptors
+func (tpl *Template) interceptRender(w io.Writer, ctx interface{}, frame *DataFrame, render func() error) error {
+	call := &RenderCall{
+		Template: tpl,
+		Ctx:      ctx,
+		Data:     frame,
+	}
+
+	next := func() (err error) {
+		start := time.Now()
+		defer func() { call.Duration = time.Since(start) }()
+		defer interceptRecover(&err)
+
+		return render()
+	}
+
+	for i := len(tpl.interceptors.render) - 1; i >= 0; i-- {
+		fn, inner := tpl.interceptors.render[i], next
+		next = func() error {
+			return fn(call, inner)
+		}
+	}
+
+	return next()
+}
+
+// interceptHelper invokes helper through helper interceptors
+func (v *evaluator) interceptHelper(name string, helper *Helper, node *ast.Expression, options *Options) interface{} {
+	call := &HelperCall{
+		Name:    name,
+		Params:  options.Params(),
+		Hash:    options.Hash(),
+		Options: options,
+	}
+
+	var helperErr error
+
+	next := func() (result interface{}, err error) {
+		start := time.Now()
+		defer func() { call.Duration = time.Since(start) }()
+		defer func() {
+			helperErr = err
+		}()
+		defer v.restoreOnError(&err)()
+		defer interceptRecover(&err)
+
+		value := v.callHelperFunc(name, helper, options, node)
+		if value.IsValid() {
+			result = value.Interface()
+		}
+
+		return result, nil
+	}
+
+	for i := len(v.interceptors.helper) - 1; i >= 0; i-- {
+		fn, inner := v.interceptors.helper[i], next
+		next = func() (interface{}, error) {
+			return fn(call, inner)
+		}
+	}
+
+	result, err := next()
+	if err != nil {
+		if err == helperErr {
+			// helper error, already contextualized
+			panic(err)
+		}
+
+		v.at(node)
+		v.panic(err)
+	}
+
+	return result
+}
+
+// interceptPartial evaluates partial through partial interceptors
+func (v *evaluator) interceptPartial(name string, partialTpl *Template, node *ast.PartialStatement, ctx reflect.Value) string {
+	call := &PartialCall{
+		Name:     name,
+		Template: partialTpl,
+		Ctx:      debugInterface(ctx),
+	}
+	if !ctx.IsValid() {
+		call.Ctx = debugInterface(v.curCtx())
+	}
+
+	var partialErr error
+
+	next := func() (result string, err error) {
+		start := time.Now()
+		defer func() { call.Duration = time.Since(start) }()
+		defer func() {
+			partialErr = err
+		}()
+		defer v.restoreOnError(&err)()
+		defer interceptRecover(&err)
+
+		return v.renderPartial(partialTpl, node, ctx), nil
+	}
+
+	for i := len(v.interceptors.partial) - 1; i >= 0; i-- {
+		fn, inner := v.interceptors.partial[i], next
+		next = func() (string, error) {
+			return fn(call, inner)
+		}
+	}
+
+	result, err := next()
+	if err != nil {
+		if err == partialErr {
+			// partial evaluation error, already contextualized
+			panic(err)
+		}
+
+		v.at(node)
+		v.panic(err)
+	}
+
+	return result
+}
+
+// interceptRecover recovers any panic of an intercepted call as an error returned by next(), wrapping a value that is
+// not an error
+func interceptRecover(errp *error) {
+	if e := recover(); e != nil {
+		if err, ok := e.(error); ok {
+			*errp = err
+		} else {
+			*errp = fmt.Errorf("panic: %v", e)
+		}
+	}
+}
+
+// evalState is a snapshot of evaluator stacks
+type evalState struct {
+	ctx              int
+	dataFrame        *DataFrame
+	blockParams      int
+	blockParamsPaths int
+	blocks           int
+	exprs            int
+	helperCalls      helperCalls
+	partialDepth     int
+	lookups          int
+	overrides        int
+	curNode          ast.Node
+	tracer           traceState
+	profile          profileState
+}
+
+// saveState returns a snapshot of evaluator stacks
+func (v *evaluator) saveState() evalState {
+	s := evalState{
+		ctx:              len(v.ctx),
+		dataFrame:        v.dataFrame,
+		blockParams:      len(v.blockParams),
+		blockParamsPaths: len(v.blockParamsPaths),
+		blocks:           len(v.blocks),
+		exprs:            len(v.exprs),
+		helperCalls:      v.helperCalls,
+		partialDepth:     v.partialDepth,
+		lookups:          len(v.lookups),
+		overrides:        len(v.overrides),
+		curNode:          v.curNode,
+	}
+
+	if v.tracer != nil {
+		s.tracer = v.tracer.state()
+	}
+
+	if v.profile != nil {
+		s.profile = v.profile.state()
+	}
+
+	return s
+}
+
+// restoreState restores evaluator stacks to given snapshot
+func (v *evaluator) restoreState(s evalState) {
+	v.ctx = v.ctx[:s.ctx]
+	v.dataFrame = s.dataFrame
+	v.blockParams = v.blockParams[:s.blockParams]
+	v.blockParamsPaths = v.blockParamsPaths[:s.blockParamsPaths]
+	v.blocks = v.blocks[:s.blocks]
+	v.exprs = v.exprs[:s.exprs]
+	v.helperCalls = s.helperCalls
+	v.partialDepth = s.partialDepth
+	v.lookups = v.lookups[:s.lookups]
+	v.overrides = v.overrides[:s.overrides]
+	v.curNode = s.curNode
+
+	if v.tracer != nil {
+		v.tracer.restore(s.tracer)
+	}
+
+	if v.profile != nil {
+		v.profile.restore(s.profile)
+	}
+}
+
+// restoreOnError returns a function that restores evaluator stacks to their current state if an error was recovered,
+// so that evaluation can go on when an interceptor ignores that error
+func (v *evaluator) restoreOnError(errp *error) func() {
+	state := v.saveState()
+
+	return func() {
+		if *errp == nil {
+			return
+		}
+
+		v.restoreState(state)
+	}
+}
@@ -0,0 +1,201 @@
+package mario_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_WithHelperInterceptor(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse("{{upper name}} {{lower name}} {{#each items}}{{upper this}}{{/each}}"))
+	tpl.WithHelperFunc("upper", strings.ToUpper)
+	tpl.WithHelperFunc("lower", strings.ToLower)
+
+	var log []string
+
+	// audit
+	tpl.WithHelperInterceptor(func(call *mario.HelperCall, next func() (interface{}, error)) (interface{}, error) {
+		result, err := next()
+		log = append(log, fmt.Sprintf("%s%v=%v", call.Name, call.Params, result))
+		return result, err
+	})
+
+	// mock
+	tpl.WithHelperInterceptor(func(call *mario.HelperCall, next func() (interface{}, error)) (interface{}, error) {
+		if call.Name == "lower" {
+			return "mocked", nil
+		}
+		return next()
+	})
+
+	var b strings.Builder
+	err := tpl.Execute(&b, map[string]interface{}{"name": "Mario", "items": []string{"a"}})
+	require.NoError(t, err)
+	require.Equal(t, "MARIO mocked A", b.String())
+
+	require.Equal(t, []string{"upper[Mario]=MARIO", "lower[Mario]=mocked", "upper[a]=A", "each[[a]]=A"}, log)
+}
+
+func TestTemplate_WithHelperInterceptor_Error(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse("{{#fail}}{{name}}{{/fail}}|{{name}}"))
+	tpl.WithHelperFunc("fail", func(options *mario.Options) string {
+		options.FnWith(map[string]string{"name": "inner"})
+		panic(errors.New("failed"))
+	})
+
+	var helperErr error
+	tpl.WithHelperInterceptor(func(call *mario.HelperCall, next func() (interface{}, error)) (interface{}, error) {
+		result, err := next()
+		if err != nil {
+			helperErr = err
+			return "fallback", nil
+		}
+		return result, nil
+	})
+
+	var b strings.Builder
+	err := tpl.Execute(&b, map[string]string{"name": "outer"})
+	require.NoError(t, err)
+	require.EqualError(t, helperErr, "failed")
+	require.Equal(t, "fallback|outer", b.String())
+
+	// interceptor error
+	tpl = mario.Must(mario.New().Parse("{{upper name}}"))
+	tpl.WithHelperFunc("upper", strings.ToUpper)
+	tpl.WithHelperInterceptor(func(call *mario.HelperCall, next func() (interface{}, error)) (interface{}, error) {
+		return nil, errors.New("forbidden")
+	})
+
+	err = tpl.Execute(&b, nil)
+	require.EqualError(t, err, "Evaluation error: Expr{Path:Path{Original:'upper', Pos:2}, Pos:0}: forbidden")
+}
+
+func TestTemplate_WithHelperInterceptor_Panic(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse("{{boom}}|{{name}}"))
+	tpl.WithHelperFunc("boom", func() string {
+		panic("kaboom")
+	})
+
+	var helperErr error
+	tpl.WithHelperInterceptor(func(call *mario.HelperCall, next func() (interface{}, error)) (interface{}, error) {
+		result, err := next()
+		if err != nil {
+			helperErr = err
+			return "fallback", nil
+		}
+		return result, nil
+	})
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, map[string]string{"name": "Mario"}))
+	require.EqualError(t, helperErr, "panic: kaboom")
+	require.Equal(t, "fallback|Mario", b.String())
+
+	// not intercepted panic
+	tpl = mario.Must(mario.New().Parse("{{boom}}"))
+	tpl.WithHelperFunc("boom", func() string {
+		panic("kaboom")
+	})
+	tpl.WithHelperInterceptor(func(call *mario.HelperCall, next func() (interface{}, error)) (interface{}, error) {
+		return next()
+	})
+
+	err := tpl.Execute(&b, nil)
+	require.EqualError(t, err, "panic: kaboom")
+}
+
+func TestTemplate_WithPartialInterceptor(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse("{{> header title=name}}{{> body}}"))
+	tpl.WithPartial("header", mario.Must(mario.New().Parse("<h1>{{title}}</h1>")))
+	tpl.WithPartial("body", mario.Must(mario.New().Parse("<p>{{name}}</p>")))
+
+	var calls []string
+	tpl.WithPartialInterceptor(func(call *mario.PartialCall, next func() (string, error)) (string, error) {
+		calls = append(calls, fmt.Sprintf("%s %v", call.Name, call.Ctx))
+		if call.Name == "body" {
+			return "<p>skipped</p>", nil
+		}
+
+		result, err := next()
+		return strings.ToUpper(result), err
+	})
+
+	var b strings.Builder
+	err := tpl.Execute(&b, map[string]string{"name": "Mario"})
+	require.NoError(t, err)
+	require.Equal(t, "<H1>MARIO</H1><p>skipped</p>", b.String())
+	require.Equal(t, []string{"header map[title:Mario]", "body map[name:Mario]"}, calls)
+}
+
+func TestTemplate_WithRenderInterceptor(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse("{{name}}{{> missing}}"))
+
+	var events []string
+	tpl.WithRenderInterceptor(func(call *mario.RenderCall, next func() error) error {
+		events = append(events, "start")
+		err := next()
+		events = append(events, fmt.Sprintf("end %v", err))
+		return err
+	})
+
+	var b strings.Builder
+	err := tpl.Execute(&b, map[string]string{"name": "Mario"})
+	require.EqualError(t, err, "Evaluation error: Partial{Name:Path{Original:'missing', Pos:12}, Pos:8}: Partial not found: missing")
+	require.Equal(t, []string{"start", "end Evaluation error: Partial{Name:Path{Original:'missing', Pos:12}, Pos:8}: Partial not found: missing"}, events)
+
+	// short-circuit
+	tpl = mario.Must(mario.New().Parse("{{name}}"))
+	tpl.WithRenderInterceptor(func(call *mario.RenderCall, next func() error) error {
+		if call.Ctx == nil {
+			return errors.New("no context")
+		}
+		return next()
+	})
+
+	err = tpl.Execute(&b, nil)
+	require.EqualError(t, err, "no context")
+}
+
+func TestTemplate_WithPartialInterceptor_IgnoredError(t *testing.T) {
+	tpl := mario.Must(mario.New().WithTrackIds().Parse("{{> list}}|{{#with user}}{{path name}}{{/with}}|{{path item}}"))
+	tpl.WithPartial("list", mario.Must(mario.New().Parse("{{#each items as |item|}}{{fail item}}{{/each}}")))
+	tpl.WithHelperFunc("fail", func(item string) (string, error) {
+		return "", errors.New("failed on " + item)
+	})
+	tpl.WithHelperFunc("path", func(value interface{}, options *mario.Options) string {
+		return fmt.Sprintf("%s:%s", mario.Str(value), options.ParamPath(0))
+	})
+
+	var errs []string
+	tpl.WithPartialInterceptor(func(call *mario.PartialCall, next func() (string, error)) (string, error) {
+		result, err := next()
+		if err != nil {
+			errs = append(errs, err.Error())
+			return "error", nil
+		}
+		return result, nil
+	})
+
+	ctx := map[string]interface{}{
+		"items": []string{"a"},
+		"user":  map[string]string{"name": "Mario"},
+	}
+
+	var b strings.Builder
+	trace, err := tpl.ExecuteTrace(&b, ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, "error|Mario:name|:item", b.String())
+	require.Equal(t, []string{"Evaluation error on line 1: Helper 'fail' failed: failed on a"}, errs)
+
+	// ignored partial output is attributed to the partial statement
+	require.Len(t, trace.Spans, 5)
+	require.Equal(t, "partial", trace.Spans[0].Type)
+	require.Empty(t, trace.Spans[0].Children)
+	require.Equal(t, "block", trace.Spans[2].Type)
+	require.Len(t, trace.Spans[2].Children, 1)
+	require.Equal(t, "", trace.Spans[2].Children[0].Template)
+}
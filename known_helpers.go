@@ -0,0 +1,172 @@
+package mario
+
+import (
+	"sort"
+
+	"github.com/imantung/mario/ast"
+	"github.com/imantung/mario/parser"
+)
+
+// Known helpers
+//
+// Like handlebars.js `knownHelpers` and `knownHelpersOnly` compile options, expressions calling a helper that is known
+// at parse time are resolved once, when parsing, instead of on each execution. Globally registered helpers, and helpers
+// registered on template before Parse(), are always known.
+//
+// References:
+//   - https://github.com/wycats/handlebars.js/blob/master/lib/handlebars/compiler/compiler.js (classifySexpr)
+
+// WithKnownHelpers declares helpers that are known to exist at execution time, in addition to globally registered
+// helpers. It must be called before Parse().
+//
+// Expressions calling a known helper are resolved when parsing, so that executing them doesn't look up the helper by
+// name. A known helper can be registered on template after Parse(), but execution fails if it is not registered.
+func (tpl *Template) WithKnownHelpers(names ...string) *Template {
+	if tpl.knownHelpers == nil {
+		tpl.knownHelpers = make(map[string]bool)
+	}
+
+	for _, name := range names {
+		tpl.knownHelpers[name] = true
+	}
+
+	return tpl
+}
+
+// WithKnownHelpersOnly restricts helpers to known ones. It must be called before Parse().
+//
+// Parse() then fails on an expression with params or hash that calls an unknown helper, and expressions without params
+// nor hash that are not known helper calls are only looked up in context.
+func (tpl *Template) WithKnownHelpersOnly() *Template {
+	tpl.knownHelpersOnly = true
+	return tpl
+}
+
+// knownHelpersNames returns the sorted names of helpers declared as known with WithKnownHelpers()
+func (tpl *Template) knownHelpersNames() []string {
+	result := make([]string, 0, len(tpl.knownHelpers))
+	for name := range tpl.knownHelpers {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// helperCall is the resolution when parsing of an expression that may call a helper
+type helperCall struct {
+	expr     *ast.Expression
+	name     string
+	resolved bool    // resolved as a known helper call, or as a context lookup in knownHelpersOnly mode
+	known    bool    // known helper call
+	helper   *Helper // called helper, nil until a known helper is registered
+}
+
+// helperCalls holds expressions resolutions of a program, by expression index
+type helperCalls []helperCall
+
+// lookup returns the resolution of given expression, or nil if that expression is resolved at execution time
+func (calls helperCalls) lookup(node *ast.Expression) *helperCall {
+	if (node.Index < 1) || (node.Index > len(calls)) {
+		return nil
+	}
+
+	// expression may belong to another template, like a partial block or an inline partial
+	call := &calls[node.Index-1]
+	if (call.expr != node) || !call.resolved {
+		return nil
+	}
+
+	return call
+}
+
+// register sets helper called by known helper calls with given name
+func (calls helperCalls) register(name string, helper *Helper) {
+	for i := range calls {
+		if calls[i].known && (calls[i].name == name) {
+			calls[i].helper = helper
+		}
+	}
+}
+
+// knownHelper returns the helper with given name and true if it is known at parse time. Returned helper is nil if a
+// helper declared as known is not registered yet.
+func (tpl *Template) knownHelper(name string) (*Helper, bool) {
+	if helper, ok := tpl.helpers[name]; ok {
+		return helper, true
+	}
+
+	if helper, ok := helpers[name]; ok {
+		return helper, true
+	}
+
+	return nil, tpl.knownHelpers[name]
+}
+
+// resolveHelperCalls indexes expressions of given program that may call a helper, and resolves those that are known
+// helper calls, and those that can't be helper calls in knownHelpersOnly mode. Other expressions are resolved at
+// execution time.
+func (tpl *Template) resolveHelperCalls(program *ast.Program) (helperCalls, error) {
+	var result helperCalls
+	var err error
+
+	ast.Walk(program, func(node ast.Node, parents []ast.Node) bool {
+		expr, ok := node.(*ast.Expression)
+		if !ok || (err != nil) {
+			return err == nil
+		}
+
+		name := expr.HelperName()
+		if (name == "") || isBlockParamName(name, parents) {
+			return true
+		}
+
+		// indexes are the same for all templates sharing that program
+		if index := len(result) + 1; expr.Index != index {
+			expr.Index = index
+		}
+
+		call := helperCall{expr: expr, name: name}
+
+		helper, known := tpl.knownHelper(name)
+
+		switch {
+		case known:
+			call.resolved, call.known, call.helper = true, true, helper
+		case !tpl.knownHelpersOnly:
+			// resolved at execution time
+		case (len(expr.Params) > 0) || (expr.Hash != nil):
+			err = &parser.Error{
+				Message: "You specified knownHelpersOnly, but used the unknown helper " + name,
+				Loc:     expr.Location(),
+			}
+		default:
+			call.resolved = true
+		}
+
+		result = append(result, call)
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// isBlockParamName returns true if given name is a block parameter of one of given parent nodes
+func isBlockParamName(name string, parents []ast.Node) bool {
+	for _, parent := range parents {
+		if program, ok := parent.(*ast.Program); ok {
+			for _, param := range program.BlockParams {
+				if param == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
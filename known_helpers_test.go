@@ -0,0 +1,138 @@
+package mario_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/imantung/mario/parser"
+	"github.com/stretchr/testify/require"
+)
+
+func fooHelper() string {
+	return "helper"
+}
+
+func TestKnownHelpersOnly_UnknownHelper(t *testing.T) {
+	_, err := mario.New().WithKnownHelpersOnly().Parse("foo\n{{#if ok}}{{foo bar}}{{/if}}")
+	require.Error(t, err)
+
+	perr, ok := err.(*parser.Error)
+	require.True(t, ok)
+	require.Equal(t, "You specified knownHelpersOnly, but used the unknown helper foo", perr.Message)
+	require.Equal(t, 2, perr.Loc.Line)
+
+	_, err = mario.New().WithKnownHelpersOnly().WithKnownHelpers("foo").Parse(`{{foo bar}} {{#each items as |item|}}{{item}}{{/each}}`)
+	require.NoError(t, err)
+}
+
+func TestKnownHelpers(t *testing.T) {
+	ctx := map[string]string{"foo": "context"}
+
+	for _, test := range []struct {
+		name     string
+		tpl      *mario.Template
+		expected string
+	}{
+		{"runtime resolution", mario.New(), "helper"},
+		{"known helper", mario.New().WithKnownHelpers("foo"), "helper"},
+		{"unknown helper is only looked up in context", mario.New().WithKnownHelpersOnly(), "context"},
+	} {
+		tpl := mario.Must(test.tpl.Parse(`{{foo}}`)).WithHelperFunc("foo", fooHelper)
+
+		var b strings.Builder
+		require.NoError(t, tpl.Execute(&b, ctx), test.name)
+		require.Equal(t, test.expected, b.String(), test.name)
+	}
+}
+
+func TestKnownHelpers_NotRegistered(t *testing.T) {
+	ctx := map[string]string{"foo": "context"}
+
+	tpl := mario.Must(mario.New().WithKnownHelpers("foo").Parse(`{{foo}}`))
+
+	err := tpl.Execute(&strings.Builder{}, ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Known helper not registered: foo")
+
+	// global helper removed after parsing was resolved when parsing
+	mario.RegisterHelper("foo", fooHelper)
+	defer mario.ResetHelpers()
+
+	tpl = mario.Must(mario.New().Parse(`{{foo}}`))
+	mario.ResetHelpers()
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, ctx))
+	require.Equal(t, "helper", b.String())
+}
+
+func TestKnownHelpers_Override(t *testing.T) {
+	mario.RegisterHelper("foo", fooHelper)
+	defer mario.ResetHelpers()
+
+	tpl := mario.Must(mario.New().Parse(`{{foo}}`)).WithHelperFunc("foo", func() string { return "override" })
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, nil))
+	require.Equal(t, "override", b.String())
+}
+
+func TestKnownHelpersOnly_ParseProgram(t *testing.T) {
+	program := mario.Must(mario.New().Parse(`{{foo bar}}`)).Program()
+
+	_, err := mario.New().WithKnownHelpersOnly().ParseProgram(program)
+	require.EqualError(t, err, "Parse error on line 1:\nYou specified knownHelpersOnly, but used the unknown helper foo")
+
+	tpl, err := mario.New().WithKnownHelpersOnly().WithKnownHelpers("foo").ParseProgram(program)
+	require.NoError(t, err)
+
+	var b strings.Builder
+	require.NoError(t, tpl.WithHelperFunc("foo", strings.ToUpper).Execute(&b, map[string]string{"bar": "baz"}))
+	require.Equal(t, "BAZ", b.String())
+
+	require.Panics(t, func() { mario.New().WithKnownHelpersOnly().WithProgram(program) })
+}
+
+func TestKnownHelpers_Partial(t *testing.T) {
+	partial := mario.Must(mario.New().WithKnownHelpersOnly().Parse(`{{foo}}`))
+
+	tpl := mario.Must(mario.New().WithKnownHelpers("foo").Parse(`{{foo}} {{> partial}}`)).
+		WithHelperFunc("foo", fooHelper).
+		WithPartial("partial", partial)
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, map[string]string{"foo": "context"}))
+	require.Equal(t, "helper context", b.String())
+}
+
+func TestKnownHelpersOnly_Analyze(t *testing.T) {
+	tpl := mario.Must(mario.New().WithKnownHelpersOnly().Parse(`{{foo}} {{#if bar}}{{/if}}`)).WithHelperFunc("foo", fooHelper)
+
+	analysis := tpl.Analyze()
+	require.Equal(t, []string{"if"}, analysis.Helpers)
+}
+
+func BenchmarkKnownHelpers(b *testing.B) {
+	source := strings.Repeat(`{{foo}} {{#if bar}}{{foo}} {{baz}}{{/if}}`, 100)
+
+	for _, bench := range []struct {
+		name string
+		tpl  *mario.Template
+	}{
+		{"runtime resolution", mario.New()},
+		{"known helpers", mario.New().WithKnownHelpers("foo")},
+		{"known helpers only", mario.New().WithKnownHelpersOnly().WithKnownHelpers("foo")},
+	} {
+		tpl := mario.Must(bench.tpl.Parse(source)).WithHelperFunc("foo", fooHelper)
+
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := tpl.Execute(ioutil.Discard, map[string]interface{}{"bar": true, "baz": "baz"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package lexer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Default delimiters
+const (
+	DefaultOpenDelim  = "{{"
+	DefaultCloseDelim = "}}"
+)
+
+// delimiters holds mustaches strings and regular expressions built for given open and close delimiters.
+//
+// In the comments, delimiters are the default ones: {{ and }}
+type delimiters struct {
+	open  string
+	close string
+
+	// mustaches detection
+	escapedEscapedOpen   string // \\{{
+	escapedOpen          string // \{{
+	closeStrip           string // ~}}
+	closeUnescaped       string // }}}
+	closeUnescapedStrip  string // }~}}
+	closeRaw             string // }}}}
+	openComment          string // {{!
+	openCommentStrip     string // {{~!
+	openCommentDash      string // {{!--
+	openCommentStripDash string // {{~!--
+	openSetDelims        string // {{=
+	closeSetDelims       string // =}}
+	contentStops         string // characters that can start a mustache or an escape in content: {\
+	commentStops         string // characters that can start the close of a comment: whitespaces, -~}
+
+	// regular expressions
+	rRawBlockTag      *regexp.Regexp // {{{{ or {{{{/
+	rInverse          *regexp.Regexp // {{^}} or {{else}}
+	rOpenInverseChain *regexp.Regexp
+	rCloseCommentDash *regexp.Regexp // --}} or --~}}
+	rCloseComment     *regexp.Regexp // }} or ~}}
+}
+
+var (
+	defaultDelims = mustDelimiters(DefaultOpenDelim, DefaultCloseDelim)
+
+	// delimiters already built, by "open close"
+	delimsCache sync.Map
+)
+
+// ValidateDelims returns an error if given delimiters can't be used
+func ValidateDelims(open string, close string) error {
+	if (open == "") || (close == "") {
+		return fmt.Errorf("Invalid delimiters %q %q: delimiters can't be empty", open, close)
+	}
+
+	if strings.ContainsAny(open+close, " \t\r\n=") {
+		return fmt.Errorf("Invalid delimiters %q %q: delimiters can't contain whitespaces or '='", open, close)
+	}
+
+	return nil
+}
+
+// getDelimiters returns delimiters for given open and close strings
+func getDelimiters(open string, close string) (*delimiters, error) {
+	if (open == DefaultOpenDelim) && (close == DefaultCloseDelim) {
+		return defaultDelims, nil
+	}
+
+	key := open + " " + close
+	if result, ok := delimsCache.Load(key); ok {
+		return result.(*delimiters), nil
+	}
+
+	if err := ValidateDelims(open, close); err != nil {
+		return nil, err
+	}
+
+	result, _ := delimsCache.LoadOrStore(key, mustDelimiters(open, close))
+
+	return result.(*delimiters), nil
+}
+
+// mustDelimiters builds delimiters for given open and close strings
+func mustDelimiters(open string, close string) *delimiters {
+	o := regexp.QuoteMeta(open)
+	c := regexp.QuoteMeta(close)
+
+	return &delimiters{
+		open:  open,
+		close: close,
+
+		escapedEscapedOpen:   `\\` + open,
+		escapedOpen:          `\` + open,
+		closeStrip:           "~" + close,
+		closeUnescaped:       "}" + close,
+		closeUnescapedStrip:  "}~" + close,
+		closeRaw:             "}}" + close,
+		openComment:          open + "!",
+		openCommentStrip:     open + "~!",
+		openCommentDash:      open + "!--",
+		openCommentStripDash: open + "~!--",
+		openSetDelims:        open + "=",
+		closeSetDelims:       "=" + close,
+		contentStops:         string([]rune(open)[0]) + `\`,
+		commentStops:         " \t\n\f\r-~" + string([]rune(close)[0]),
+
+		rRawBlockTag:      regexp.MustCompile(o + `\{\{(/?)`),
+		rInverse:          regexp.MustCompile(`^(` + o + `~?\^\s*~?` + c + `|` + o + `~?\s*else\s*~?` + c + `)`),
+		rOpenInverseChain: regexp.MustCompile(`^` + o + `~?\s*else`),
+		rCloseCommentDash: regexp.MustCompile(`^\s*--~?` + c),
+		rCloseComment:     regexp.MustCompile(`^\s*~?` + c),
+	}
+}
+
+// isClose returns true if given string starts with a close mustache
+func (d *delimiters) isClose(str string) bool {
+	return strings.HasPrefix(str, d.close) ||
+		strings.HasPrefix(str, d.closeStrip) ||
+		strings.HasPrefix(str, d.closeUnescaped) ||
+		strings.HasPrefix(str, d.closeUnescapedStrip) ||
+		strings.HasPrefix(str, d.closeRaw)
+}
+
+// ParseSetDelims parses the content of a set delimiters tag, ie. `<% %>` in `{{=<% %>=}}`, and returns the new open
+// and close delimiters.
+func ParseSetDelims(content string) (string, string, error) {
+	fields := strings.Fields(content)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("Invalid set delimiters tag: %q", content)
+	}
+
+	if err := ValidateDelims(fields[0], fields[1]); err != nil {
+		return "", "", err
+	}
+
+	return fields[0], fields[1], nil
+}
@@ -13,96 +13,103 @@ import (
 //   - https://github.com/wycats/handlebars.js/blob/master/src/handlebars.l
 //   - https://github.com/golang/go/blob/master/src/text/template/parse/lex.go
 
-const (
-	// Mustaches detection
-	escapedEscapedOpenMustache  = "\\\\{{"
-	escapedOpenMustache         = "\\{{"
-	openMustache                = "{{"
-	closeMustache               = "}}"
-	closeStripMustache          = "~}}"
-	closeUnescapedStripMustache = "}~}}"
-	openComment                 = "{{!"
-	openCommentStrip            = "{{~!"
-	openCommentDash             = "{{!--"
-	openCommentStripDash        = "{{~!--"
-)
-
 const eof = -1
 
 // lexFunc represents a function that returns the next lexer function.
 type lexFunc func(*Lexer) lexFunc
 
+// Options configures a lexer.
+type Options struct {
+	// Mustache enables Mustache compatibility: set delimiters tags, dynamic partials names and inheritance tags are
+	// scanned, and backslash escapes are not
+	Mustache bool
+
+	// Delims are the open and close delimiters, default to {{ and }}
+	Delims [2]string
+
+	// Recover makes the lexer resume scanning after an error token, at the end of the erroneous tag, instead of
+	// stopping. Invalid delimiters still stop scanning.
+	Recover bool
+}
+
 // Lexer is a lexical analyzer.
+//
+// Tokens are scanned on demand, in the goroutine calling NextToken().
 type Lexer struct {
-	input    string     // input to scan
-	name     string     // lexer name, used for testing purpose
-	tokens   chan Token // channel of scanned tokens
-	nextFunc lexFunc    // the next function to execute
+	input    string  // input to scan
+	name     string  // lexer name, used for testing purpose
+	tokens   []Token // scanned tokens, not fetched yet
+	head     int     // index of next token to fetch in tokens
+	last     Token   // last fetched token
+	nextFunc lexFunc // the next function to execute
 
 	pos   int // current byte position in input string
 	line  int // current line position in input string
 	width int // size of last rune scanned from input string
 	start int // start position of the token we are scanning
 
+	mustache bool        // mustache compatibility mode
+	recover  bool        // resume scanning after errors
+	delims   *delimiters // current delimiters
+
 	// the shameful contextual properties needed because `nextFunc` is not enough
 	closeComment *regexp.Regexp // regexp to scan close of current comment
 	rawBlock     bool           // are we parsing a raw block content ?
 }
 
 var (
-	lookheadChars        = `[\s` + regexp.QuoteMeta("=~}/)|") + `]`
-	literalLookheadChars = `[\s` + regexp.QuoteMeta("~})") + `]`
+	// characters, with whitespaces, that can follow a `.` path and a literal
+	lookheadChars        = "=~}/)|"
+	literalLookheadChars = "~})"
 
 	// characters not allowed in an identifier
 	unallowedIDChars = " \n\t!\"#%&'()*+,./;<=>@[\\]^`{|}~"
 
 	// regular expressions
-	rID                  = regexp.MustCompile(`^[^` + regexp.QuoteMeta(unallowedIDChars) + `]+`)
-	rDotID               = regexp.MustCompile(`^\.` + lookheadChars)
-	rTrue                = regexp.MustCompile(`^true` + literalLookheadChars)
-	rFalse               = regexp.MustCompile(`^false` + literalLookheadChars)
-	rOpenRaw             = regexp.MustCompile(`^\{\{\{\{`)
-	rCloseRaw            = regexp.MustCompile(`^\}\}\}\}`)
-	rOpenEndRaw          = regexp.MustCompile(`^\{\{\{\{/`)
-	rOpenEndRawLookAhead = regexp.MustCompile(`\{\{\{\{/`)
-	rOpenUnescaped       = regexp.MustCompile(`^\{\{~?\{`)
-	rCloseUnescaped      = regexp.MustCompile(`^\}~?\}\}`)
-	rOpenBlock           = regexp.MustCompile(`^\{\{~?#`)
-	rOpenEndBlock        = regexp.MustCompile(`^\{\{~?/`)
-	rOpenPartial         = regexp.MustCompile(`^\{\{~?>`)
-	// {{^}} or {{else}}
-	rInverse          = regexp.MustCompile(`^(\{\{~?\^\s*~?\}\}|\{\{~?\s*else\s*~?\}\})`)
-	rOpenInverse      = regexp.MustCompile(`^\{\{~?\^`)
-	rOpenInverseChain = regexp.MustCompile(`^\{\{~?\s*else`)
-	// {{ or {{&
-	rOpen            = regexp.MustCompile(`^\{\{~?&?`)
-	rClose           = regexp.MustCompile(`^~?\}\}`)
 	rOpenBlockParams = regexp.MustCompile(`^as\s+\|`)
-	// --}} or --~}}
-	rCloseCommentDash = regexp.MustCompile(`^\s*--~?\}\}`)
-	// }} or ~}}
-	rCloseComment = regexp.MustCompile(`^\s*~?\}\}`)
+	rDynamicPartial  = regexp.MustCompile(`^\s*\*`)
 )
 
 // Scan scans given input.
 //
 // Tokens can then be fetched sequentially thanks to NextToken() function on returned lexer.
 func Scan(input string) *Lexer {
-	return scanWithName(input, "")
+	return scanWithName(input, "", Options{})
+}
+
+// ScanWithOptions scans given input, with given options.
+//
+// Tokens can then be fetched sequentially thanks to NextToken() function on returned lexer. If delimiters are
+// invalid, the first token is an error.
+func ScanWithOptions(input string, opts Options) *Lexer {
+	return scanWithName(input, "", opts)
 }
 
 // scanWithName scans given input, with a name used for testing
 //
 // Tokens can then be fetched sequentially thanks to NextToken() function on returned lexer.
-func scanWithName(input string, name string) *Lexer {
+func scanWithName(input string, name string, opts Options) *Lexer {
 	result := &Lexer{
-		input:  input,
-		name:   name,
-		tokens: make(chan Token),
-		line:   1,
+		input:    input,
+		name:     name,
+		tokens:   make([]Token, 0, 2),
+		line:     1,
+		mustache: opts.Mustache,
+		recover:  opts.Recover,
+		nextFunc: lexContent,
 	}
 
-	go result.run()
+	if (opts.Delims[0] == "") && (opts.Delims[1] == "") {
+		result.delims = defaultDelims
+	} else {
+		delims, err := getDelimiters(opts.Delims[0], opts.Delims[1])
+		if err != nil {
+			result.errorf("%s", err)
+			result.nextFunc = nil
+			return result
+		}
+		result.delims = delims
+	}
 
 	return result
 }
@@ -111,9 +118,17 @@ func scanWithName(input string, name string) *Lexer {
 //
 // This should be used for debugging purpose only. You should use Scan() and lexer.NextToken() functions instead.
 func Collect(input string) []Token {
+	return CollectWithOptions(input, Options{})
+}
+
+// CollectWithOptions scans with given options and collect all tokens.
+//
+// This should be used for debugging purpose only. You should use ScanWithOptions() and lexer.NextToken() functions
+// instead.
+func CollectWithOptions(input string, opts Options) []Token {
 	var result []Token
 
-	l := Scan(input)
+	l := ScanWithOptions(input, opts)
 	for {
 		token := l.NextToken()
 		result = append(result, token)
@@ -126,18 +141,27 @@ func Collect(input string) []Token {
 	return result
 }
 
-// NextToken returns the next scanned token.
+// NextToken scans and returns the next token.
+//
+// Once the EOF or an error token has been returned, that token is returned again on each call.
 func (l *Lexer) NextToken() Token {
-	result := <-l.tokens
+	for l.head == len(l.tokens) {
+		if l.nextFunc == nil {
+			// scanning is over
+			return l.last
+		}
 
-	return result
-}
+		// tokens buffer is drained, reuse it
+		l.tokens = l.tokens[:0]
+		l.head = 0
 
-// run starts lexical analysis
-func (l *Lexer) run() {
-	for l.nextFunc = lexContent; l.nextFunc != nil; {
 		l.nextFunc = l.nextFunc(l)
 	}
+
+	l.last = l.tokens[l.head]
+	l.head++
+
+	return l.last
 }
 
 // next returns next character from input, or eof of there is nothing left to scan
@@ -155,7 +179,7 @@ func (l *Lexer) next() rune {
 }
 
 func (l *Lexer) produce(kind TokenKind, val string) {
-	l.tokens <- Token{kind, val, l.start, l.line}
+	l.tokens = append(l.tokens, Token{kind, val, l.start, l.line})
 
 	// scanning a new token
 	l.start = l.pos
@@ -202,6 +226,9 @@ func (l *Lexer) backup() {
 
 // ignoreskips all characters that have been scanned up to current position
 func (l *Lexer) ignore() {
+	// update line number
+	l.line += strings.Count(l.input[l.start:l.pos], "\n")
+
 	l.start = l.pos
 }
 
@@ -226,7 +253,12 @@ func (l *Lexer) acceptRun(valid string) {
 
 // errorf emits an error token
 func (l *Lexer) errorf(format string, args ...interface{}) lexFunc {
-	l.tokens <- Token{TokenError, fmt.Sprintf(format, args...), l.start, l.line}
+	l.tokens = append(l.tokens, Token{TokenError, fmt.Sprintf(format, args...), l.start, l.line})
+
+	if l.recover {
+		return lexRecover
+	}
+
 	return nil
 }
 
@@ -235,11 +267,42 @@ func (l *Lexer) isString(str string) bool {
 	return strings.HasPrefix(l.input[l.pos:], str)
 }
 
+// isStringAt returns true if content at given offset from current scanning position starts with given string
+func (l *Lexer) isStringAt(offset int, str string) bool {
+	return (l.pos+offset <= len(l.input)) && strings.HasPrefix(l.input[l.pos+offset:], str)
+}
+
+// isLiteral returns true if content at current scanning position is given literal, followed by a whitespace, one
+// of given characters or the close delimiter
+func (l *Lexer) isLiteral(literal string, followers string) bool {
+	if !l.isString(literal) {
+		return false
+	}
+
+	offset := len(literal)
+	if l.pos+offset >= len(l.input) {
+		return false
+	}
+
+	c := l.input[l.pos+offset]
+
+	return isSpace(c) || (strings.IndexByte(followers, c) != -1) || l.isStringAt(offset, l.delims.close)
+}
+
 // findRegexp returns the first string from current scanning position that matches given regular expression
 func (l *Lexer) findRegexp(r *regexp.Regexp) string {
 	return r.FindString(l.input[l.pos:])
 }
 
+// findRegexpIf returns the first string from current scanning position that matches given regular expression, if
+// given condition, that is necessary for a match, is true
+func (l *Lexer) findRegexpIf(cond bool, r *regexp.Regexp) string {
+	if !cond {
+		return ""
+	}
+	return l.findRegexp(r)
+}
+
 // indexRegexp returns the index of the first string from current scanning position that matches given regular expression
 //
 // It returns -1 if not found
@@ -251,24 +314,52 @@ func (l *Lexer) indexRegexp(r *regexp.Regexp) int {
 	return loc[0]
 }
 
+// indexRawBlockEnd returns the index in remaining input of the {{{{/ that ends current raw block, or -1 if not found.
+// Nested raw blocks are part of the content.
+func (l *Lexer) indexRawBlockEnd() int {
+	depth := 0
+
+	for _, loc := range l.delims.rRawBlockTag.FindAllStringSubmatchIndex(l.input[l.pos:], -1) {
+		if loc[3] == loc[2] {
+			// {{{{
+			depth++
+		} else if depth == 0 {
+			// {{{{/
+			return loc[0]
+		} else {
+			depth--
+		}
+	}
+
+	return -1
+}
+
 // lexContent scans content (ie: not between mustaches)
 func lexContent(l *Lexer) lexFunc {
 	var next lexFunc
 
+	d := l.delims
+
 	if l.rawBlock {
-		if i := l.indexRegexp(rOpenEndRawLookAhead); i != -1 {
+		if i := l.indexRawBlockEnd(); i != -1 {
 			// {{{{/
 			l.rawBlock = false
 			l.pos += i
 
 			next = lexOpenMustache
 		} else {
+			// nothing left to scan
+			l.pos = len(l.input)
+
 			return l.errorf("Unclosed raw block")
 		}
 	} else {
-		switch l.peek() {
-		case '\\':
-			if l.isString(escapedEscapedOpenMustache) {
+		switch {
+		case l.isString(d.openSetDelims) && l.mustache:
+			// {{=
+			next = lexSetDelims
+		case (l.peek() == '\\') && !l.mustache:
+			if l.isString(d.escapedEscapedOpen) {
 				// \\{{
 
 				// emit content with only one escaped escape
@@ -280,20 +371,20 @@ func lexContent(l *Lexer) lexFunc {
 				l.ignore()
 
 				next = lexContent
-			} else if l.isString(escapedOpenMustache) {
+			} else if l.isString(d.escapedOpen) {
 				// \{{
 				next = lexEscapedOpenMustache
 			}
-		case '{':
-			if l.isString(openCommentDash) || l.isString(openCommentStripDash) {
+		case l.isString(d.open):
+			if l.isString(d.openCommentDash) || l.isString(d.openCommentStripDash) {
 				// {{!--
-				l.closeComment = rCloseCommentDash
-				next = lexComment
-			} else if l.isString(openComment) || l.isString(openCommentStrip) {
+				l.closeComment = d.rCloseCommentDash
+				next = lexOpenComment
+			} else if l.isString(d.openComment) || l.isString(d.openCommentStrip) {
 				// {{!
-				l.closeComment = rCloseComment
-				next = lexComment
-			} else if l.isString(openMustache) {
+				l.closeComment = d.rCloseComment
+				next = lexOpenComment
+			} else {
 				// {{
 				next = lexOpenMustache
 			}
@@ -318,10 +409,43 @@ func lexContent(l *Lexer) lexFunc {
 		return nil
 	}
 
+	// skip content up to next possible mustache or escape
+	if i := strings.IndexAny(l.input[l.pos:], l.delims.contentStops); i == -1 {
+		l.pos = len(l.input)
+	} else {
+		l.pos += i
+	}
+
 	// continue content scanning
 	return lexContent
 }
 
+// lexSetDelims scans a set delimiters tag {{=<% %>=}}, emitted as a comment, and switches delimiters
+func lexSetDelims(l *Lexer) lexFunc {
+	d := l.delims
+
+	l.pos += len(d.openSetDelims)
+
+	i := strings.Index(l.input[l.pos:], d.closeSetDelims)
+	if i == -1 {
+		return l.errorf("Unclosed set delimiters tag")
+	}
+
+	open, close, err := ParseSetDelims(l.input[l.pos : l.pos+i])
+	if err != nil {
+		return l.errorf("%s", err)
+	}
+
+	if l.delims, err = getDelimiters(open, close); err != nil {
+		return l.errorf("%s", err)
+	}
+
+	l.pos += i + len(d.closeSetDelims)
+	l.emit(TokenComment)
+
+	return lexContent
+}
+
 // lexEscapedOpenMustache scans \{{
 func lexEscapedOpenMustache(l *Lexer) lexFunc {
 	// ignore escape character
@@ -329,6 +453,7 @@ func lexEscapedOpenMustache(l *Lexer) lexFunc {
 	l.ignore()
 
 	// scan mustaches
+	l.pos += len(l.delims.open)
 	for l.peek() == '{' {
 		l.next()
 	}
@@ -336,41 +461,105 @@ func lexEscapedOpenMustache(l *Lexer) lexFunc {
 	return lexContent
 }
 
+// lexRecover skips input up to the end of current tag after an error, then resumes scanning content
+func lexRecover(l *Lexer) lexFunc {
+	l.rawBlock = false
+
+	end := len(l.input)
+	if i := strings.Index(l.input[l.pos:], l.delims.close); i != -1 {
+		end = l.pos + i + len(l.delims.close)
+	}
+
+	l.pos = end
+	l.ignore()
+
+	return lexContent
+}
+
 // lexOpenMustache scans {{
 func lexOpenMustache(l *Lexer) lexFunc {
-	var str string
 	var tok TokenKind
 
 	nextFunc := lexExpression
 
-	if str = l.findRegexp(rOpenEndRaw); str != "" {
+	d := l.delims
+
+	// {{ or {{~
+	n := len(d.open)
+	if l.isStringAt(n, "~") {
+		n++
+	}
+
+	// character following open delimiter and optional strip
+	c := byte(0)
+	if l.pos+n < len(l.input) {
+		c = l.input[l.pos+n]
+	}
+
+	// length of mustache with that character
+	tagLen := n + 1
+
+	switch {
+	case l.isStringAt(len(d.open), "{{/"):
+		// {{{{/
 		tok = TokenOpenEndRawBlock
-	} else if str = l.findRegexp(rOpenRaw); str != "" {
+		n = len(d.open) + len("{{/")
+	case l.isStringAt(len(d.open), "{{"):
+		// {{{{
 		tok = TokenOpenRawBlock
+		n = len(d.open) + len("{{")
 		l.rawBlock = true
-	} else if str = l.findRegexp(rOpenUnescaped); str != "" {
+	case c == '{':
 		tok = TokenOpenUnescaped
-	} else if str = l.findRegexp(rOpenBlock); str != "" {
+		n = tagLen
+	case c == '#':
 		tok = TokenOpenBlock
-	} else if str = l.findRegexp(rOpenEndBlock); str != "" {
+		n = tagLen
+	case l.mustache && ((c == '$') || (c == '<')):
+		// {{$ block or {{< parent
+		tok = TokenOpenBlock
+		n = tagLen
+	case c == '/':
 		tok = TokenOpenEndBlock
-	} else if str = l.findRegexp(rOpenPartial); str != "" {
+		n = tagLen
+	case c == '>':
 		tok = TokenOpenPartial
-	} else if str = l.findRegexp(rInverse); str != "" {
-		tok = TokenInverse
-		nextFunc = lexContent
-	} else if str = l.findRegexp(rOpenInverse); str != "" {
-		tok = TokenOpenInverse
-	} else if str = l.findRegexp(rOpenInverseChain); str != "" {
-		tok = TokenOpenInverseChain
-	} else if str = l.findRegexp(rOpen); str != "" {
-		tok = TokenOpen
-	} else {
-		// this is rotten
-		panic("Current pos MUST be an opening mustache")
+		n = tagLen
+	default:
+		if (c == '^') || (c == 'e') || isSpace(c) {
+			// regular expressions are only tried when they can match
+			if str := l.findRegexp(d.rInverse); str != "" {
+				// {{^}} or {{else}}
+				tok = TokenInverse
+				n = len(str)
+				nextFunc = lexContent
+				break
+			}
+		}
+
+		if c == '^' {
+			tok = TokenOpenInverse
+			n = tagLen
+		} else if str := l.findRegexpIf((c == 'e') || isSpace(c), d.rOpenInverseChain); str != "" {
+			// {{else
+			tok = TokenOpenInverseChain
+			n = len(str)
+		} else {
+			// {{ or {{&
+			tok = TokenOpen
+			if c == '&' {
+				n = tagLen
+			}
+		}
+	}
+
+	l.pos += n
+
+	if (tok == TokenOpenPartial) && l.mustache {
+		// {{>* dynamic partial name
+		l.pos += len(l.findRegexp(rDynamicPartial))
 	}
 
-	l.pos += len(str)
 	l.emit(tok)
 
 	return nextFunc
@@ -381,16 +570,30 @@ func lexCloseMustache(l *Lexer) lexFunc {
 	var str string
 	var tok TokenKind
 
-	if str = l.findRegexp(rCloseRaw); str != "" {
+	d := l.delims
+
+	switch {
+	case l.isString(d.closeRaw):
 		// }}}}
+		str = d.closeRaw
 		tok = TokenCloseRawBlock
-	} else if str = l.findRegexp(rCloseUnescaped); str != "" {
+	case l.isString(d.closeUnescaped):
 		// }}}
+		str = d.closeUnescaped
 		tok = TokenCloseUnescaped
-	} else if str = l.findRegexp(rClose); str != "" {
+	case l.isString(d.closeUnescapedStrip):
+		// }~}}
+		str = d.closeUnescapedStrip
+		tok = TokenCloseUnescaped
+	case l.isString(d.closeStrip):
+		// ~}}
+		str = d.closeStrip
+		tok = TokenClose
+	case l.isString(d.close):
 		// }}
+		str = d.close
 		tok = TokenClose
-	} else {
+	default:
 		// this is rotten
 		panic("Current pos MUST be a closing mustache")
 	}
@@ -403,15 +606,17 @@ func lexCloseMustache(l *Lexer) lexFunc {
 
 // lexExpression scans inside mustaches
 func lexExpression(l *Lexer) lexFunc {
+	d := l.delims
+
 	// search close mustache delimiter
-	if l.isString(closeMustache) || l.isString(closeStripMustache) || l.isString(closeUnescapedStripMustache) {
+	if d.isClose(l.input[l.pos:]) {
 		return lexCloseMustache
 	}
 
 	// search some patterns before advancing scanning position
 
 	// "as |"
-	if str := l.findRegexp(rOpenBlockParams); str != "" {
+	if str := l.findRegexpIf(l.isString("as"), rOpenBlockParams); str != "" {
 		l.pos += len(str)
 		l.emit(TokenOpenBlockParams)
 		return lexExpression
@@ -425,26 +630,40 @@ func lexExpression(l *Lexer) lexFunc {
 	}
 
 	// .
-	if str := l.findRegexp(rDotID); str != "" {
+	if l.isLiteral(".", lookheadChars) {
 		l.pos += len(".")
 		l.emit(TokenID)
 		return lexExpression
 	}
 
 	// true
-	if str := l.findRegexp(rTrue); str != "" {
+	if l.isLiteral("true", literalLookheadChars) {
 		l.pos += len("true")
 		l.emit(TokenBoolean)
 		return lexExpression
 	}
 
 	// false
-	if str := l.findRegexp(rFalse); str != "" {
+	if l.isLiteral("false", literalLookheadChars) {
 		l.pos += len("false")
 		l.emit(TokenBoolean)
 		return lexExpression
 	}
 
+	// undefined
+	if l.isLiteral("undefined", literalLookheadChars) {
+		l.pos += len("undefined")
+		l.emit(TokenUndefined)
+		return lexExpression
+	}
+
+	// null
+	if l.isLiteral("null", literalLookheadChars) {
+		l.pos += len("null")
+		l.emit(TokenNull)
+		return lexExpression
+	}
+
 	// let's scan next character
 	switch r := l.next(); {
 	case r == eof:
@@ -481,6 +700,14 @@ func lexExpression(l *Lexer) lexFunc {
 	return lexExpression
 }
 
+// lexOpenComment skips open delimiter of a comment, so that it is not taken for the close delimiter when they are
+// the same, ie. |! comment|
+func lexOpenComment(l *Lexer) lexFunc {
+	l.pos += len(l.delims.open)
+
+	return lexComment
+}
+
 // lexComment scans {{!-- or {{!
 func lexComment(l *Lexer) lexFunc {
 	if str := l.findRegexp(l.closeComment); str != "" {
@@ -494,6 +721,13 @@ func lexComment(l *Lexer) lexFunc {
 		return l.errorf("Unclosed comment")
 	}
 
+	// skip comment up to next possible close: whitespace, dash, strip or close delimiter
+	if i := strings.IndexAny(l.input[l.pos:], l.delims.commentStops); i == -1 {
+		l.pos = len(l.input)
+	} else {
+		l.pos += i
+	}
+
 	return lexComment
 }
 
@@ -603,7 +837,16 @@ func (l *Lexer) scanNumber() bool {
 
 // lexIdentifier scans an ID
 func lexIdentifier(l *Lexer) lexFunc {
-	str := l.findRegexp(rID)
+	str := l.input[l.pos:]
+	if i := strings.IndexAny(str, unallowedIDChars); i != -1 {
+		str = str[:i]
+	}
+
+	// close delimiter may be made of identifier characters
+	if i := strings.Index(str, l.delims.close); i != -1 {
+		str = str[:i]
+	}
+
 	if len(str) == 0 {
 		// this is rotten
 		panic("Identifier expected")
@@ -633,6 +876,11 @@ func lexPathLiteral(l *Lexer) lexFunc {
 	return lexExpression
 }
 
+// isSpace returns true if given character matches \s in a regular expression
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
 // isIgnorable returns true if given character is ignorable (ie. whitespace of line feed)
 func isIgnorable(r rune) bool {
 	return r == ' ' || r == '\t' || r == '\n'
@@ -2,6 +2,8 @@ package lexer
 
 import (
 	"fmt"
+	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +21,8 @@ func tokString(val string) Token  { return Token{TokenString, val, 0, 1} }
 func tokNumber(val string) Token  { return Token{TokenNumber, val, 0, 1} }
 func tokInverse(val string) Token { return Token{TokenInverse, val, 0, 1} }
 func tokBool(val string) Token    { return Token{TokenBoolean, val, 0, 1} }
+func tokUndefined() Token         { return Token{TokenUndefined, "undefined", 0, 1} }
+func tokNull() Token              { return Token{TokenNull, "null", 0, 1} }
 func tokError(val string) Token   { return Token{TokenError, val, 0, 1} }
 func tokComment(val string) Token { return Token{TokenComment, val, 0, 1} }
 
@@ -72,6 +76,11 @@ var lexTests = []lexTest{
 		`{{{{foo}}}}{{bar}}{{{{/foo}}}}`,
 		[]Token{tokOpenRawBlock, tokID("foo"), tokCloseRawBlock, tokContent("{{bar}}"), tokOpenEndRawBlock, tokID("foo"), tokCloseRawBlock, tokEOF},
 	},
+	{
+		`tokenizes nested raw blocks as content`,
+		`{{{{foo}}}}{{{{bar}}}} {{{{/bar}}}}{{{{/foo}}}}`,
+		[]Token{tokOpenRawBlock, tokID("foo"), tokCloseRawBlock, tokContent("{{{{bar}}}} {{{{/bar}}}}"), tokOpenEndRawBlock, tokID("foo"), tokCloseRawBlock, tokEOF},
+	},
 	{
 		`tokenizes @../foo`,
 		`{{@../foo}}`,
@@ -347,7 +356,16 @@ var lexTests = []lexTest{
 		`{{ foo false }}`,
 		[]Token{tokOpen, tokID("foo"), tokBool("false"), tokClose, tokEOF},
 	},
-	// SKIP: 'tokenizes undefined and null'
+	{
+		`tokenizes undefined and null`,
+		`{{ foo undefined null }}`,
+		[]Token{tokOpen, tokID("foo"), tokUndefined(), tokNull(), tokClose, tokEOF},
+	},
+	{
+		`tokenizes undefined and null prefixed ids`,
+		`{{ nullable undefined.foo null=1 }}`,
+		[]Token{tokOpen, tokID("nullable"), tokID("undefined"), tokSep("."), tokID("foo"), tokID("null"), tokEquals, tokNumber("1"), tokClose, tokEOF},
+	},
 	{
 		`tokenizes hash arguments (1)`,
 		`{{ foo bar=baz }}`,
@@ -465,10 +483,80 @@ var lexTests = []lexTest{
 	},
 }
 
+var mustacheLexTests = []lexTest{
+	{
+		`tokenizes set delimiters tag as a comment`,
+		`{{=<% %>=}}<%foo%>{{bar}}`,
+		[]Token{tokComment("{{=<% %>=}}"), Token{TokenOpen, "<%", 0, 1}, tokID("foo"), Token{TokenClose, "%>", 0, 1}, tokContent("{{bar}}"), tokEOF},
+	},
+	{
+		`tokenizes set delimiters tag with padding`,
+		`{{= | | =}}|#foo||/foo|`,
+		[]Token{tokComment("{{= | | =}}"), Token{TokenOpenBlock, "|#", 0, 1}, tokID("foo"), Token{TokenClose, "|", 0, 1}, Token{TokenOpenEndBlock, "|/", 0, 1}, tokID("foo"), Token{TokenClose, "|", 0, 1}, tokEOF},
+	},
+	{
+		`tokenizes unescaped and comments with new delimiters`,
+		`{{=[ ]=}}[{foo}][&bar][! baz ]`,
+		[]Token{tokComment("{{=[ ]=}}"), Token{TokenOpenUnescaped, "[{", 0, 1}, tokID("foo"), Token{TokenCloseUnescaped, "}]", 0, 1}, Token{TokenOpen, "[&", 0, 1}, tokID("bar"), Token{TokenClose, "]", 0, 1}, tokComment("[! baz ]"), tokEOF},
+	},
+	{
+		`does not tokenize backslash escapes`,
+		`\{{foo}}`,
+		[]Token{tokContent(`\`), tokOpen, tokID("foo"), tokClose, tokEOF},
+	},
+	{
+		`tokenizes dynamic partial`,
+		`{{>* foo}}`,
+		[]Token{Token{TokenOpenPartial, "{{>*", 0, 1}, tokID("foo"), tokClose, tokEOF},
+	},
+	{
+		`fails on invalid set delimiters tag`,
+		`{{=<%=}}`,
+		[]Token{tokError(`Invalid set delimiters tag: "<%"`)},
+	},
+	{
+		`fails on unclosed set delimiters tag`,
+		`{{=<% %>}}`,
+		[]Token{tokError(`Unclosed set delimiters tag`)},
+	},
+}
+
+var delimsLexTests = []lexTest{
+	{
+		`tokenizes mustaches with custom delimiters`,
+		`{{foo}}<%foo%>`,
+		[]Token{tokContent("{{foo}}"), Token{TokenOpen, "<%", 0, 1}, tokID("foo"), Token{TokenClose, "%>", 0, 1}, tokEOF},
+	},
+	{
+		`tokenizes whitespace control with custom delimiters`,
+		`<%~#foo~%><%~/foo~%>`,
+		[]Token{Token{TokenOpenBlock, "<%~#", 0, 1}, tokID("foo"), Token{TokenClose, "~%>", 0, 1}, Token{TokenOpenEndBlock, "<%~/", 0, 1}, tokID("foo"), Token{TokenClose, "~%>", 0, 1}, tokEOF},
+	},
+	{
+		`tokenizes unescaped mustaches and comments with custom delimiters`,
+		`<%{foo}%><%!-- %> --%>`,
+		[]Token{Token{TokenOpenUnescaped, "<%{", 0, 1}, tokID("foo"), Token{TokenCloseUnescaped, "}%>", 0, 1}, tokComment("<%!-- %> --%>"), tokEOF},
+	},
+	{
+		`tokenizes raw blocks with custom delimiters`,
+		`<%{{raw}}%><%foo%><%{{/raw}}%>`,
+		[]Token{Token{TokenOpenRawBlock, "<%{{", 0, 1}, tokID("raw"), Token{TokenCloseRawBlock, "}}%>", 0, 1}, tokContent("<%foo%>"), Token{TokenOpenEndRawBlock, "<%{{/", 0, 1}, tokID("raw"), Token{TokenCloseRawBlock, "}}%>", 0, 1}, tokEOF},
+	},
+	{
+		`tokenizes escaped mustaches with custom delimiters`,
+		`\<%foo%>`,
+		[]Token{tokContent(`<%foo%>`), tokEOF},
+	},
+}
+
 func collect(t *lexTest) []Token {
+	return collectWithOptions(t, Options{})
+}
+
+func collectWithOptions(t *lexTest, opts Options) []Token {
 	var result []Token
 
-	l := scanWithName(t.input, t.name)
+	l := scanWithName(t.input, t.name, opts)
 	for {
 		token := l.NextToken()
 		result = append(result, token)
@@ -514,6 +602,91 @@ func TestLexer(t *testing.T) {
 	}
 }
 
+func TestLexer_Mustache(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range mustacheLexTests {
+		tokens := collectWithOptions(&test, Options{Mustache: true})
+		if !equal(tokens, test.tokens, false) {
+			t.Errorf("Test '%s' failed\ninput:\n\t'%s'\nexpected\n\t%v\ngot\n\t%+v\n", test.name, test.input, test.tokens, tokens)
+		}
+	}
+}
+
+func TestLexer_Delims(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range delimsLexTests {
+		tokens := collectWithOptions(&test, Options{Delims: [2]string{"<%", "%>"}})
+		if !equal(tokens, test.tokens, false) {
+			t.Errorf("Test '%s' failed\ninput:\n\t'%s'\nexpected\n\t%v\ngot\n\t%+v\n", test.name, test.input, test.tokens, tokens)
+		}
+	}
+
+	tokens := CollectWithOptions("{{foo}}", Options{Delims: [2]string{"<%", "% >"}})
+	if (len(tokens) != 1) || (tokens[0].Kind != TokenError) {
+		t.Errorf("Invalid delimiters must be rejected, got: %v", tokens)
+	}
+}
+
+func TestLexer_Recover(t *testing.T) {
+	t.Parallel()
+
+	lex := ScanWithOptions("{{foo %}}\na {{bar}} {{baz", Options{Recover: true})
+
+	var tokens []Token
+	for {
+		token := lex.NextToken()
+		tokens = append(tokens, token)
+
+		if token.Kind == TokenEOF {
+			break
+		}
+	}
+
+	expected := []Token{
+		{TokenOpen, "{{", 0, 1},
+		{TokenID, "foo", 2, 1},
+		{TokenError, "Unexpected character in expression: '%'", 6, 1},
+		{TokenContent, "\na ", 9, 1},
+		{TokenOpen, "{{", 12, 2},
+		{TokenID, "bar", 14, 2},
+		{TokenClose, "}}", 17, 2},
+		{TokenContent, " ", 19, 2},
+		{TokenOpen, "{{", 20, 2},
+		{TokenID, "baz", 22, 2},
+		{TokenError, "Unclosed expression", 25, 2},
+		{TokenEOF, "", 25, 2},
+	}
+
+	if !equal(tokens, expected, true) {
+		t.Errorf("Lexer must resume scanning after errors\nexpected\n\t%v\ngot\n\t%v", expected, tokens)
+	}
+}
+
+func TestLexer_AfterEOF(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{"{{foo}}", "{{foo"} {
+		lex := Scan(input)
+
+		var last Token
+		for i := 0; i < 10; i++ {
+			last = lex.NextToken()
+		}
+
+		for i := 0; i < 3; i++ {
+			if tok := lex.NextToken(); tok != last {
+				t.Errorf("Last token must be returned again after end of input '%s', got: %v", input, tok)
+			}
+		}
+
+		if (last.Kind != TokenEOF) && (last.Kind != TokenError) {
+			t.Errorf("Scanning input '%s' must end with EOF or an error, got: %v", input, last)
+		}
+	}
+}
+
 // @todo Test errors:
 //   `{{{{raw foo`
 
@@ -539,3 +712,21 @@ func Example() {
 	fmt.Print(output)
 	// Output: Content{"You know "} Open{"{{"} ID{"nothing"} Close{"}}"} Content{" John Snow"} EOF
 }
+
+func BenchmarkLexer(b *testing.B) {
+	chunk, err := ioutil.ReadFile("../testdata/benchmark.hbs")
+	if err != nil {
+		b.Fatal(err)
+	}
+	input := strings.Repeat(string(chunk), 1000)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		l := Scan(input)
+		for tok := l.NextToken(); (tok.Kind != TokenEOF) && (tok.Kind != TokenError); tok = l.NextToken() {
+		}
+	}
+}
@@ -98,6 +98,12 @@ const (
 
 	// TokenBoolean is the BOOLEAN token
 	TokenBoolean
+
+	// TokenUndefined is the UNDEFINED token
+	TokenUndefined
+
+	// TokenNull is the NULL token
+	TokenNull
 )
 
 const (
@@ -148,6 +154,8 @@ var tokenName = map[TokenKind]string{
 	TokenString:           "String",
 	TokenNumber:           "Number",
 	TokenBoolean:          "Boolean",
+	TokenUndefined:        "Undefined",
+	TokenNull:             "Null",
 	TokenData:             "Data",
 	TokenSep:              "Sep",
 }
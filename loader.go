@@ -0,0 +1,445 @@
+package mario
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Loader loads templates from files in a directory, and caches them by path.
+//
+// Partials are loaded from the same directory: `{{> users/card}}` includes file `users/card.hbs` when
+// extension is `.hbs`. Dynamic partials are not loaded. A partial file that doesn't exist is not an error: executing a
+// template that includes it fails, like with any missing partial. Recursive partials are allowed.
+//
+// Templates are reloaded when their file changes, on demand with Refresh() or periodically with Watch(). Templates
+// including a changed partial are reloaded too. Reloaded templates are swapped in atomically: a template returned
+// by Get() is never modified, so it can be executed while a reload is going on.
+type Loader struct {
+	dir   string
+	ext   string
+	setup func(*Template)
+
+	mutex   sync.RWMutex // protects entries
+	entries map[string]*loaderEntry
+
+	// serializes loads and refreshes
+	loading sync.Mutex
+}
+
+// loaderEntry is a cached template file
+type loaderEntry struct {
+	path     string
+	modTime  time.Time
+	size     int64
+	hash     [sha256.Size]byte
+	source   string
+	partials []string // static partials names
+	tpl      *Template
+}
+
+// NewLoader instanciates a new loader of template files with given extension, in given directory.
+func NewLoader(dir string, ext string) *Loader {
+	return &Loader{
+		dir:     dir,
+		ext:     ext,
+		entries: make(map[string]*loaderEntry),
+	}
+}
+
+// WithSetup sets a function called on each loaded template, before it is parsed. It can be used to register
+// helpers, or to set parse options like delimiters or known helpers.
+func (l *Loader) WithSetup(fn func(*Template)) *Loader {
+	l.setup = fn
+	return l
+}
+
+// Get returns template at given path, relative to loader directory. Template is loaded on first call, then returned
+// from cache.
+func (l *Loader) Get(path string) (*Template, error) {
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	l.mutex.RLock()
+	entry := l.entries[path]
+	l.mutex.RUnlock()
+
+	if entry != nil {
+		return entry.tpl, nil
+	}
+
+	l.loading.Lock()
+	defer l.loading.Unlock()
+
+	entries := l.copyEntries()
+
+	// cached templates are not rebuilt
+	built := make(map[string]bool)
+	for p := range entries {
+		built[p] = true
+	}
+
+	if err := l.build(entries, []string{path}, built); err != nil {
+		return nil, err
+	}
+
+	l.swap(entries)
+
+	return entries[path].tpl, nil
+}
+
+// Paths returns sorted paths of all cached templates.
+func (l *Loader) Paths() []string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	var result []string
+	for path := range l.entries {
+		result = append(result, path)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// Refresh reloads all cached templates whose file changed, and all templates that include them. Removed files are
+// evicted from the cache, and templates that include them, or that include a partial file that was added, are
+// reloaded too. It returns sorted paths of reloaded templates.
+//
+// A file is considered changed when its modification time or size changed, and its content hash changed. On error,
+// the cache is left unchanged.
+func (l *Loader) Refresh() ([]string, error) {
+	l.loading.Lock()
+	defer l.loading.Unlock()
+
+	entries := l.copyEntries()
+
+	// find changed and removed files
+	changed := make(map[string]bool)
+	removed := make(map[string]bool)
+
+	for path, entry := range entries {
+		checked, isChanged, err := l.check(entry)
+		if os.IsNotExist(err) {
+			removed[path] = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if isChanged {
+			changed[path] = true
+		} else {
+			entries[path] = checked
+		}
+	}
+
+	// changed files are read again when building
+	stale := make(map[string]bool)
+	for path := range changed {
+		stale[path] = true
+		delete(entries, path)
+	}
+
+	for path := range removed {
+		delete(entries, path)
+	}
+
+	// templates including a partial file that didn't exist are rebuilt if that file was added
+	for path, entry := range entries {
+		for _, name := range entry.partials {
+			partialPath := l.partialPath(name)
+			if (entries[partialPath] == nil) && !changed[partialPath] && !removed[partialPath] && l.exists(partialPath) {
+				stale[path] = true
+			}
+		}
+	}
+
+	// invalidate dependants
+	for {
+		added := false
+
+		for path, entry := range entries {
+			if stale[path] {
+				continue
+			}
+
+			for _, name := range entry.partials {
+				partialPath := l.partialPath(name)
+				if stale[partialPath] || removed[partialPath] {
+					stale[path] = true
+					added = true
+					break
+				}
+			}
+		}
+
+		if !added {
+			break
+		}
+	}
+
+	if len(stale) == 0 {
+		l.swap(entries)
+		return nil, nil
+	}
+
+	built := make(map[string]bool)
+	for path := range entries {
+		if stale[path] {
+			// copy entry, so that its template is rebuilt with new partials
+			copied := *entries[path]
+			entries[path] = &copied
+		} else {
+			built[path] = true
+		}
+	}
+
+	// reload changed files, and rebuild dependants
+	result := sortedKeys(stale)
+	if err := l.build(entries, result, built); err != nil {
+		return nil, err
+	}
+
+	l.swap(entries)
+
+	return result, nil
+}
+
+// Watch calls Refresh() periodically, until returned stop function is called. Refresh errors are passed to onError,
+// if not nil. The stop function waits for a running refresh to finish.
+func (l *Loader) Watch(interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := l.Refresh(); (err != nil) && (onError != nil) {
+					onError(err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// copyEntries returns a copy of cached entries
+func (l *Loader) copyEntries() map[string]*loaderEntry {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	result := make(map[string]*loaderEntry, len(l.entries))
+	for path, entry := range l.entries {
+		result[path] = entry
+	}
+
+	return result
+}
+
+// swap replaces cached entries
+func (l *Loader) swap(entries map[string]*loaderEntry) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.entries = entries
+}
+
+// partialPath returns path of partial with given name
+func (l *Loader) partialPath(name string) string {
+	if !strings.HasSuffix(name, l.ext) {
+		name += l.ext
+	}
+	return filepath.ToSlash(filepath.Clean(name))
+}
+
+// exists returns true if template file at given path exists
+func (l *Loader) exists(path string) bool {
+	_, err := os.Stat(filepath.Join(l.dir, filepath.FromSlash(path)))
+	return err == nil
+}
+
+// check returns true if file of given entry changed, and the entry to keep if not
+func (l *Loader) check(entry *loaderEntry) (*loaderEntry, bool, error) {
+	filename := filepath.Join(l.dir, filepath.FromSlash(entry.path))
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if info.ModTime().Equal(entry.modTime) && (info.Size() == entry.size) {
+		return entry, false, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if sha256.Sum256(data) != entry.hash {
+		return nil, true, nil
+	}
+
+	// touched, but not modified
+	touched := *entry
+	touched.modTime = info.ModTime()
+	touched.size = info.Size()
+
+	return &touched, false, nil
+}
+
+// read reads and parses template file at given path
+func (l *Loader) read(path string) (*loaderEntry, error) {
+	filename := filepath.Join(l.dir, filepath.FromSlash(path))
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := l.newTemplate().Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return &loaderEntry{
+		path:     path,
+		modTime:  info.ModTime(),
+		size:     info.Size(),
+		hash:     sha256.Sum256(data),
+		source:   string(data),
+		partials: tpl.Analyze().Partials,
+		tpl:      tpl,
+	}, nil
+}
+
+// newTemplate instanciates a new template, set up with setup function
+func (l *Loader) newTemplate() *Template {
+	tpl := New()
+	if l.setup != nil {
+		l.setup(tpl)
+	}
+
+	return tpl
+}
+
+// build loads templates at given paths if not cached, with their partials, then builds all those templates that are
+// not already built.
+//
+// Partials files that don't exist are skipped, like removed files: executing a template that includes them fails.
+func (l *Loader) build(entries map[string]*loaderEntry, paths []string, built map[string]bool) error {
+	roots := make(map[string]bool)
+	for _, path := range paths {
+		roots[path] = true
+	}
+
+	// templates read by this build, that are not linked yet
+	read := make(map[string]bool)
+
+	// load files
+	var toBuild []string
+	seen := make(map[string]bool)
+
+	for pending := append([]string(nil), paths...); len(pending) > 0; pending = pending[1:] {
+		path := pending[0]
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		entry := entries[path]
+		if entry == nil {
+			var err error
+			if entry, err = l.read(path); err != nil {
+				if os.IsNotExist(err) && !roots[path] {
+					continue
+				}
+				return err
+			}
+			entries[path] = entry
+			read[path] = true
+		}
+
+		if built[path] {
+			continue
+		}
+		toBuild = append(toBuild, path)
+
+		for _, name := range entry.partials {
+			pending = append(pending, l.partialPath(name))
+		}
+	}
+
+	// parse again templates that were already published, so that they are never modified
+	for _, path := range toBuild {
+		if read[path] {
+			continue
+		}
+
+		entry := entries[path]
+
+		tpl, err := l.newTemplate().Parse(entry.source)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		entry.tpl = tpl
+	}
+
+	for _, path := range toBuild {
+		l.link(entries, path)
+		built[path] = true
+	}
+
+	return nil
+}
+
+// link registers partials of template at given path, with their own partials as partials are evaluated with partials
+// of executed template
+func (l *Loader) link(entries map[string]*loaderEntry, path string) {
+	tpl := entries[path].tpl
+
+	visited := map[string]bool{path: true}
+
+	for pending := []string{path}; len(pending) > 0; pending = pending[1:] {
+		for _, name := range entries[pending[0]].partials {
+			partialPath := l.partialPath(name)
+
+			partial := entries[partialPath]
+			if partial == nil {
+				// removed
+				continue
+			}
+
+			tpl.WithPartial(name, partial.tpl)
+
+			if !visited[partialPath] {
+				visited[partialPath] = true
+				pending = append(pending, partialPath)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package mario_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTemplateFile writes a template file, with a modification time that differs from previous writes
+func writeTemplateFile(t *testing.T, dir string, name string, source string) {
+	filename := filepath.Join(dir, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0755))
+
+	mtime := time.Now()
+	if info, err := os.Stat(filename); err == nil {
+		mtime = info.ModTime().Add(time.Second)
+	}
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte(source), 0644))
+	require.NoError(t, os.Chtimes(filename, mtime, mtime))
+}
+
+func execTemplate(t *testing.T, tpl *mario.Template, ctx interface{}) string {
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, ctx))
+	return b.String()
+}
+
+func TestLoader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mario-loader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTemplateFile(t, dir, "home.hbs", "{{> partials/header}}<p>{{shout name}}</p>")
+	writeTemplateFile(t, dir, "about.hbs", "{{> partials/header}}<p>about</p>")
+	writeTemplateFile(t, dir, "other.hbs", "other")
+	writeTemplateFile(t, dir, "partials/header.hbs", "<h1>{{> partials/title}}</h1>")
+	writeTemplateFile(t, dir, "partials/title.hbs", "Title")
+
+	loader := mario.NewLoader(dir, ".hbs").WithSetup(func(tpl *mario.Template) {
+		tpl.WithHelperFunc("shout", func(s string) string { return s + "!" })
+	})
+
+	home, err := loader.Get("home.hbs")
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Title</h1><p>Mario!</p>", execTemplate(t, home, map[string]string{"name": "Mario"}))
+
+	cached, err := loader.Get("./home.hbs")
+	require.NoError(t, err)
+	require.True(t, home == cached)
+
+	_, err = loader.Get("about.hbs")
+	require.NoError(t, err)
+	_, err = loader.Get("other.hbs")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"about.hbs", "home.hbs", "other.hbs", "partials/header.hbs", "partials/title.hbs"}, loader.Paths())
+
+	// nothing changed
+	reloaded, err := loader.Refresh()
+	require.NoError(t, err)
+	require.Empty(t, reloaded)
+
+	// touched, but not modified
+	writeTemplateFile(t, dir, "partials/title.hbs", "Title")
+	reloaded, err = loader.Refresh()
+	require.NoError(t, err)
+	require.Empty(t, reloaded)
+
+	// partial modified: dependants are reloaded
+	writeTemplateFile(t, dir, "partials/title.hbs", "New Title")
+	reloaded, err = loader.Refresh()
+	require.NoError(t, err)
+	require.Equal(t, []string{"about.hbs", "home.hbs", "partials/header.hbs", "partials/title.hbs"}, reloaded)
+
+	newHome, err := loader.Get("home.hbs")
+	require.NoError(t, err)
+	require.Equal(t, "<h1>New Title</h1><p>Mario!</p>", execTemplate(t, newHome, map[string]string{"name": "Mario"}))
+
+	// previous template is unchanged
+	require.Equal(t, "<h1>Title</h1><p>Mario!</p>", execTemplate(t, home, map[string]string{"name": "Mario"}))
+
+	// parse error: cache is unchanged
+	writeTemplateFile(t, dir, "partials/title.hbs", "{{#if}}")
+	_, err = loader.Refresh()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "partials/title.hbs: Parse error")
+
+	cached, err = loader.Get("home.hbs")
+	require.NoError(t, err)
+	require.True(t, newHome == cached)
+
+	// partial removed
+	writeTemplateFile(t, dir, "partials/title.hbs", "Title")
+	_, err = loader.Refresh()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "other.hbs")))
+	reloaded, err = loader.Refresh()
+	require.NoError(t, err)
+	require.Empty(t, reloaded)
+	require.NotContains(t, loader.Paths(), "other.hbs")
+
+	// partial removed: dependants are reloaded, and fail on execution
+	require.NoError(t, os.Remove(filepath.Join(dir, "partials/title.hbs")))
+	reloaded, err = loader.Refresh()
+	require.NoError(t, err)
+	require.Equal(t, []string{"about.hbs", "home.hbs", "partials/header.hbs"}, reloaded)
+	require.NotContains(t, loader.Paths(), "partials/title.hbs")
+
+	home, err = loader.Get("home.hbs")
+	require.NoError(t, err)
+	require.Error(t, home.Execute(&strings.Builder{}, nil))
+
+	reloaded, err = loader.Refresh()
+	require.NoError(t, err)
+	require.Empty(t, reloaded)
+
+	// partial restored
+	writeTemplateFile(t, dir, "partials/title.hbs", "Back")
+	reloaded, err = loader.Refresh()
+	require.NoError(t, err)
+	require.Equal(t, []string{"about.hbs", "home.hbs", "partials/header.hbs"}, reloaded)
+	require.Contains(t, loader.Paths(), "partials/title.hbs")
+
+	home, err = loader.Get("home.hbs")
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Back</h1><p>Mario!</p>", execTemplate(t, home, map[string]string{"name": "Mario"}))
+}
+
+func TestLoader_RecursivePartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mario-loader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTemplateFile(t, dir, "tree.hbs", "<ul>{{> node}}</ul>")
+	writeTemplateFile(t, dir, "node.hbs", "<li>{{name}}{{#each children}}{{> node}}{{/each}}</li>")
+
+	loader := mario.NewLoader(dir, ".hbs")
+
+	tree, err := loader.Get("tree.hbs")
+	require.NoError(t, err)
+
+	ctx := map[string]interface{}{
+		"name":     "root",
+		"children": []map[string]interface{}{{"name": "leaf", "children": nil}},
+	}
+	require.Equal(t, "<ul><li>root<li>leaf</li></li></ul>", execTemplate(t, tree, ctx))
+
+	writeTemplateFile(t, dir, "node.hbs", "<li>{{name}}:{{#each children}}{{> node}}{{/each}}</li>")
+	reloaded, err := loader.Refresh()
+	require.NoError(t, err)
+	require.Equal(t, []string{"node.hbs", "tree.hbs"}, reloaded)
+
+	tree, err = loader.Get("tree.hbs")
+	require.NoError(t, err)
+	require.Equal(t, "<ul><li>root:<li>leaf:</li></li></ul>", execTemplate(t, tree, ctx))
+}
+
+func TestLoader_KnownHelpers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mario-loader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTemplateFile(t, dir, "page.hbs", "{{> part}}")
+	writeTemplateFile(t, dir, "part.hbs", "{{unknown name}}")
+
+	loader := mario.NewLoader(dir, ".hbs").WithSetup(func(tpl *mario.Template) {
+		tpl.WithKnownHelpersOnly()
+	})
+
+	_, err = loader.Get("page.hbs")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "part.hbs: Parse error on line 1:\nYou specified knownHelpersOnly, but used the unknown helper unknown")
+}
+
+func TestLoader_Watch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mario-loader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTemplateFile(t, dir, "page.hbs", "{{> part}}")
+	writeTemplateFile(t, dir, "part.hbs", "v1")
+
+	loader := mario.NewLoader(dir, ".hbs")
+
+	page, err := loader.Get("page.hbs")
+	require.NoError(t, err)
+
+	stop := loader.Watch(5*time.Millisecond, func(err error) {
+		t.Error(err)
+	})
+	defer stop()
+
+	// concurrent executions
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				tpl, err := loader.Get("page.hbs")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				var b strings.Builder
+				if err := tpl.Execute(&b, nil); err != nil {
+					t.Error(err)
+					return
+				}
+				if (b.String() != "v1") && (b.String() != "v2") {
+					t.Errorf("unexpected output: %q", b.String())
+					return
+				}
+			}
+		}()
+	}
+
+	writeTemplateFile(t, dir, "part.hbs", "v2")
+	wg.Wait()
+
+	require.Eventually(t, func() bool {
+		tpl, err := loader.Get("page.hbs")
+		return (err == nil) && (tpl != page) && (execTemplate(t, tpl, nil) == "v2")
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestLoader_Delims(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mario-loader")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeTemplateFile(t, dir, "page.hbs", "{{ vue }} [[> part]]")
+	writeTemplateFile(t, dir, "part.hbs", "[[name]]")
+
+	loader := mario.NewLoader(dir, ".hbs").WithSetup(func(tpl *mario.Template) {
+		tpl.WithDelims("[[", "]]")
+	})
+
+	page, err := loader.Get("page.hbs")
+	require.NoError(t, err)
+	require.Equal(t, "{{ vue }} Mario", execTemplate(t, page, map[string]string{"name": "Mario"}))
+}
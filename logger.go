@@ -0,0 +1,121 @@
+package mario
+
+import (
+	"log"
+	"strconv"
+	"strings"
+)
+
+// LogLevel is the level of a message logged with the log helper.
+type LogLevel int
+
+const (
+	// LogDebug is the debug level
+	LogDebug LogLevel = iota
+	// LogInfo is the info level, used by default
+	LogInfo
+	// LogWarn is the warning level
+	LogWarn
+	// LogError is the error level
+	LogError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the level name.
+func (l LogLevel) String() string {
+	if (l >= LogDebug) && (l <= LogError) {
+		return logLevelNames[l]
+	}
+	return strconv.Itoa(int(l))
+}
+
+// ParseLogLevel returns the level corresponding to given value, that can be a level name (`debug`, `info`, `warn`
+// or `error`, case insensitive), a number or a LogLevel. It returns false if value is not a known level.
+func ParseLogLevel(value interface{}) (LogLevel, bool) {
+	switch v := value.(type) {
+	case LogLevel:
+		return v, true
+	case int:
+		return LogLevel(v), true
+	case float64:
+		return LogLevel(v), true
+	case string:
+		for i, name := range logLevelNames {
+			if strings.EqualFold(v, name) {
+				return LogLevel(i), true
+			}
+		}
+
+		if i, err := strconv.Atoi(v); err == nil {
+			return LogLevel(i), true
+		}
+	}
+
+	return LogInfo, false
+}
+
+// Logger receives messages of the log helper that are not filtered out by the template log level.
+type Logger interface {
+	Log(level LogLevel, params ...interface{})
+}
+
+// LoggerFunc is an adapter to use a function as a Logger.
+type LoggerFunc func(level LogLevel, params ...interface{})
+
+// Log implements the Logger interface.
+func (fn LoggerFunc) Log(level LogLevel, params ...interface{}) {
+	fn(level, params...)
+}
+
+// NewLogger instanciates a Logger that prints messages with given standard logger, prefixed with their level, and
+// space separated parameters. Messages are printed with the log package standard logger if out is nil.
+func NewLogger(out *log.Logger) Logger {
+	return LoggerFunc(func(level LogLevel, params ...interface{}) {
+		strs := make([]string, len(params))
+		for i, param := range params {
+			strs[i] = Str(param)
+		}
+
+		msg := "[" + level.String() + "] " + strings.Join(strs, " ")
+
+		if out != nil {
+			out.Print(msg)
+		} else {
+			log.Print(msg)
+		}
+	})
+}
+
+// defaultLogger is used when no logger is set on template nor data frame
+var defaultLogger = NewLogger(nil)
+
+// WithLogger sets the logger used by the log helper. Messages are printed with the log package standard logger by
+// default. A logger can also be set for a single execution with DataFrame.SetLogger().
+func (tpl *Template) WithLogger(logger Logger) *Template {
+	tpl.logger = logger
+	return tpl
+}
+
+// WithLogLevel sets the minimum level of messages logged by the log helper, LogInfo by default.
+func (tpl *Template) WithLogLevel(level LogLevel) *Template {
+	tpl.logLevel = level
+	return tpl
+}
+
+// log logs given params with the execution logger, if level is not below template log level
+func (v *evaluator) log(level LogLevel, params ...interface{}) {
+	if level < v.logLevel {
+		return
+	}
+
+	logger := v.dataFrame.logger()
+	if logger == nil {
+		logger = v.logger
+	}
+	if logger == nil {
+		logger = defaultLogger
+	}
+
+	logger.Log(level, params...)
+}
@@ -0,0 +1,53 @@
+package mario_test
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogger(t *testing.T) {
+	var out strings.Builder
+
+	tpl := mario.Must(mario.New().Parse(`{{log "user" name 42}}{{log "hidden" level="debug"}}{{log "oops" level="ERROR"}}`)).
+		WithLogger(mario.NewLogger(log.New(&out, "", 0)))
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, map[string]string{"name": "mario"}))
+	require.Equal(t, "", b.String())
+	require.Equal(t, "[info] user mario 42\n[error] oops\n", out.String())
+}
+
+func TestNewLogger_InvalidLevel(t *testing.T) {
+	var out strings.Builder
+
+	tpl := mario.Must(mario.New().Parse(`{{log "user" level="bogus"}}`)).WithLogger(mario.NewLogger(log.New(&out, "", 0)))
+
+	err := tpl.Execute(&strings.Builder{}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid log level: bogus")
+	require.Equal(t, "", out.String())
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for _, test := range []struct {
+		value    interface{}
+		expected mario.LogLevel
+		ok       bool
+	}{
+		{"debug", mario.LogDebug, true},
+		{"Warn", mario.LogWarn, true},
+		{"2", mario.LogWarn, true},
+		{3, mario.LogError, true},
+		{mario.LogError, mario.LogError, true},
+		{"verbose", mario.LogInfo, false},
+		{nil, mario.LogInfo, false},
+	} {
+		level, ok := mario.ParseLogLevel(test.value)
+		require.Equal(t, test.expected, level, "%v", test.value)
+		require.Equal(t, test.ok, ok, "%v", test.value)
+	}
+}
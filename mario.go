@@ -1,5 +1,7 @@
 package mario
 
+import "sort"
+
 var (
 	helpers map[string]*Helper
 )
@@ -16,7 +18,7 @@ func ResetHelpers() {
 		"unless": CreateHelper(unlessHelper),
 		"with":   CreateHelper(withHelper),
 		"each":   CreateHelper(eachHelper),
-		"log":    CreateHelper(logHelper),
+		"log":    anyParamsHelper(logHelper),
 		"lookup": CreateHelper(lookupHelper),
 
 		// Common helper
@@ -28,3 +30,13 @@ func ResetHelpers() {
 func RegisterHelper(name string, fn interface{}) {
 	helpers[name] = CreateHelper(fn)
 }
+
+// HelperNames returns sorted names of all build-in helpers
+func HelperNames() []string {
+	var result []string
+	for name := range helpers {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,149 @@
+package mario
+
+import (
+	"reflect"
+
+	"github.com/imantung/mario/ast"
+	"github.com/imantung/mario/parser"
+)
+
+// WithMustache enables Mustache compatibility mode. It must be called before Parse().
+//
+// In that mode:
+//   - set delimiters tags like `{{=<% %>=}}` change the delimiters of the rest of the template
+//   - backslashes don't escape mustaches
+//   - `{{>*name}}` includes the partial whose name is the value of `name`
+//   - missing partials render an empty string
+//   - standalone partials are indented before being rendered, so that interpolated values are not indented
+//   - lambdas are supported: a `func() string` context value is called, then its result is rendered as a template,
+//     and a `func(string) string` context value used as a section is called with the unrendered section content,
+//     then its result is rendered as a template with the delimiters in use at the section
+//   - inheritance is supported: `{{<parent}}` includes partial `parent`, where `{{$block}}` tags are replaced by
+//     blocks of same name in the parent tag content
+//
+// Partials must be parsed in Mustache mode too, and the mode of the executed template applies to its partials.
+func (tpl *Template) WithMustache() *Template {
+	tpl.mustache = true
+	return tpl
+}
+
+// indentedSource holds the program of template source with all lines indented, and its resolved helper calls
+type indentedSource struct {
+	program     *ast.Program
+	helperCalls helperCalls
+}
+
+// indentedProgram returns program of template source with all lines indented, and caches it
+func (tpl *Template) indentedProgram(indent string) (*indentedSource, error) {
+	if cached, ok := tpl.indented.Load(indent); ok {
+		return cached.(*indentedSource), nil
+	}
+
+	program, err := parser.ParseWithOptions(indentLines(tpl.source, indent), tpl.parseOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	helperCalls, err := tpl.resolveHelperCalls(program)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &indentedSource{program: program, helperCalls: helperCalls}
+	tpl.indented.Store(indent, result)
+
+	return result, nil
+}
+
+// evalLambda calls a Mustache lambda and renders its result. It returns false if given function is not a lambda for
+// current expression.
+func (v *evaluator) evalLambda(funcVal reflect.Value) (reflect.Value, bool) {
+	expr := v.curExpr()
+	if (len(expr.Params) > 0) || (expr.Hash != nil) {
+		return zero, false
+	}
+
+	funcType := funcVal.Type()
+	if !returnsValue(funcType) {
+		return zero, false
+	}
+
+	block := v.curBlock()
+	if (block != nil) && (block.Expression == expr) {
+		if block.Program == nil {
+			// lambdas are truthy, so inverted section is not rendered
+			return reflect.ValueOf(true), true
+		}
+
+		if (funcType.NumIn() != 1) || (funcType.In(0).Kind() != reflect.String) || (funcType.Out(0).Kind() != reflect.String) {
+			return zero, false
+		}
+
+		// section lambda receives the raw section content
+		arg := reflect.ValueOf(block.RawContent).Convert(funcType.In(0))
+		source := funcVal.Call([]reflect.Value{arg})[0].String()
+
+		v.exprFunc[expr] = true
+
+		return reflect.ValueOf(v.renderLambda(source, block.Delims)), true
+	}
+
+	if (funcType.NumIn() != 0) || (funcType.Out(0).Kind() != reflect.String) {
+		return zero, false
+	}
+
+	// interpolation lambda result is rendered with default delimiters
+	source := funcVal.Call(nil)[0].String()
+
+	return reflect.ValueOf(v.renderLambda(source, [2]string{})), true
+}
+
+// renderLambda renders a lambda result in current context
+func (v *evaluator) renderLambda(source string, delims [2]string) string {
+	program, err := parser.ParseWithOptions(source, parser.Options{Mustache: true, Delims: delims})
+	if err != nil {
+		v.panicf("Failed to parse lambda result: %s", err)
+	}
+
+	result, _ := program.Accept(v).(string)
+
+	return result
+}
+
+// evalInheritance evaluates a Mustache block `{{$name}}` or parent `{{<name}}` tag
+func (v *evaluator) evalInheritance(node *ast.BlockStatement) string {
+	name := node.Expression.Canonical()
+
+	if node.Inheritance == ast.InheritanceBlock {
+		// outermost override wins
+		program := node.Program
+		for _, overrides := range v.overrides {
+			if override := overrides[name]; override != nil {
+				program = override
+				break
+			}
+		}
+
+		result, _ := program.Accept(v).(string)
+		return result
+	}
+
+	partial := v.partials[name]
+	if partial == nil {
+		return ""
+	}
+
+	// only blocks are kept from parent tag content
+	overrides := make(map[string]*ast.Program)
+	for _, statement := range node.Program.Body {
+		if block, ok := statement.(*ast.BlockStatement); ok && (block.Inheritance == ast.InheritanceBlock) {
+			overrides[block.Expression.Canonical()] = block.Program
+		}
+	}
+
+	v.overrides = append(v.overrides, overrides)
+	result, _ := partial.Program().Accept(v).(string)
+	v.overrides = v.overrides[:len(v.overrides)-1]
+
+	return result
+}
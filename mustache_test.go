@@ -2,6 +2,7 @@ package mario_test
 
 import (
 	"io/ioutil"
+	"os"
 	"path"
 	"regexp"
 	"strings"
@@ -13,9 +14,10 @@ import (
 )
 
 //
-// Note, as the JS implementation, the divergences from mustache spec:
-//   - we don't support alternative delimeters
-//   - the mustache lambda spec differs
+// Spec tests run twice:
+//   - in Mustache compatibility mode, where alternative delimiters, lambdas, dynamic names and inheritance are supported
+//   - in default mode, with the same divergences from the Mustache spec as the JS implementation: alternative
+//     delimiters, lambdas and other optional modules are not supported, and partials are indented as a whole
 //
 
 type mustacheTest struct {
@@ -40,40 +42,95 @@ var (
 	musTestLambdaInterMult = 0
 )
 
+// mustacheLambdas are the Go implementations of ~lambdas.yml lambdas, by test name
+var mustacheLambdas = map[string]interface{}{
+	"Interpolation":                        func() string { return "world" },
+	"Interpolation - Expansion":            func() string { return "{{planet}}" },
+	"Interpolation - Alternate Delimiters": func() string { return "|planet| => {{planet}}" },
+	"Interpolation - Multiple Calls": func() string {
+		musTestLambdaInterMult++
+		return mario.Str(musTestLambdaInterMult)
+	},
+	"Escaping": func() string { return ">" },
+	"Section": func(text string) string {
+		if text == "{{x}}" {
+			return "yes"
+		}
+		return "no"
+	},
+	"Section - Expansion":            func(text string) string { return text + "{{planet}}" + text },
+	"Section - Alternate Delimiters": func(text string) string { return text + "{{planet}} => |planet|" + text },
+	"Section - Multiple Calls":       func(text string) string { return "__" + text + "__" },
+	"Inverted Section":               func(text string) bool { return false },
+}
+
 func TestMustache(t *testing.T) {
-	skipFiles := map[string]bool{
-		// mustache lambdas differ from handlebars lambdas
-		"~lambdas.yml": true,
-	}
+	requireMustacheSpecs(t)
 
 	for _, fileName := range mustacheTestFiles() {
-		if skipFiles[fileName] {
-			// fmt.Printf("Skipped file: %s\n", fileName)
-			continue
+		for _, tt := range testsFromMustacheFile(fileName) {
+			t.Run(fileName+": "+tt.name, func(t *testing.T) {
+				requireMustacheTest(t, tt.testcase, true)
+			})
 		}
+	}
+}
 
-		for i, tt := range testsFromMustacheFile(fileName) {
-			tpl := mario.New()
-			for name, fn := range tt.helpers {
-				tpl.WithHelperFunc(name, fn)
-			}
-			for name, source := range tt.partials {
-				tpl.WithPartial(name, mario.Must(mario.New().Parse(source)))
-			}
+func TestMustache_DefaultMode(t *testing.T) {
+	requireMustacheSpecs(t)
 
-			var b strings.Builder
-			if err := mario.Must(tpl.Parse(tt.template)).Execute(&b, tt.data); err != nil {
-				require.EqualError(t, err, tt.expectedError, i)
-			} else {
-				require.Equal(t, tt.expected, b.String(), i)
+	for _, fileName := range mustacheTestFiles() {
+		for _, tt := range testsFromMustacheFile(fileName) {
+			if mustBeSkipped(tt, fileName) {
+				continue
 			}
+
+			t.Run(fileName+": "+tt.name, func(t *testing.T) {
+				requireMustacheTest(t, tt.testcase, false)
+			})
 		}
+	}
+}
+
+// requireMustacheSpecs fails if the Mustache spec submodule is not checked out
+func requireMustacheSpecs(t *testing.T) {
+	if _, err := os.Stat(path.Join("mustache", "specs")); err != nil {
+		t.Fatalf("mustache specs not found, run: git submodule update --init (%s)", err)
+	}
+}
+
+// requireMustacheTest renders given test, in Mustache compatibility mode or in default mode
+func requireMustacheTest(t *testing.T, tt testcase, mustache bool) {
+	newTemplate := func() *mario.Template {
+		if mustache {
+			return mario.New().WithMustache()
+		}
+		return mario.New()
+	}
+
+	tpl := newTemplate()
+	for name, fn := range tt.helpers {
+		tpl.WithHelperFunc(name, fn)
+	}
+	for name, source := range tt.partials {
+		tpl.WithPartial(name, mario.Must(newTemplate().Parse(source)))
+	}
 
+	var b strings.Builder
+	if err := mario.Must(tpl.Parse(tt.template)).Execute(&b, tt.data); err != nil {
+		require.EqualError(t, err, tt.expectedError)
+	} else {
+		require.Equal(t, tt.expected, b.String())
 	}
 }
 
-func testsFromMustacheFile(fileName string) []testcase {
-	result := []testcase{}
+type namedMustacheTest struct {
+	testcase
+	name string
+}
+
+func testsFromMustacheFile(fileName string) []namedMustacheTest {
+	result := []namedMustacheTest{}
 
 	fileData, err := ioutil.ReadFile(path.Join("mustache", "specs", fileName))
 	if err != nil {
@@ -86,41 +143,44 @@ func testsFromMustacheFile(fileName string) []testcase {
 	}
 
 	for _, mustacheTest := range testFile.Tests {
-		if mustBeSkipped(mustacheTest, fileName) {
-			// fmt.Printf("Skipped test: %s\n", mustacheTest.Name)
-			continue
+		data := mustacheTest.Data
+		if lambda, ok := mustacheLambdas[mustacheTest.Name]; ok && (fileName == "~lambdas.yml") {
+			// replace lambda code of other languages
+			if m, ok := data.(map[interface{}]interface{}); ok {
+				m["lambda"] = lambda
+			}
 		}
 
 		test := testcase{
 			template: mustacheTest.Template,
-			data:     mustacheTest.Data,
+			data:     data,
 			partials: mustacheTest.Partials,
 			expected: mustacheTest.Expected,
 		}
 
-		result = append(result, test)
+		result = append(result, namedMustacheTest{test, mustacheTest.Name})
 	}
 
 	return result
 }
 
-// returns true if test must be skipped
-func mustBeSkipped(test mustacheTest, fileName string) bool {
-	// handlebars does not support alternative delimiters
-	return haveAltDelimiter(test) ||
+// returns true if test must be skipped in default mode
+func mustBeSkipped(test namedMustacheTest, fileName string) bool {
+	// handlebars does not support alternative delimiters, nor optional modules like lambdas and inheritance
+	return strings.HasPrefix(fileName, "~") || haveAltDelimiter(test) ||
 		// the JS implementation skips those tests
-		fileName == "partials.yml" && (test.Name == "Failed Lookup" || test.Name == "Standalone Indentation")
+		fileName == "partials.yml" && (test.name == "Failed Lookup" || test.name == "Standalone Indentation")
 }
 
 // returns true if test have alternative delimeter in template or in partials
-func haveAltDelimiter(test mustacheTest) bool {
+func haveAltDelimiter(test namedMustacheTest) bool {
 	// check template
-	if rAltDelim.MatchString(test.Template) {
+	if rAltDelim.MatchString(test.template) {
 		return true
 	}
 
 	// check partials
-	for _, partial := range test.Partials {
+	for _, partial := range test.partials {
 		if rAltDelim.MatchString(partial) {
 			return true
 		}
@@ -149,119 +209,254 @@ func mustacheTestFiles() []string {
 }
 
 //
-// Following tests come fron ~lambdas.yml
+// Following tests are transcribed from the Mustache spec, so that they run without the spec submodule
 //
 
-var mustacheLambdasTests = []testcase{
-	{
+var mustacheModeTests = []namedMustacheTest{
+	// delimiters.yml
+	{testcase{
+		template: "{{=<% %>=}}(<%text%>)",
+		data:     map[string]string{"text": "Hey!"},
+		expected: "(Hey!)",
+	}, "Pair Behavior"},
+	{testcase{
+		template: "({{=[ ]=}}[text])",
+		data:     map[string]string{"text": "It worked!"},
+		expected: "(It worked!)",
+	}, "Special Characters"},
+	{testcase{
+		template: "[\n{{#section}}\n  {{data}}\n  |data|\n{{/section}}\n\n{{= | | =}}\n|#section|\n  {{data}}\n  |data|\n|/section|\n]\n",
+		data:     map[string]interface{}{"section": true, "data": "I got interpolated."},
+		expected: "[\n  I got interpolated.\n  |data|\n\n  {{data}}\n  I got interpolated.\n]\n",
+	}, "Sections"},
+	{testcase{
+		template: "[\n{{^section}}\n  {{data}}\n  |data|\n{{/section}}\n\n{{= | | =}}\n|^section|\n  {{data}}\n  |data|\n|/section|\n]\n",
+		data:     map[string]interface{}{"section": false, "data": "I got interpolated."},
+		expected: "[\n  I got interpolated.\n  |data|\n\n  {{data}}\n  I got interpolated.\n]\n",
+	}, "Inverted Sections"},
+	{testcase{
+		template: "[ {{>include}} ]\n{{= | | =}}\n[ |>include| ]\n",
+		data:     map[string]string{"value": "yes"},
+		partials: map[string]string{"include": ".{{value}}."},
+		expected: "[ .yes. ]\n[ .yes. ]\n",
+	}, "Partial Inheritence"},
+	{testcase{
+		template: "[ {{>include}} ]\n[ .{{value}}.  .|value|. ]\n",
+		data:     map[string]string{"value": "yes"},
+		partials: map[string]string{"include": ".{{value}}. {{= | | =}} .|value|."},
+		expected: "[ .yes.  .yes. ]\n[ .yes.  .|value|. ]\n",
+	}, "Post-Partial Behavior"},
+	{testcase{
+		template: "| {{=@ @=}} |",
+		expected: "|  |",
+	}, "Surrounding Whitespace"},
+	{testcase{
+		template: " | {{=@ @=}}\n",
+		expected: " | \n",
+	}, "Outlying Whitespace (Inline)"},
+	{testcase{
+		template: "Begin.\n{{=@ @=}}\nEnd.\n",
+		expected: "Begin.\nEnd.\n",
+	}, "Standalone Tag"},
+	{testcase{
+		template: "Begin.\n  {{=@ @=}}\nEnd.\n",
+		expected: "Begin.\nEnd.\n",
+	}, "Indented Standalone Tag"},
+	{testcase{
+		template: "|\r\n{{= @ @ =}}\r\n|",
+		expected: "|\r\n|",
+	}, "Standalone Line Endings"},
+	{testcase{
+		template: "  {{=@ @=}}\n=",
+		expected: "=",
+	}, "Standalone Without Previous Line"},
+	{testcase{
+		template: "=\n  {{=@ @=}}",
+		expected: "=\n",
+	}, "Standalone Without Newline"},
+	{testcase{
+		template: "|{{= @   @ =}}|",
+		expected: "||",
+	}, "Pair with Padding"},
+
+	// ~lambdas.yml
+	{testcase{
 		template: "Hello, {{lambda}}!",
-		data: map[string]interface{}{
-			"lambda": func() string {
-				return "world"
-			}},
+		data:     map[string]interface{}{"lambda": mustacheLambdas["Interpolation"]},
 		expected: "Hello, world!",
-	},
-
-	// // SKIP: lambda return value is not parsed
-	// {
-	// 	"Interpolation - Expansion",
-	// 	"Hello, {{lambda}}!",
-	// 	map[string]interface{}{"lambda": func() string { return "{{planet}}" }},
-	// 	nil, nil, nil,
-	// 	"Hello, world!",
-	// },
-
-	// SKIP "Interpolation - Alternate Delimiters"
-
-	{
+	}, "Interpolation"},
+	{testcase{
+		template: "Hello, {{lambda}}!",
+		data:     map[string]interface{}{"planet": "world", "lambda": mustacheLambdas["Interpolation - Expansion"]},
+		expected: "Hello, world!",
+	}, "Interpolation - Expansion"},
+	{testcase{
+		template: "{{= | | =}}\nHello, (|&lambda|)!",
+		data:     map[string]interface{}{"planet": "world", "lambda": mustacheLambdas["Interpolation - Alternate Delimiters"]},
+		expected: "Hello, (|planet| => world)!",
+	}, "Interpolation - Alternate Delimiters"},
+	{testcase{
 		template: "{{lambda}} == {{{lambda}}} == {{lambda}}",
-		data: map[string]interface{}{
-			"lambda": func() string {
-				musTestLambdaInterMult++
-				return mario.Str(musTestLambdaInterMult)
-			}},
+		data:     map[string]interface{}{"lambda": mustacheLambdas["Interpolation - Multiple Calls"]},
 		expected: "1 == 2 == 3",
-	},
-
-	{
+	}, "Interpolation - Multiple Calls"},
+	{testcase{
 		template: "<{{lambda}}{{{lambda}}}",
-		data: map[string]interface{}{
-			"lambda": func() string {
-				return ">"
-			}},
+		data:     map[string]interface{}{"lambda": mustacheLambdas["Escaping"]},
 		expected: "<&gt;>",
-	},
-
-	// // SKIP: "Lambdas used for sections should receive the raw section string."
-	// {
-	// 	"Section",
-	// 	"<{{#lambda}}{{x}}{{/lambda}}>",
-	// 	map[string]interface{}{"lambda": func(param string) string {
-	// 		if param == "{{x}}" {
-	// 			return "yes"
-	// 		}
-
-	// 		return "false"
-	// 	}, "x": "Error!"},
-	// 	nil, nil, nil,
-	// 	"<yes>",
-	// },
-
-	// // SKIP: lambda return value is not parsed
-	// {
-	// 	"Section - Expansion",
-	// 	"<{{#lambda}}-{{/lambda}}>",
-	// 	map[string]interface{}{"lambda": func(param string) string {
-	// 		return param + "{{planet}}" + param
-	// 	}, "planet": "Earth"},
-	// 	nil, nil, nil,
-	// 	"<-Earth->",
-	// },
-
-	// SKIP: "Section - Alternate Delimiters"
-
-	{
+	}, "Escaping"},
+	{testcase{
+		template: "<{{#lambda}}{{x}}{{/lambda}}>",
+		data:     map[string]interface{}{"x": "Error!", "lambda": mustacheLambdas["Section"]},
+		expected: "<yes>",
+	}, "Section"},
+	{testcase{
+		template: "<{{#lambda}}-{{/lambda}}>",
+		data:     map[string]interface{}{"planet": "Earth", "lambda": mustacheLambdas["Section - Expansion"]},
+		expected: "<-Earth->",
+	}, "Section - Expansion"},
+	{testcase{
+		template: "{{= | | =}}<|#lambda|-|/lambda|>",
+		data:     map[string]interface{}{"planet": "Earth", "lambda": mustacheLambdas["Section - Alternate Delimiters"]},
+		expected: "<-{{planet}} => Earth->",
+	}, "Section - Alternate Delimiters"},
+	{testcase{
 		template: "{{#lambda}}FILE{{/lambda}} != {{#lambda}}LINE{{/lambda}}",
-		data: map[string]interface{}{
-			"lambda": func(options *mario.Options) string {
-				return "__" + options.Fn() + "__"
-			}},
+		data:     map[string]interface{}{"lambda": mustacheLambdas["Section - Multiple Calls"]},
 		expected: "__FILE__ != __LINE__",
-	},
-
-	// // SKIP: "Lambdas used for inverted sections should be considered truthy."
-	// {
-	// 	"Inverted Section",
-	// 	"<{{^lambda}}{{static}}{{/lambda}}>",
-	// 	map[string]interface{}{
-	// 		"lambda": func() interface{} {
-	// 			return false
-	// 		},
-	// 		"static": "static",
-	// 	},
-	// 	nil, nil, nil,
-	// 	"<>",
-	// },
+	}, "Section - Multiple Calls"},
+	{testcase{
+		template: "<{{^lambda}}{{static}}{{/lambda}}>",
+		data:     map[string]interface{}{"static": "static", "lambda": mustacheLambdas["Inverted Section"]},
+		expected: "<>",
+	}, "Inverted Section"},
+
+	// partials.yml
+	{testcase{
+		template: `"{{>text}}"`,
+		expected: `""`,
+	}, "Failed Lookup"},
+	{testcase{
+		template: "\\\n {{>partial}}\n/\n",
+		data:     map[string]string{"content": "<\n->"},
+		partials: map[string]string{"partial": "|\n{{{content}}}\n|\n"},
+		expected: "\\\n |\n <\n->\n |\n/\n",
+	}, "Standalone Indentation"},
+
+	// ~dynamic-names.yml
+	{testcase{
+		template: `"{{>*dynamic}}"`,
+		data:     map[string]string{"dynamic": "content"},
+		partials: map[string]string{"content": "Hello, world!"},
+		expected: `"Hello, world!"`,
+	}, "Basic Behavior - Partial"},
+	{testcase{
+		template: `"{{>*missing}}"`,
+		partials: map[string]string{"content": "Hello, world!"},
+		expected: `""`,
+	}, "Basic Behavior - Name Resolution"},
+	{testcase{
+		template: `"{{>*dynamic}}"`,
+		data:     map[string]string{"text": "Hello, world!", "dynamic": "partial"},
+		partials: map[string]string{"partial": "*{{text}}*"},
+		expected: `"*Hello, world!*"`,
+	}, "Context"},
+	{testcase{
+		template: `"{{>*a.b}}"`,
+		data:     map[string]interface{}{"text": "Hello, world!", "a": map[string]string{"b": "partial"}},
+		partials: map[string]string{"partial": "*{{text}}*"},
+		expected: `"*Hello, world!*"`,
+	}, "Dotted Names"},
+	{testcase{
+		template: "|{{>* dynamic }}|",
+		data:     map[string]string{"dynamic": "partial"},
+		partials: map[string]string{"partial": "[]"},
+		expected: "|[]|",
+	}, "Padding Whitespace"},
+
+	// ~inheritance.yml
+	{testcase{
+		template: "{{$title}}Default title{{/title}}\n",
+		expected: "Default title\n",
+	}, "Default"},
+	{testcase{
+		template: "{{$foo}}default {{bar}} content{{/foo}}\n",
+		data:     map[string]string{"bar": "baz"},
+		expected: "default baz content\n",
+	}, "Variable"},
+	{testcase{
+		template: "{{<include}}{{/include}}",
+		partials: map[string]string{"include": "{{$foo}}default content{{/foo}}"},
+		expected: "default content",
+	}, "Inherit"},
+	{testcase{
+		template: "{{<super}}{{$title}}sub template title{{/title}}{{/super}}",
+		partials: map[string]string{"super": "...{{$title}}Default title{{/title}}..."},
+		expected: "...sub template title...",
+	}, "Overridden content"},
+	{testcase{
+		template: "{{<include}}{{$var}}var in template{{/var}}{{/include}}",
+		data:     map[string]string{"var": "var in data"},
+		partials: map[string]string{"include": "{{$var}}var in include{{/var}}"},
+		expected: "var in template",
+	}, "Data does not override block"},
+	{testcase{
+		template: "test {{<partial}}{{$stuff}}override1{{/stuff}}{{/partial}} {{<partial}}{{$stuff}}override2{{/stuff}}{{/partial}}\n",
+		partials: map[string]string{"partial": "|{{$stuff}}...{{/stuff}}{{$default}} default{{/default}}|"},
+		expected: "test |override1 default| |override2 default|\n",
+	}, "Two overridden partials"},
+	{testcase{
+		template: "{{>parent}}|{{<parent}}{{/parent}}",
+		partials: map[string]string{"parent": "{{$foo}}default content{{/foo}}"},
+		expected: "default content|default content",
+	}, "Parent template"},
+	{testcase{
+		template: "{{<parent}}{{$foo}}override{{/foo}}{{/parent}}",
+		partials: map[string]string{
+			"parent":  "{{$foo}}default content{{/foo}} {{$bar}}{{<parent2}}{{/parent2}}{{/bar}}",
+			"parent2": "{{$foo}}parent2 default content{{/foo}} {{<parent}}{{$bar}}don't recurse{{/bar}}{{/parent}}",
+		},
+		expected: "override override override don't recurse",
+	}, "Recursion"},
+	{testcase{
+		template: "{{<parent}}{{$a}}c{{/a}}{{/parent}}",
+		partials: map[string]string{
+			"parent":      "{{<older}}{{$a}}p{{/a}}{{/older}}",
+			"older":       "{{<grandParent}}{{$a}}o{{/a}}{{/grandParent}}",
+			"grandParent": "{{$a}}g{{/a}}",
+		},
+		expected: "c",
+	}, "Multi-level inheritance"},
+	{testcase{
+		template: "{{<parent}} asdfasd {{$foo}}hmm{{/foo}} asdfasdfasdf {{/parent}}",
+		partials: map[string]string{"parent": "{{$foo}}default content{{/foo}}"},
+		expected: "hmm",
+	}, "Text inside parent"},
+	{testcase{
+		template: "{{<parent}}{{$block}}I say {{fruit}}.{{/block}}{{/parent}}",
+		data:     map[string]interface{}{"fruit": "apples", "nested": map[string]string{"fruit": "bananas"}},
+		partials: map[string]string{"parent": "{{#nested}}{{$block}}You say {{fruit}}.{{/block}}{{/nested}}"},
+		expected: "I say bananas.",
+	}, "Block scope"},
 }
 
-func TestMustacheLambdas(t *testing.T) {
+func TestMustacheMode(t *testing.T) {
 	t.Parallel()
 
-	for i, tt := range mustacheLambdasTests {
-		tpl := mario.New()
-		for name, fn := range tt.helpers {
-			tpl.WithHelperFunc(name, fn)
-		}
-		for name, source := range tt.partials {
-			tpl.WithPartial(name, mario.Must(mario.New().Parse(source)))
-		}
-
-		var b strings.Builder
-		if err := mario.Must(tpl.Parse(tt.template)).Execute(&b, tt.data); err != nil {
-			require.EqualError(t, err, tt.expectedError, i)
-		} else {
-			require.Equal(t, tt.expected, b.String(), i)
-		}
+	for _, tt := range mustacheModeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireMustacheTest(t, tt.testcase, true)
+		})
 	}
+}
+
+func TestMustacheMode_Disabled(t *testing.T) {
+	t.Parallel()
+
+	// set delimiters tags are not supported
+	_, err := mario.New().Parse("{{=<% %>=}}(<%text%>)")
+	require.Error(t, err)
 
+	// lambdas are helpers
+	require.Equal(t, "{{planet}}", compile("{{{lambda}}}", map[string]interface{}{"planet": "world", "lambda": func() string { return "{{planet}}" }}))
 }
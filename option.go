@@ -1,6 +1,10 @@
 package mario
 
-import "reflect"
+import (
+	"reflect"
+
+	"github.com/imantung/mario/ast"
+)
 
 // Options represents the options argument provided to helpers and context functions.
 type Options struct {
@@ -10,6 +14,16 @@ type Options struct {
 	// params
 	params []interface{}
 	hash   map[string]interface{}
+
+	// params and hash values ids, in trackIds mode
+	paramIDs []interface{}
+	hashIDs  map[string]interface{}
+
+	// params and hash values types and lookup contexts, in stringParams mode
+	paramTypes    []string
+	hashTypes     map[string]string
+	paramContexts []interface{}
+	hashContexts  map[string]interface{}
 }
 
 // newOptions instanciates a new Options
@@ -189,6 +203,53 @@ func (options *Options) Eval(ctx interface{}, field string) interface{} {
 	return val.Interface()
 }
 
+//
+// Raw Blocks
+//
+
+// RawContent returns the unprocessed content of the raw block `{{{{helper}}}}content{{{{/helper}}}}` that calls the
+// helper, and false if helper is not called by a raw block.
+//
+// Unlike Fn(), that content is not affected by whitespace control nor standalone tags detection.
+func (options *Options) RawContent() (string, bool) {
+	if block := options.rawBlock(); block != nil {
+		return block.RawContent, true
+	}
+
+	return "", false
+}
+
+// RawContentLoc returns the location in template source of the raw block content returned by RawContent(). It returns
+// a zero location if helper is not called by a raw block, and an empty location just after the open tag if the raw
+// block content is empty.
+func (options *Options) RawContentLoc() ast.Loc {
+	block := options.rawBlock()
+	if block == nil {
+		return ast.Loc{}
+	}
+
+	if block.Program != nil {
+		return block.Program.Loc
+	}
+
+	return block.Loc
+}
+
+// rawBlock returns the raw block that calls the helper, or nil if helper is not called by a raw block
+func (options *Options) rawBlock() *ast.BlockStatement {
+	block := options.eval.curBlock()
+	if (block == nil) || !block.Raw {
+		return nil
+	}
+
+	if options.eval.curExpr() != block.Expression {
+		// helper is called by a subexpression of raw block open tag
+		return nil
+	}
+
+	return block
+}
+
 //
 // Misc
 //
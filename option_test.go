@@ -0,0 +1,65 @@
+package mario_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionsRawContent(t *testing.T) {
+	t.Parallel()
+
+	source := "{{#block}}{{foo}}{{/block}}\n{{{{raw}}}}\n  {{foo}} {{{{bar}}}}{{{{/bar}}}}\n{{{{/raw}}}}"
+
+	tpl := mario.Must(mario.New().Parse(source))
+	tpl.WithHelperFunc("block", func(options *mario.Options) string {
+		content, ok := options.RawContent()
+		return fmt.Sprintf("%q %t %v", content, ok, options.RawContentLoc())
+	})
+	tpl.WithHelperFunc("raw", func(options *mario.Options) string {
+		content, ok := options.RawContent()
+		return fmt.Sprintf("%q %t %v %q", content, ok, options.RawContentLoc(), options.Fn())
+	})
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, map[string]string{"foo": "bar"}))
+
+	expected := "\"\" false {0 0 0 0 0 0}\n" +
+		"\"\\n  {{foo}} {{{{bar}}}}{{{{/bar}}}}\\n\" true {39 2 11 74 4 0} \"  {{foo}} {{{{bar}}}}{{{{/bar}}}}\\n\""
+	require.Equal(t, expected, b.String())
+}
+
+func TestOptionsRawContent_Empty(t *testing.T) {
+	t.Parallel()
+
+	tpl := mario.Must(mario.New().Parse("x\n{{{{raw}}}}{{{{/raw}}}}"))
+	tpl.WithHelperFunc("raw", func(options *mario.Options) string {
+		content, ok := options.RawContent()
+		return fmt.Sprintf("%q %t %+v %q", content, ok, options.RawContentLoc(), options.Fn())
+	})
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, nil))
+	require.Equal(t, "x\n\"\" true {Pos:13 Line:2 Column:11 EndPos:13 EndLine:2 EndColumn:11} \"\"", b.String())
+}
+
+func TestOptionsRawContent_SubExpression(t *testing.T) {
+	t.Parallel()
+
+	tpl := mario.Must(mario.New().Parse("{{{{raw (sub)}}}}content{{{{/raw}}}}"))
+	tpl.WithHelperFunc("sub", func(options *mario.Options) string {
+		content, ok := options.RawContent()
+		return fmt.Sprintf("%q %t %v", content, ok, options.RawContentLoc())
+	})
+	tpl.WithHelperFunc("raw", func(sub string, options *mario.Options) string {
+		content, ok := options.RawContent()
+		return fmt.Sprintf("%s|%q %t", sub, content, ok)
+	})
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, nil))
+	require.Equal(t, "\"\" false {0 0 0 0 0 0}|\"content\" true", b.String())
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/imantung/mario/ast"
+	"github.com/imantung/mario/lexer"
+)
+
+// Error is a syntax error.
+type Error struct {
+	// Message describes the error
+	Message string
+
+	// Loc is the location of the error in input. For an unclosed block, this is where the close tag was expected.
+	Loc ast.Loc
+
+	// Open is the location of the open tag of an unclosed block, nil for other errors
+	Open *ast.Loc
+}
+
+// Error implements the error interface.
+func (err *Error) Error() string {
+	return fmt.Sprintf("Parse error on line %d:\n%s", err.Loc.Line, err.Message)
+}
+
+// newTokenError instanciates an Error located at given token
+func newTokenError(tok *lexer.Token, msg string) *Error {
+	return &Error{
+		Message: msg,
+		Loc:     ast.Loc{Pos: tok.Pos, Line: tok.Line},
+	}
+}
+
+// newUnclosedError instanciates an Error for given block, that is not closed at given token
+func newUnclosedError(block *ast.BlockStatement, tok *lexer.Token) *Error {
+	open := block.Location()
+
+	result := newTokenError(tok, fmt.Sprintf("Expecting %s to close block '%s' opened on line %d, got: '%s'",
+		lexer.TokenOpenEndBlock, block.Expression.Canonical(), open.Line, tok))
+	result.Open = &open
+
+	return result
+}
+
+// errRecover recovers parsing panic
+func errRecover(errp *error) {
+	e := recover()
+	if e != nil {
+		switch err := e.(type) {
+		case runtime.Error:
+			panic(e)
+		case error:
+			*errp = err
+		default:
+			panic(e)
+		}
+	}
+}
+
+// errNode panics with given node infos
+func errNode(node ast.Node, msg string) {
+	panic(&Error{
+		Message: fmt.Sprintf("%s\nNode: %s", msg, node),
+		Loc:     node.Location(),
+	})
+}
+
+// errToken panics with given Token infos
+func errToken(tok *lexer.Token, msg string) {
+	panic(newTokenError(tok, fmt.Sprintf("%s\nToken: %s", msg, tok)))
+}
+
+// errExpected panics because of an unexpected Token kind
+func errExpected(expect lexer.TokenKind, tok *lexer.Token) {
+	panic(newTokenError(tok, fmt.Sprintf("Expecting %s, got: '%s'", expect, tok)))
+}
@@ -4,8 +4,9 @@ package parser
 import (
 	"fmt"
 	"regexp"
-	"runtime"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/imantung/mario/ast"
 	"github.com/imantung/mario/lexer"
@@ -20,35 +21,86 @@ type parser struct {
 	// Lexer
 	lex *lexer.Lexer
 
+	// Parsed input
+	input string
+
+	// Parsing options
+	opts Options
+
+	// Current delimiters, they change with set delimiters tags in Mustache mode
+	open  string
+	close string
+
+	// Comments delimiters, for current delimiters
+	rOpenComment  *regexp.Regexp
+	rCloseComment *regexp.Regexp
+
 	// Root node
 	root ast.Node
 
 	// Tokens parsed but not consumed yet
 	tokens []*lexer.Token
 
+	// Byte position following the last consumed token
+	end int
+
 	// All tokens have been retreieved from lexer
 	lexOver bool
+
+	// Recovery mode: syntax errors are recorded instead of stopping parsing
+	recovering bool
+
+	// Syntax errors recorded in recovery mode
+	errors []*Error
 }
 
-var (
-	rOpenComment  = regexp.MustCompile(`^\{\{~?!-?-?`)
-	rCloseComment = regexp.MustCompile(`-?-?~?\}\}$`)
-	rOpenAmp      = regexp.MustCompile(`^\{\{~?&`)
-)
+// Options holds parsing options.
+type Options struct {
+	// Mustache enables Mustache compatibility mode: set delimiters tags are parsed, and dynamic partials names
+	// `{{>*name}}` are parsed as sub-expressions
+	Mustache bool
+
+	// Delims are the initial open and close delimiters. Default ones are used if empty.
+	Delims [2]string
+
+	// IgnoreStandalone disables standalone tags detection: whitespaces and newline around a block, partial or comment
+	// tag that is alone on its line are kept
+	IgnoreStandalone bool
+}
 
 // new instanciates a new parser
-func new(input string) *parser {
-	return &parser{
-		lex: lexer.Scan(input),
+func new(input string, opts Options, recovering bool) *parser {
+	result := &parser{
+		lex: lexer.ScanWithOptions(input, lexer.Options{
+			Mustache: opts.Mustache,
+			Delims:   opts.Delims,
+			Recover:  recovering,
+		}),
+		input:      input,
+		opts:       opts,
+		recovering: recovering,
+	}
+
+	open, close := opts.Delims[0], opts.Delims[1]
+	if (open == "") || (close == "") {
+		open, close = lexer.DefaultOpenDelim, lexer.DefaultCloseDelim
 	}
+	result.setDelims(open, close)
+
+	return result
 }
 
 // Parse analyzes given input and returns the AST root node.
-func Parse(input string) (result *ast.Program, err error) {
+func Parse(input string) (*ast.Program, error) {
+	return ParseWithOptions(input, Options{})
+}
+
+// ParseWithOptions analyzes given input with given options and returns the AST root node.
+func ParseWithOptions(input string, opts Options) (result *ast.Program, err error) {
 	// recover error
 	defer errRecover(&err)
 
-	parser := new(input)
+	parser := new(input, opts, false)
 
 	// parse
 	result = parser.parseProgram()
@@ -61,58 +113,130 @@ func Parse(input string) (result *ast.Program, err error) {
 	}
 
 	// fix whitespaces
-	processWhitespaces(result)
+	processWhitespaces(result, parser.opts.IgnoreStandalone)
 
 	// named returned values
 	return
 }
 
-// errRecover recovers parsing panic
-func errRecover(errp *error) {
-	e := recover()
-	if e != nil {
-		switch err := e.(type) {
-		case runtime.Error:
-			panic(e)
-		case error:
-			*errp = err
-		default:
-			panic(e)
+// ParseWithRecovery analyzes given input with given options, without stopping at the first syntax error.
+//
+// After a syntax error, parsing resumes at the next mustache or close tag: erroneous statements are missing from the
+// returned partial AST, and unclosed blocks are closed at the end of input. All errors are returned.
+func ParseWithRecovery(input string, opts Options) (result *ast.Program, errs []*Error) {
+	parser := new(input, opts, true)
+
+	defer func() {
+		// safety net: an error that escaped recovery ends parsing
+		if e := recover(); e != nil {
+			err, ok := e.(*Error)
+			if !ok {
+				panic(e)
+			}
+
+			parser.errors = append(parser.errors, err)
+			errs = parser.errors
 		}
+	}()
+
+	// parse
+	result = parser.parseProgram()
+
+	// stray tokens
+	for !parser.isToken(lexer.TokenEOF) {
+		parser.skipStray()
+		parser.parseStatements(result)
 	}
-}
 
-// errPanic panics
-func errPanic(err error, line int) {
-	panic(fmt.Errorf("Parse error on line %d:\n%s", line, err))
+	// fix whitespaces
+	processWhitespaces(result, parser.opts.IgnoreStandalone)
+
+	return result, parser.errors
 }
 
-// errNode panics with given node infos
-func errNode(node ast.Node, msg string) {
-	errPanic(fmt.Errorf("%s\nNode: %s", msg, node), node.Location().Line)
+// try calls given function. In recovery mode, a syntax error raised by that function is recorded, the rest of the
+// erroneous tag is skipped, and false is returned.
+func (p *parser) try(fn func()) (ok bool) {
+	if p.recovering {
+		defer func() {
+			if e := recover(); e != nil {
+				err, isErr := e.(*Error)
+				if !isErr {
+					panic(e)
+				}
+
+				p.errors = append(p.errors, err)
+				p.skipTag()
+
+				ok = false
+			}
+		}()
+	}
+
+	fn()
+
+	return true
 }
 
-// errNode panics with given Token infos
-func errToken(tok *lexer.Token, msg string) {
-	errPanic(fmt.Errorf("%s\nToken: %s", msg, tok), tok.Line)
+// skipTag skips tokens up to the end of current tag, stopping before a token that starts a statement or a block part
+func (p *parser) skipTag() {
+	for {
+		switch p.next().Kind {
+		case lexer.TokenEOF, lexer.TokenError, lexer.TokenContent, lexer.TokenComment,
+			lexer.TokenOpen, lexer.TokenOpenUnescaped, lexer.TokenOpenBlock, lexer.TokenOpenInverse,
+			lexer.TokenOpenRawBlock, lexer.TokenOpenPartial, lexer.TokenOpenEndBlock, lexer.TokenOpenEndRawBlock,
+			lexer.TokenInverse, lexer.TokenOpenInverseChain:
+			return
+		case lexer.TokenClose, lexer.TokenCloseUnescaped, lexer.TokenCloseRawBlock:
+			p.shift()
+			return
+		}
+
+		p.shift()
+	}
 }
 
-// errNode panics because of an unexpected Token kind
-func errExpected(expect lexer.TokenKind, tok *lexer.Token) {
-	errPanic(fmt.Errorf("Expecting %s, got: '%s'", expect, tok), tok.Line)
+// skipStray records an error for next token, that can't be parsed at that place, and skips its tag
+func (p *parser) skipStray() {
+	p.try(func() {
+		tok := p.shift()
+		if tok.Kind == lexer.TokenOpenEndBlock {
+			errToken(tok, "Unexpected close block")
+		}
+
+		errToken(tok, "Syntax error")
+	})
 }
 
 // program : statement*
 func (p *parser) parseProgram() *ast.Program {
 	result := ast.NewProgram(p.next().Pos, p.next().Line)
 
-	for p.isStatement() {
-		result.AddStatement(p.parseStatement())
-	}
+	p.parseStatements(result)
+
+	p.locate(&result.Loc)
 
 	return result
 }
 
+// parseStatements parses all following statements, and adds them to given program
+func (p *parser) parseStatements(program *ast.Program) {
+	for {
+		if p.isStatement() {
+			var statement ast.Node
+
+			if p.try(func() { statement = p.parseStatement() }) {
+				program.AddStatement(statement)
+			}
+		} else if p.recovering && p.isToken(lexer.TokenError) {
+			// lexer resumed scanning after that error
+			p.try(func() { p.shift() })
+		} else {
+			return
+		}
+	}
+}
+
 // statement : mustache | block | rawBlock | partial | content | COMMENT
 func (p *parser) parseStatement() ast.Node {
 	var result ast.Node
@@ -171,7 +295,10 @@ func (p *parser) parseContent() *ast.ContentStatement {
 		errExpected(lexer.TokenContent, tok)
 	}
 
-	return ast.NewContentStatement(tok.Pos, tok.Line, tok.Val)
+	result := ast.NewContentStatement(tok.Pos, tok.Line, tok.Val)
+	p.locate(&result.Loc)
+
+	return result
 }
 
 // COMMENT
@@ -179,15 +306,67 @@ func (p *parser) parseComment() *ast.CommentStatement {
 	// COMMENT
 	tok := p.shift()
 
-	value := rOpenComment.ReplaceAllString(tok.Val, "")
-	value = rCloseComment.ReplaceAllString(value, "")
+	if p.opts.Mustache && strings.HasPrefix(tok.Val, p.open+"=") {
+		return p.parseSetDelims(tok)
+	}
+
+	value := p.rOpenComment.ReplaceAllString(tok.Val, "")
+	value = p.rCloseComment.ReplaceAllString(value, "")
+
+	result := ast.NewCommentStatement(tok.Pos, tok.Line, value)
+	result.Strip = p.newStripForStr(tok.Val)
+	p.locate(&result.Loc)
+
+	return result
+}
+
+// parseSetDelims parses a set delimiters tag, that is lexed as a comment, and switches to new delimiters
+func (p *parser) parseSetDelims(tok *lexer.Token) *ast.CommentStatement {
+	value := strings.TrimSuffix(strings.TrimPrefix(tok.Val, p.open+"="), "="+p.close)
+
+	open, close, err := lexer.ParseSetDelims(value)
+	if err != nil {
+		// should never happen as it is caught by lexer
+		errToken(tok, err.Error())
+	}
 
 	result := ast.NewCommentStatement(tok.Pos, tok.Line, value)
-	result.Strip = ast.NewStripForStr(tok.Val)
+	result.Strip = &ast.Strip{}
+	p.locate(&result.Loc)
+
+	p.setDelims(open, close)
 
 	return result
 }
 
+// setDelims sets current delimiters
+func (p *parser) setDelims(open string, close string) {
+	o := regexp.QuoteMeta(open)
+	c := regexp.QuoteMeta(close)
+
+	p.open = open
+	p.close = close
+	p.rOpenComment = regexp.MustCompile(`^` + o + `~?!-?-?`)
+	p.rCloseComment = regexp.MustCompile(`-?-?~?` + c + `$`)
+}
+
+// newStrip instanciates a Strip for given open and close mustaches, with current delimiters
+func (p *parser) newStrip(openStr string, closeStr string) *ast.Strip {
+	if (p.open == lexer.DefaultOpenDelim) && (p.close == lexer.DefaultCloseDelim) {
+		return ast.NewStrip(openStr, closeStr)
+	}
+
+	return &ast.Strip{
+		Open:  (len(openStr) > len(p.open)) && openStr[len(p.open)] == '~',
+		Close: (len(closeStr) > len(p.close)) && closeStr[len(closeStr)-len(p.close)-1] == '~',
+	}
+}
+
+// newStripForStr instanciates a Strip for given tag, with current delimiters
+func (p *parser) newStripForStr(str string) *ast.Strip {
+	return p.newStrip(str, str)
+}
+
 // param* hash?
 func (p *parser) parseExpressionParamsHash() ([]ast.Node, *ast.Hash) {
 	var params []ast.Node
@@ -239,14 +418,22 @@ func (p *parser) parseRawBlock() *ast.BlockStatement {
 		errExpected(lexer.TokenCloseRawBlock, tok)
 	}
 
-	// content
-	// @todo Is content mandatory in a raw block ?
-	content := p.parseContent()
+	// content?
+	program := ast.NewProgram(tok.Pos+len(tok.Val), tok.Line)
+	result.Program = program
+
+	// unprocessed content is passed to helper
+	result.Raw = true
 
-	program := ast.NewProgram(tok.Pos, tok.Line)
-	program.AddStatement(content)
+	if p.isToken(lexer.TokenContent) {
+		content := p.parseContent()
 
-	result.Program = program
+		program.AddStatement(content)
+		result.RawContent = content.Value
+	}
+
+	// program of an empty raw block is located just after the open tag
+	p.locate(&program.Loc)
 
 	// OPEN_END_RAW_BLOCK
 	tok = p.shift()
@@ -273,6 +460,8 @@ func (p *parser) parseRawBlock() *ast.BlockStatement {
 		errExpected(lexer.TokenCloseRawBlock, tok)
 	}
 
+	p.locateBlock(result)
+
 	return result
 }
 
@@ -280,6 +469,7 @@ func (p *parser) parseRawBlock() *ast.BlockStatement {
 func (p *parser) parseBlock() *ast.BlockStatement {
 	// openBlock
 	result, blockParams := p.parseOpenBlock()
+	rawStart := p.next().Pos
 
 	// program
 	program := p.parseProgram()
@@ -292,10 +482,12 @@ func (p *parser) parseBlock() *ast.BlockStatement {
 	}
 
 	// closeBlock
-	p.parseCloseBlock(result)
+	p.parseCloseBlock(result, rawStart)
 
 	setBlockInverseStrip(result)
 
+	p.locateBlock(result)
+
 	return result
 }
 
@@ -318,10 +510,17 @@ func setBlockInverseStrip(block *ast.BlockStatement) {
 	block.InverseStrip = block.Inverse.Strip
 }
 
+// locateBlock sets the location of given block, that ends with the last consumed token
+func (p *parser) locateBlock(block *ast.BlockStatement) {
+	p.locate(&block.Loc)
+	block.Expression.Loc = block.Loc
+}
+
 // block : openInverse program inverseAndProgram? closeBlock
 func (p *parser) parseInverse() *ast.BlockStatement {
 	// openInverse
 	result, blockParams := p.parseOpenBlock()
+	rawStart := p.next().Pos
 
 	// program
 	program := p.parseProgram()
@@ -335,10 +534,12 @@ func (p *parser) parseInverse() *ast.BlockStatement {
 	}
 
 	// closeBlock
-	p.parseCloseBlock(result)
+	p.parseCloseBlock(result, rawStart)
 
 	setBlockInverseStrip(result)
 
+	p.locateBlock(result)
+
 	return result
 }
 
@@ -386,9 +587,13 @@ func (p *parser) parseInverseChain() *ast.Program {
 
 	setBlockInverseStrip(block)
 
+	p.locateBlock(block)
+
 	result.Chained = true
 	result.AddStatement(block)
 
+	p.locate(&result.Loc)
+
 	return result
 }
 
@@ -404,7 +609,7 @@ func (p *parser) parseInverseAndProgram() *ast.Program {
 
 	// program
 	result := p.parseProgram()
-	result.Strip = ast.NewStripForStr(tok.Val)
+	result.Strip = p.newStripForStr(tok.Val)
 
 	return result
 }
@@ -413,52 +618,119 @@ func (p *parser) parseInverseAndProgram() *ast.Program {
 // openInverse : OPEN_INVERSE helperName param* hash? blockParams? CLOSE
 // openInverseChain: OPEN_INVERSE_CHAIN helperName param* hash? blockParams? CLOSE
 func (p *parser) parseOpenBlock() (*ast.BlockStatement, []string) {
+	var result *ast.BlockStatement
+	var blockParams []string
+
 	// OPEN_BLOCK | OPEN_INVERSE | OPEN_INVERSE_CHAIN
 	tok := p.shift()
 
-	// helperName param* hash? blockParams?
-	result, blockParams := p.parseOpenBlockExpression(tok)
+	ok := p.try(func() {
+		// helperName param* hash? blockParams?
+		result, blockParams = p.parseOpenBlockExpression(tok)
 
-	// CLOSE
-	tokClose := p.shift()
-	if tokClose.Kind != lexer.TokenClose {
-		errExpected(lexer.TokenClose, tokClose)
+		// CLOSE
+		tokClose := p.shift()
+		if tokClose.Kind != lexer.TokenClose {
+			errExpected(lexer.TokenClose, tokClose)
+		}
+
+		result.OpenStrip = p.newStrip(tok.Val, tokClose.Val)
+	})
+
+	if !ok {
+		// erroneous open tag is replaced by an anonymous one, so that block content is still parsed
+		result = ast.NewBlockStatement(tok.Pos, tok.Line)
+		result.Expression = ast.NewExpression(tok.Pos, tok.Line)
+		result.Expression.Path = ast.NewStringLiteral(tok.Pos, tok.Line, "")
+		result.OpenStrip = &ast.Strip{}
+		blockParams = nil
 	}
 
-	result.OpenStrip = ast.NewStrip(tok.Val, tokClose.Val)
+	if p.opts.Mustache {
+		result.Delims = [2]string{p.open, p.close}
+
+		switch strings.TrimPrefix(strings.TrimPrefix(tok.Val, p.open), "~") {
+		case "$":
+			result.Inheritance = ast.InheritanceBlock
+		case "<":
+			result.Inheritance = ast.InheritanceParent
+		}
+	}
 
 	// named returned values
 	return result, blockParams
 }
 
 // closeBlock : OPEN_ENDBLOCK helperName CLOSE
-func (p *parser) parseCloseBlock(block *ast.BlockStatement) {
+//
+// rawStart is the position of block content in input.
+func (p *parser) parseCloseBlock(block *ast.BlockStatement, rawStart int) {
+	for p.recovering && !p.isToken(lexer.TokenOpenEndBlock) {
+		if p.isToken(lexer.TokenEOF) {
+			// unclosed block is closed at end of input
+			p.errors = append(p.errors, newUnclosedError(block, p.next()))
+			block.CloseStrip = &ast.Strip{}
+			return
+		}
+
+		p.skipStray()
+
+		// following statements are kept in block
+		p.parseStatements(lastProgram(block))
+	}
+
 	// OPEN_ENDBLOCK
 	tok := p.shift()
-	if tok.Kind != lexer.TokenOpenEndBlock {
+	if tok.Kind == lexer.TokenEOF {
+		panic(newUnclosedError(block, tok))
+	} else if tok.Kind != lexer.TokenOpenEndBlock {
 		errExpected(lexer.TokenOpenEndBlock, tok)
 	}
 
-	// helperName
-	endID := p.parseHelperName()
-
-	closeName, ok := ast.HelperNameStr(endID)
-	if !ok {
-		errNode(endID, "Erroneous closing expression")
+	if p.opts.Mustache {
+		// raw content is passed to Mustache lambdas
+		block.RawContent = p.input[rawStart:tok.Pos]
 	}
 
-	openName := block.Expression.Canonical()
-	if openName != closeName {
-		errNode(endID, fmt.Sprintf("%s doesn't match %s", openName, closeName))
-	}
+	p.try(func() {
+		// helperName
+		endID := p.parseHelperName()
 
-	// CLOSE
-	tokClose := p.shift()
-	if tokClose.Kind != lexer.TokenClose {
-		errExpected(lexer.TokenClose, tokClose)
+		closeName, ok := ast.HelperNameStr(endID)
+		if !ok {
+			errNode(endID, "Erroneous closing expression")
+		}
+
+		openName := block.Expression.Canonical()
+		if (openName != closeName) && !(p.recovering && (openName == "")) {
+			errNode(endID, fmt.Sprintf("%s doesn't match %s", openName, closeName))
+		}
+
+		// CLOSE
+		tokClose := p.shift()
+		if tokClose.Kind != lexer.TokenClose {
+			errExpected(lexer.TokenClose, tokClose)
+		}
+
+		block.CloseStrip = p.newStrip(tok.Val, tokClose.Val)
+	})
+}
+
+// lastProgram returns the program of given block that is the last one in input
+func lastProgram(block *ast.BlockStatement) *ast.Program {
+	result := block.Program
+
+	if (block.Inverse != nil) && ((result == nil) || (block.Inverse.Pos > result.Pos)) {
+		result = block.Inverse
+
+		if result.Chained {
+			if chained, ok := result.Body[0].(*ast.BlockStatement); ok {
+				return lastProgram(chained)
+			}
+		}
 	}
 
-	block.CloseStrip = ast.NewStrip(tok.Val, tokClose.Val)
+	return result
 }
 
 // mustache : OPEN helperName param* hash? CLOSE
@@ -473,7 +745,7 @@ func (p *parser) parseMustache() *ast.MustacheStatement {
 	}
 
 	unescaped := false
-	if (tok.Kind == lexer.TokenOpenUnescaped) || (rOpenAmp.MatchString(tok.Val)) {
+	if (tok.Kind == lexer.TokenOpenUnescaped) || p.isOpenAmp(tok) {
 		unescaped = true
 	}
 
@@ -488,11 +760,19 @@ func (p *parser) parseMustache() *ast.MustacheStatement {
 		errExpected(closeToken, tokClose)
 	}
 
-	result.Strip = ast.NewStrip(tok.Val, tokClose.Val)
+	result.Strip = p.newStrip(tok.Val, tokClose.Val)
+
+	p.locate(&result.Loc)
+	result.Expression.Loc = result.Loc
 
 	return result
 }
 
+// isOpenAmp returns true if given OPEN token is `{{&`
+func (p *parser) isOpenAmp(tok *lexer.Token) bool {
+	return strings.HasPrefix(strings.TrimPrefix(strings.TrimPrefix(tok.Val, p.open), "~"), "&")
+}
+
 // partial : OPEN_PARTIAL partialName param* hash? CLOSE
 func (p *parser) parsePartial() *ast.PartialStatement {
 	// OPEN_PARTIAL
@@ -501,7 +781,21 @@ func (p *parser) parsePartial() *ast.PartialStatement {
 	result := ast.NewPartialStatement(tok.Pos, tok.Line)
 
 	// partialName
-	result.Name = p.parsePartialName()
+	if p.opts.Mustache && strings.HasSuffix(tok.Val, "*") {
+		// dynamic name: `{{>*name}}` is `{{> (name)}}`
+		expr := ast.NewExpression(tok.Pos, tok.Line)
+		expr.Path = p.parseHelperName()
+
+		sexpr := ast.NewSubExpression(tok.Pos, tok.Line)
+		sexpr.Expression = expr
+
+		p.locate(&sexpr.Loc)
+		expr.Loc = sexpr.Loc
+
+		result.Name = sexpr
+	} else {
+		result.Name = p.parsePartialName()
+	}
 
 	// param* hash?
 	result.Params, result.Hash = p.parseExpressionParamsHash()
@@ -512,7 +806,9 @@ func (p *parser) parsePartial() *ast.PartialStatement {
 		errExpected(lexer.TokenClose, tokClose)
 	}
 
-	result.Strip = ast.NewStrip(tok.Val, tokClose.Val)
+	result.Strip = p.newStrip(tok.Val, tokClose.Val)
+
+	p.locate(&result.Loc)
 
 	return result
 }
@@ -565,6 +861,9 @@ func (p *parser) parseSexpr() *ast.SubExpression {
 		errExpected(lexer.TokenCloseSexpr, tok)
 	}
 
+	p.locate(&result.Loc)
+	result.Expression.Loc = result.Loc
+
 	return result
 }
 
@@ -580,6 +879,7 @@ func (p *parser) parseHash() *ast.Hash {
 
 	result := ast.NewHash(firstLoc.Pos, firstLoc.Line)
 	result.Pairs = pairs
+	p.locate(&result.Loc)
 
 	return result
 }
@@ -603,6 +903,7 @@ func (p *parser) parseHashSegment() *ast.HashPair {
 	result := ast.NewHashPair(tok.Pos, tok.Line)
 	result.Key = tok.Val
 	result.Val = param
+	p.locate(&result.Loc)
 
 	return result
 }
@@ -642,17 +943,35 @@ func (p *parser) parseHelperName() ast.Node {
 	case lexer.TokenBoolean:
 		// BOOLEAN
 		p.shift()
-		result = ast.NewBooleanLiteral(tok.Pos, tok.Line, (tok.Val == "true"), tok.Val)
+		lit := ast.NewBooleanLiteral(tok.Pos, tok.Line, (tok.Val == "true"), tok.Val)
+		p.locate(&lit.Loc)
+		result = lit
 	case lexer.TokenNumber:
 		// NUMBER
 		p.shift()
 
 		val, isInt := parseNumber(tok)
-		result = ast.NewNumberLiteral(tok.Pos, tok.Line, val, isInt, tok.Val)
+		lit := ast.NewNumberLiteral(tok.Pos, tok.Line, val, isInt, tok.Val)
+		p.locate(&lit.Loc)
+		result = lit
 	case lexer.TokenString:
 		// STRING
 		p.shift()
-		result = ast.NewStringLiteral(tok.Pos, tok.Line, tok.Val)
+		lit := ast.NewStringLiteral(tok.Pos, tok.Line, tok.Val)
+		p.locate(&lit.Loc)
+		result = lit
+	case lexer.TokenUndefined:
+		// UNDEFINED
+		p.shift()
+		lit := ast.NewUndefinedLiteral(tok.Pos, tok.Line)
+		p.locate(&lit.Loc)
+		result = lit
+	case lexer.TokenNull:
+		// NULL
+		p.shift()
+		lit := ast.NewNullLiteral(tok.Pos, tok.Line)
+		p.locate(&lit.Loc)
+		result = lit
 	case lexer.TokenData:
 		// dataName
 		result = p.parseDataName()
@@ -690,7 +1009,7 @@ func parseNumber(tok *lexer.Token) (result float64, isInt bool) {
 // Returns true if next tokens represent a `helperName`
 func (p *parser) isHelperName() bool {
 	switch p.next().Kind {
-	case lexer.TokenBoolean, lexer.TokenNumber, lexer.TokenString, lexer.TokenData, lexer.TokenID:
+	case lexer.TokenBoolean, lexer.TokenNumber, lexer.TokenString, lexer.TokenUndefined, lexer.TokenNull, lexer.TokenData, lexer.TokenID:
 		return true
 	}
 
@@ -705,10 +1024,16 @@ func (p *parser) parsePartialName() ast.Node {
 // dataName : DATA pathSegments
 func (p *parser) parseDataName() *ast.PathExpression {
 	// DATA
-	p.shift()
+	tok := p.shift()
 
 	// pathSegments
-	return p.parsePath(true)
+	result := p.parsePath(true)
+
+	// data name location includes DATA token
+	result.Loc = ast.Loc{Pos: tok.Pos, Line: tok.Line}
+	p.locate(&result.Loc)
+
+	return result
 }
 
 // path : pathSegments
@@ -747,6 +1072,8 @@ func (p *parser) parsePath(data bool) *ast.PathExpression {
 		}
 	}
 
+	p.locate(&result.Loc)
+
 	return result
 }
 
@@ -766,7 +1093,7 @@ func (p *parser) ensure(index int) {
 		// queue it
 		p.tokens = append(p.tokens, &tok)
 
-		if (tok.Kind == lexer.TokenEOF) || (tok.Kind == lexer.TokenError) {
+		if (tok.Kind == lexer.TokenEOF) || ((tok.Kind == lexer.TokenError) && !p.recovering) {
 			p.lexOver = true
 			break
 		}
@@ -794,22 +1121,66 @@ func (p *parser) next() *lexer.Token {
 
 // shift returns next token and remove it from the tokens buffer
 //
-// Panics if next token is `TokenError`
+// Panics if next token is `TokenError`. The `TokenEOF` token is never removed.
 func (p *parser) shift() *lexer.Token {
 	var result *lexer.Token
 
 	p.ensure(0)
 
-	result, p.tokens = p.tokens[0], p.tokens[1:]
+	result = p.tokens[0]
+	if result.Kind != lexer.TokenEOF {
+		// EOF is never consumed
+		p.tokens = p.tokens[1:]
+	}
 
 	// check error token
 	if result.Kind == lexer.TokenError {
 		errToken(result, "Lexer error")
 	}
 
+	p.end = p.tokenEnd(result)
+
 	return result
 }
 
+// tokenEnd returns the byte position following given token in input
+func (p *parser) tokenEnd(tok *lexer.Token) int {
+	if tok.Kind != lexer.TokenString {
+		return tok.Pos + len(tok.Val)
+	}
+
+	// string value starts after its delimiter, and escaped delimiters are unescaped in value
+	delim := p.input[tok.Pos-1]
+	for i := tok.Pos; i < len(p.input); i++ {
+		if (p.input[i] == delim) && (p.input[i-1] != '\\') {
+			return i + 1
+		}
+	}
+
+	return len(p.input)
+}
+
+// locate sets the column and end of given location, the node ending with the last consumed token
+func (p *parser) locate(loc *ast.Loc) {
+	end := p.end
+	if end < loc.Pos {
+		// empty node
+		end = loc.Pos
+	}
+
+	loc.Column = p.column(loc.Pos)
+	loc.EndPos = end
+	loc.EndLine = loc.Line + strings.Count(p.input[loc.Pos:end], "\n")
+	loc.EndColumn = p.column(end)
+}
+
+// column returns the column of given byte position in input
+func (p *parser) column(pos int) int {
+	start := strings.LastIndexByte(p.input[:pos], '\n') + 1
+
+	return utf8.RuneCountInString(p.input[start:pos])
+}
+
 // isToken returns true if next token is of given type
 func (p *parser) isToken(kind lexer.TokenKind) bool {
 	return p.have(1) && p.next().Kind == kind
@@ -2,7 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"io/ioutil"
 	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/imantung/mario/ast"
@@ -24,11 +26,13 @@ var parserTests = []parserTest{
 	{"parses simple mustaches (2)", `{{"foo"}}`, "{{ \"foo\" [] }}\n"},
 	{"parses simple mustaches (3)", `{{false}}`, "{{ BOOLEAN{false} [] }}\n"},
 	{"parses simple mustaches (4)", `{{true}}`, "{{ BOOLEAN{true} [] }}\n"},
-	{"parses simple mustaches (5)", `{{foo}}`, "{{ PATH:foo [] }}\n"},
-	{"parses simple mustaches (6)", `{{foo?}}`, "{{ PATH:foo? [] }}\n"},
-	{"parses simple mustaches (7)", `{{foo_}}`, "{{ PATH:foo_ [] }}\n"},
-	{"parses simple mustaches (8)", `{{foo-}}`, "{{ PATH:foo- [] }}\n"},
-	{"parses simple mustaches (9)", `{{foo:}}`, "{{ PATH:foo: [] }}\n"},
+	{"parses simple mustaches (5)", `{{undefined}}`, "{{ UNDEFINED [] }}\n"},
+	{"parses simple mustaches (6)", `{{null}}`, "{{ NULL [] }}\n"},
+	{"parses simple mustaches (7)", `{{foo}}`, "{{ PATH:foo [] }}\n"},
+	{"parses simple mustaches (8)", `{{foo?}}`, "{{ PATH:foo? [] }}\n"},
+	{"parses simple mustaches (9)", `{{foo_}}`, "{{ PATH:foo_ [] }}\n"},
+	{"parses simple mustaches (10)", `{{foo-}}`, "{{ PATH:foo- [] }}\n"},
+	{"parses simple mustaches (11)", `{{foo:}}`, "{{ PATH:foo: [] }}\n"},
 
 	{"parses simple mustaches with data", `{{@foo}}`, "{{ @PATH:foo [] }}\n"},
 	{"parses simple mustaches with data paths", `{{@../foo}}`, "{{ @PATH:foo [] }}\n"},
@@ -40,6 +44,9 @@ var parserTests = []parserTest{
 	{"parses mustaches with NUMBER parameters", `{{foo 1}}`, "{{ PATH:foo [NUMBER{1}] }}\n"},
 	{"parses mustaches with BOOLEAN parameters (1)", `{{foo true}}`, "{{ PATH:foo [BOOLEAN{true}] }}\n"},
 	{"parses mustaches with BOOLEAN parameters (2)", `{{foo false}}`, "{{ PATH:foo [BOOLEAN{false}] }}\n"},
+	{"parses mustaches with undefined and null parameters", `{{foo undefined null}}`, "{{ PATH:foo [UNDEFINED, NULL] }}\n"},
+	{"parses mustaches with undefined and null hash arguments", `{{foo bar=undefined baz=null}}`, "{{ PATH:foo [] HASH{bar=UNDEFINED, baz=NULL} }}\n"},
+	{"parses paths and hash keys named null", `{{null.foo bar=[null] null=1}}`, "{{ PATH:null/foo [] HASH{bar=PATH:[null], null=NUMBER{1}} }}\n"},
 	{"parses mustaches with DATA parameters", `{{foo @bar}}`, "{{ PATH:foo [@PATH:bar] }}\n"},
 
 	{"parses mustaches with hash arguments (01)", `{{foo bar=baz}}`, "{{ PATH:foo [] HASH{bar=PATH:baz} }}\n"},
@@ -101,6 +108,98 @@ func TestParser(t *testing.T) {
 	}
 }
 
+var mustacheParserTests = []parserTest{
+	{"parses set delimiters tag", `{{=<% %>=}}<%foo%>{{bar}}`, "{{! '<% %>' }}\n{{ PATH:foo [] }}\nCONTENT[ '{{bar}}' ]\n"},
+	{"parses whitespace control with new delimiters", `{{=<% %>=}}<%foo%> <%~ bar ~%>`, "{{! '<% %>' }}\n{{ PATH:foo [] }}\nCONTENT[ '' ]\n{{ PATH:bar [] }}\n"},
+	{"parses comments and unescaped mustaches with new delimiters", `{{=[ ]=}}[! note ][&foo]`, "{{! '[ ]' }}\n{{! ' note ' }}\n{{ PATH:foo [] }}\n"},
+	{"parses dynamic partial", `{{>*name}}`, "{{> PARTIAL:name [] }}\n"},
+}
+
+func TestParser_Mustache(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range mustacheParserTests {
+		output := ""
+
+		node, err := ParseWithOptions(test.input, Options{Mustache: true})
+		if err == nil {
+			output = ast.Print(node)
+		}
+
+		if (err != nil) || (test.output != output) {
+			t.Errorf("Test '%s' failed\ninput:\n\t'%s'\nexpected\n\t%q\ngot\n\t%q\nerror:\n\t%s", test.name, test.input, test.output, output, err)
+		}
+	}
+}
+
+func TestParser_MustacheBlocks(t *testing.T) {
+	t.Parallel()
+
+	program, err := ParseWithOptions("{{=| |=}}|#foo| {{x}} |/foo||<parent||$block|x|/block||/parent|", Options{Mustache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := program.Body[1].(*ast.BlockStatement)
+	if (block.RawContent != " {{x}} ") || (block.Delims != [2]string{"|", "|"}) {
+		t.Errorf("Unexpected block raw content %q and delimiters %q", block.RawContent, block.Delims)
+	}
+
+	parent := program.Body[2].(*ast.BlockStatement)
+	if (parent.Inheritance != ast.InheritanceParent) || (parent.Program.Body[0].(*ast.BlockStatement).Inheritance != ast.InheritanceBlock) {
+		t.Errorf("Unexpected inheritance tags: %s", ast.Print(program))
+	}
+}
+
+func TestParser_RawBlocks(t *testing.T) {
+	t.Parallel()
+
+	program, err := Parse("{{#foo}} {{/foo}}\n  {{{{raw}}}}\n  {{bar}}\n  {{{{/raw}}}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block := program.Body[0].(*ast.BlockStatement)
+	if block.Raw || (block.RawContent != "") {
+		t.Errorf("Unexpected raw block: %s", ast.Print(program))
+	}
+
+	raw := program.Body[2].(*ast.BlockStatement)
+	if !raw.Raw || (raw.RawContent != "\n  {{bar}}\n  ") {
+		t.Errorf("Unexpected raw block raw content %q", raw.RawContent)
+	}
+}
+
+func TestParser_Locations(t *testing.T) {
+	t.Parallel()
+
+	program, err := Parse("\u00e9{{foo\n  \"a\\\"b\" @x k=(y 1)}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustache := program.Body[1].(*ast.MustacheStatement)
+	params := mustache.Expression.Params
+
+	tests := []struct {
+		node     ast.Node
+		expected ast.Loc
+	}{
+		{program, ast.Loc{Pos: 0, Line: 1, Column: 0, EndPos: 30, EndLine: 3, EndColumn: 0}},
+		{mustache, ast.Loc{Pos: 2, Line: 1, Column: 1, EndPos: 29, EndLine: 2, EndColumn: 21}},
+		{params[0], ast.Loc{Pos: 11, Line: 2, Column: 3, EndPos: 16, EndLine: 2, EndColumn: 8}},
+		{params[1], ast.Loc{Pos: 17, Line: 2, Column: 9, EndPos: 19, EndLine: 2, EndColumn: 11}},
+		{mustache.Expression.Hash, ast.Loc{Pos: 20, Line: 2, Column: 12, EndPos: 27, EndLine: 2, EndColumn: 19}},
+		{mustache.Expression.Hash.Pairs[0].Val, ast.Loc{Pos: 22, Line: 2, Column: 14, EndPos: 27, EndLine: 2, EndColumn: 19}},
+	}
+
+	for _, test := range tests {
+		if loc := test.node.Location(); loc != test.expected {
+			t.Errorf("Unexpected location of %s\nexpected\n\t%+v\ngot\n\t%+v", test.node, test.expected, loc)
+		}
+	}
+}
+
 var parserErrorTests = []parserTest{
 	{"lexer error", `{{! unclosed comment`, "Lexer error"},
 	{"syntax error", `foo{{^}}`, "Syntax error"},
@@ -180,6 +279,110 @@ func TestParserErrors(t *testing.T) {
 	}
 }
 
+type parserRecoveryTest struct {
+	name   string
+	input  string
+	output string
+	errors []string
+}
+
+var parserRecoveryTests = []parserRecoveryTest{
+	{
+		"resumes after erroneous mustaches",
+		"a {{foo bar=}} b {{baz}} c\n{{qux (}} d",
+		"CONTENT[ 'a ' ]\nCONTENT[ ' b ' ]\n{{ PATH:baz [] }}\nCONTENT[ ' c\n' ]\nCONTENT[ ' d' ]\n",
+		[]string{"1:12: Expecting ID, got: 'Close{\"}}\"}'", "2:34: Expecting ID, got: 'Close{\"}}\"}'"},
+	},
+	{
+		"resumes after lexer errors",
+		"{{foo %}} a {{bar}} b {{baz",
+		"CONTENT[ ' a ' ]\n{{ PATH:bar [] }}\nCONTENT[ ' b ' ]\n",
+		[]string{"1:6: Lexer error", "1:27: Lexer error"},
+	},
+	{
+		"keeps content of a block with an erroneous open tag",
+		"{{#foo %}}a{{/foo}}b",
+		"BLOCK:\n  \"\" []\n  PROGRAM:\n    CONTENT[ 'a' ]\n  CONTENT[ 'b' ]\n",
+		[]string{"1:7: Lexer error"},
+	},
+	{
+		"keeps a block with an erroneous close tag",
+		"{{#if a}}x{{/each}}y",
+		"BLOCK:\n  PATH:if [PATH:a]\n  PROGRAM:\n    CONTENT[ 'x' ]\n  CONTENT[ 'y' ]\n",
+		[]string{"1:13: if doesn't match each"},
+	},
+	{
+		"reports unclosed blocks",
+		"{{#if a}}\nx{{#each b}}y",
+		"BLOCK:\n  PATH:if [PATH:a]\n  PROGRAM:\n    CONTENT[ 'x' ]\n    BLOCK:\n      PATH:each [PATH:b]\n      PROGRAM:\n        CONTENT[ 'y' ]\n",
+		[]string{
+			"2:23: Expecting OpenEndBlock to close block 'each' opened on line 2, got: 'EOF' (opened at 2:11)",
+			"2:23: Expecting OpenEndBlock to close block 'if' opened on line 1, got: 'EOF' (opened at 1:0)",
+		},
+	},
+	{
+		"keeps statements following a stray inverse in block",
+		"{{#if a}}x{{else}}y{{else}}z{{/if}}",
+		"BLOCK:\n  PATH:if [PATH:a]\n  PROGRAM:\n    CONTENT[ 'x' ]\n  {{^}}\n    CONTENT[ 'y' ]\n    CONTENT[ 'z' ]\n",
+		[]string{"1:19: Syntax error"},
+	},
+	{
+		"skips stray close blocks",
+		"{{/foo}}a{{bar}}{{^}}",
+		"CONTENT[ 'a' ]\n{{ PATH:bar [] }}\n",
+		[]string{"1:0: Unexpected close block", "1:16: Syntax error"},
+	},
+}
+
+// recoveryErrorStr returns a string representation of given error, with its location and first message line
+func recoveryErrorStr(err *Error) string {
+	result := fmt.Sprintf("%d:%d: %s", err.Loc.Line, err.Loc.Pos, strings.SplitN(err.Message, "\n", 2)[0])
+	if err.Open != nil {
+		result += fmt.Sprintf(" (opened at %d:%d)", err.Open.Line, err.Open.Pos)
+	}
+
+	return result
+}
+
+func TestParseWithRecovery(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range parserRecoveryTests {
+		program, errs := ParseWithRecovery(test.input, Options{})
+
+		var errors []string
+		for _, err := range errs {
+			errors = append(errors, recoveryErrorStr(err))
+		}
+
+		if output := ast.Print(program); (output != test.output) || (fmt.Sprint(errors) != fmt.Sprint(test.errors)) {
+			t.Errorf("Test '%s' failed\ninput:\n\t'%s'\nexpected\n\t%q\n\t%q\ngot\n\t%q\n\t%q", test.name, test.input, test.output, test.errors, output, errors)
+		}
+	}
+}
+
+func TestParseWithRecovery_Parse(t *testing.T) {
+	t.Parallel()
+
+	// valid templates are parsed identically
+	for _, test := range parserTests {
+		program, errs := ParseWithRecovery(test.input, Options{})
+		if output := ast.Print(program); (len(errs) > 0) || (output != test.output) {
+			t.Errorf("Test '%s' failed\ninput:\n\t'%s'\nexpected\n\t%q\ngot\n\t%q\nerrors:\n\t%v", test.name, test.input, test.output, output, errs)
+		}
+	}
+
+	// first error is the one returned by Parse()
+	for _, test := range parserErrorTests {
+		_, err := Parse(test.input)
+
+		_, errs := ParseWithRecovery(test.input, Options{})
+		if (len(errs) == 0) || (errs[0].Error() != err.Error()) {
+			t.Errorf("Test '%s' failed\ninput:\n\t'%s'\nexpected first error\n\t%q\ngot\n\t%v", test.name, test.input, err, errs)
+		}
+	}
+}
+
 // package example
 func Example() {
 	source := "You know {{nothing}} John Snow"
@@ -198,3 +401,21 @@ func Example() {
 	// {{ PATH:nothing [] }}
 	// CONTENT[ ' John Snow' ]
 }
+
+func BenchmarkParse(b *testing.B) {
+	chunk, err := ioutil.ReadFile("../testdata/benchmark.hbs")
+	if err != nil {
+		b.Fatal(err)
+	}
+	input := strings.Repeat(string(chunk), 1000)
+
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -12,7 +12,12 @@ import (
 // The logic was shamelessly borrowed from:
 //   https://github.com/wycats/handlebars.js/blob/master/lib/handlebars/compiler/whitespace-control.js
 type whitespaceVisitor struct {
+	ast.BaseVisitor
+
 	isRootSeen bool
+
+	// standalone tags are not detected
+	ignoreStandalone bool
 }
 
 var (
@@ -32,15 +37,17 @@ var (
 )
 
 // newWhitespaceVisitor instanciates a new whitespaceVisitor
-func newWhitespaceVisitor() *whitespaceVisitor {
-	return &whitespaceVisitor{}
+func newWhitespaceVisitor(ignoreStandalone bool) *whitespaceVisitor {
+	return &whitespaceVisitor{
+		ignoreStandalone: ignoreStandalone,
+	}
 }
 
 // processWhitespaces performs whitespace control on given AST
 //
 // WARNING: It must be called only once on AST.
-func processWhitespaces(node ast.Node) {
-	node.Accept(newWhitespaceVisitor())
+func processWhitespaces(node ast.Node, ignoreStandalone bool) {
+	node.Accept(newWhitespaceVisitor(ignoreStandalone))
 }
 
 func omitRightFirst(body []ast.Node, multiple bool) {
@@ -183,9 +190,11 @@ func (v *whitespaceVisitor) VisitProgram(w io.Writer, program *ast.Program) erro
 		_isPrevWhitespace := isPrevWhitespaceProgram(body, i, isRoot)
 		_isNextWhitespace := isNextWhitespaceProgram(body, i, isRoot)
 
-		openStandalone := strip.OpenStandalone && _isPrevWhitespace
-		closeStandalone := strip.CloseStandalone && _isNextWhitespace
-		inlineStandalone := strip.InlineStandalone && _isPrevWhitespace && _isNextWhitespace
+		doStandalone := !v.ignoreStandalone
+
+		openStandalone := doStandalone && strip.OpenStandalone && _isPrevWhitespace
+		closeStandalone := doStandalone && strip.CloseStandalone && _isNextWhitespace
+		inlineStandalone := doStandalone && strip.InlineStandalone && _isPrevWhitespace && _isNextWhitespace
 
 		if strip.Close {
 			omitRight(body, i, true)
@@ -308,7 +317,7 @@ func (v *whitespaceVisitor) VisitBlock(block *ast.BlockStatement) interface{} {
 		}
 
 		// Find standalone else statements
-		if isPrevWhitespace(program.Body) && isNextWhitespace(firstInverse.Body) {
+		if !v.ignoreStandalone && isPrevWhitespace(program.Body) && isNextWhitespace(firstInverse.Body) {
 			omitLeftLast(program.Body, false)
 
 			omitRightFirst(firstInverse.Body, false)
@@ -349,14 +358,3 @@ func (v *whitespaceVisitor) VisitComment(node *ast.CommentStatement) interface{}
 
 	return _inlineStandalone(strip)
 }
-
-// NOOP
-func (v *whitespaceVisitor) VisitContent(node *ast.ContentStatement) interface{}    { return nil }
-func (v *whitespaceVisitor) VisitExpression(node *ast.Expression) interface{}       { return nil }
-func (v *whitespaceVisitor) VisitSubExpression(node *ast.SubExpression) interface{} { return nil }
-func (v *whitespaceVisitor) VisitPath(node *ast.PathExpression) interface{}         { return nil }
-func (v *whitespaceVisitor) VisitString(node *ast.StringLiteral) interface{}        { return nil }
-func (v *whitespaceVisitor) VisitBoolean(node *ast.BooleanLiteral) interface{}      { return nil }
-func (v *whitespaceVisitor) VisitNumber(node *ast.NumberLiteral) interface{}        { return nil }
-func (v *whitespaceVisitor) VisitHash(node *ast.Hash) interface{}                   { return nil }
-func (v *whitespaceVisitor) VisitHashPair(node *ast.HashPair) interface{}           { return nil }
@@ -0,0 +1,476 @@
+package mario
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/imantung/mario/ast"
+)
+
+// ProfileEntry holds execution statistics of a helper, a partial, or a block statement.
+type ProfileEntry struct {
+	Kind     string // "helper", "partial" or "block"
+	Name     string // helper name, partial name, or block expression
+	Template string // partial name where block is located, empty for the executed template
+	Line     int    // block line
+
+	Calls     int
+	Cum       time.Duration // time spent in entry and its children
+	Self      time.Duration // time spent in entry only
+	CumAlloc  uint64        // bytes allocated in entry and its children
+	SelfAlloc uint64        // bytes allocated in entry only
+}
+
+// String returns a string representation of receiver.
+func (e *ProfileEntry) String() string {
+	switch e.Kind {
+	case "block":
+		return fmt.Sprintf("block {{#%s}} %s:%d", e.Name, traceTemplateLabel(e.Template), e.Line)
+	case "helper":
+		return "helper " + e.Name
+	case "partial":
+		return "partial " + e.Name
+	}
+
+	return e.Kind + " " + e.Name
+}
+
+// profileKey identifies a profile entry
+type profileKey struct {
+	kind     string
+	name     string
+	template string
+	line     int
+}
+
+// profileSample is the self cost of a calls stack
+type profileSample struct {
+	stack []profileKey
+	calls int64
+	nanos int64
+	alloc int64
+}
+
+// Profiler gathers execution statistics of templates. It is opt-in: set it with Template.WithProfiler().
+//
+// A Profiler can be shared by several templates and executions. Allocated bytes are read from the runtime heap
+// allocations counter, so they include allocations of goroutines running concurrently, and are approximate: the runtime
+// counts small allocations by span, of a few kilobytes.
+type Profiler struct {
+	mutex    sync.Mutex
+	entries  map[profileKey]*ProfileEntry
+	samples  map[string]*profileSample
+	duration time.Duration
+}
+
+// NewProfiler instanciates a new profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		entries: make(map[profileKey]*ProfileEntry),
+		samples: make(map[string]*profileSample),
+	}
+}
+
+// Reset discards all gathered statistics.
+func (p *Profiler) Reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.entries = make(map[profileKey]*ProfileEntry)
+	p.samples = make(map[string]*profileSample)
+	p.duration = 0
+}
+
+// Entries returns all gathered statistics, sorted by decreasing cumulative time.
+func (p *Profiler) Entries() []*ProfileEntry {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var result []*ProfileEntry
+	for _, entry := range p.entries {
+		copied := *entry
+		result = append(result, &copied)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Cum != result[j].Cum {
+			return result[i].Cum > result[j].Cum
+		}
+		return result[i].String() < result[j].String()
+	})
+
+	return result
+}
+
+// WriteText writes a text report of gathered statistics, sorted by decreasing cumulative time.
+func (p *Profiler) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintln(tw, "calls\tcum\tself\tcum alloc\tself alloc\t\t")
+	for _, entry := range p.Entries() {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d B\t%d B\t\t%s\n", entry.Calls, entry.Cum, entry.Self, entry.CumAlloc, entry.SelfAlloc, entry)
+	}
+
+	return tw.Flush()
+}
+
+// record adds statistics of an exited frame
+func (p *Profiler) record(stack []*profileFrame, frame *profileFrame, cum time.Duration, cumAlloc uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	self := cum - frame.childTime
+	selfAlloc := subAlloc(cumAlloc, frame.childAlloc)
+
+	entry := p.entries[frame.key]
+	if entry == nil {
+		entry = &ProfileEntry{
+			Kind:     frame.key.kind,
+			Name:     frame.key.name,
+			Template: frame.key.template,
+			Line:     frame.key.line,
+		}
+		p.entries[frame.key] = entry
+	}
+
+	entry.Calls++
+	entry.Self += self
+	entry.SelfAlloc += selfAlloc
+
+	// recursive calls are already counted by outer call
+	recursive := false
+	for _, f := range stack {
+		if f.key == frame.key {
+			recursive = true
+			break
+		}
+	}
+
+	if !recursive {
+		entry.Cum += cum
+		entry.CumAlloc += cumAlloc
+	}
+
+	// sample
+	keys := make([]profileKey, 0, len(stack)+1)
+	var id strings.Builder
+	for _, f := range append(stack, frame) {
+		keys = append(keys, f.key)
+		fmt.Fprintf(&id, "%v;", f.key)
+	}
+
+	sample := p.samples[id.String()]
+	if sample == nil {
+		sample = &profileSample{stack: keys}
+		p.samples[id.String()] = sample
+	}
+
+	sample.calls++
+	sample.nanos += int64(self)
+	sample.alloc += int64(selfAlloc)
+}
+
+// addDuration adds the duration of a template execution
+func (p *Profiler) addDuration(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.duration += d
+}
+
+//
+// Recording
+//
+
+// profileFrame is a helper call, partial or block being profiled
+type profileFrame struct {
+	key        profileKey
+	start      time.Time
+	startAlloc uint64
+	childTime  time.Duration
+	childAlloc uint64
+}
+
+// profileStack records profiling frames of an execution
+type profileStack struct {
+	profiler *Profiler
+	frames   []*profileFrame
+	start    time.Time
+	allocs   *allocCounter
+
+	// partials names stack
+	names []string
+}
+
+func newProfileStack(profiler *Profiler) *profileStack {
+	return &profileStack{
+		profiler: profiler,
+		start:    time.Now(),
+		allocs:   newAllocCounter(),
+	}
+}
+
+// profileState is a snapshot of profile stack
+type profileState struct {
+	frames int
+	names  int
+}
+
+// state returns a snapshot of profile stack
+func (s *profileStack) state() profileState {
+	return profileState{frames: len(s.frames), names: len(s.names)}
+}
+
+// restore restores profile stack to given snapshot
+func (s *profileStack) restore(state profileState) {
+	s.frames = s.frames[:state.frames]
+	s.names = s.names[:state.names]
+}
+
+// enter starts profiling an entry
+func (s *profileStack) enter(kind string, name string, line int) {
+	key := profileKey{kind: kind, name: name}
+	if kind == "block" {
+		key.line = line
+		if len(s.names) > 0 {
+			key.template = s.names[len(s.names)-1]
+		}
+	}
+
+	if kind == "partial" {
+		s.names = append(s.names, name)
+	}
+
+	s.frames = append(s.frames, &profileFrame{
+		key:        key,
+		startAlloc: s.allocs.read(),
+		start:      time.Now(),
+	})
+}
+
+// exit stops profiling last entered entry
+func (s *profileStack) exit() {
+	end := time.Now()
+	endAlloc := s.allocs.read()
+
+	frame := s.frames[len(s.frames)-1]
+	s.frames = s.frames[:len(s.frames)-1]
+
+	if frame.key.kind == "partial" {
+		s.names = s.names[:len(s.names)-1]
+	}
+
+	cum := end.Sub(frame.start)
+	cumAlloc := subAlloc(endAlloc, frame.startAlloc)
+
+	if len(s.frames) > 0 {
+		parent := s.frames[len(s.frames)-1]
+		parent.childTime += cum
+		parent.childAlloc += cumAlloc
+	}
+
+	s.profiler.record(s.frames, frame, cum, cumAlloc)
+}
+
+// done is called when execution is over
+func (s *profileStack) done() {
+	s.profiler.addDuration(time.Since(s.start))
+}
+
+// subAlloc returns the difference of given allocated bytes, or 0 if negative: the runtime heap allocations counter can
+// slightly decrease when unused parts of spans are released
+func subAlloc(a uint64, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+// profileBlockName returns the name of given block statement in profile
+func profileBlockName(node *ast.BlockStatement) string {
+	if name := node.Expression.HelperName(); name != "" {
+		return name
+	}
+	return node.Expression.Canonical()
+}
+
+//
+// pprof export
+//
+
+// WritePprof writes gathered statistics in gzipped pprof protocol buffer format, that can be read by `go tool pprof`.
+//
+// Each helper, partial and block is exported as a function, and its caller chain as the call stack. Sample values
+// are: calls count, self time and self allocated bytes.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var b protoBuffer
+
+	strs := map[string]int64{"": 0}
+	strTable := []string{""}
+	str := func(s string) int64 {
+		if i, ok := strs[s]; ok {
+			return i
+		}
+		strs[s] = int64(len(strTable))
+		strTable = append(strTable, s)
+		return strs[s]
+	}
+
+	valueType := func(typ, unit string) []byte {
+		var vt protoBuffer
+		vt.int64(1, str(typ))
+		vt.int64(2, str(unit))
+		return vt.bytes()
+	}
+
+	// sample types
+	b.message(1, valueType("calls", "count"))
+	b.message(1, valueType("time", "nanoseconds"))
+	b.message(1, valueType("alloc_space", "bytes"))
+
+	// one function and one location per entry
+	var keys []profileKey
+	for key := range p.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return p.entries[keys[i]].String() < p.entries[keys[j]].String()
+	})
+
+	ids := make(map[profileKey]uint64)
+	for i, key := range keys {
+		ids[key] = uint64(i + 1)
+	}
+
+	// samples, with stack from leaf to root
+	var sampleIDs []string
+	for id := range p.samples {
+		sampleIDs = append(sampleIDs, id)
+	}
+	sort.Strings(sampleIDs)
+
+	for _, id := range sampleIDs {
+		sample := p.samples[id]
+
+		var locs []uint64
+		for i := len(sample.stack) - 1; i >= 0; i-- {
+			locs = append(locs, ids[sample.stack[i]])
+		}
+
+		var s protoBuffer
+		s.packedUint64(1, locs)
+		s.packedInt64(2, []int64{sample.calls, sample.nanos, sample.alloc})
+		b.message(2, s.bytes())
+	}
+
+	// locations
+	for _, key := range keys {
+		var line protoBuffer
+		line.uint64(1, ids[key])
+		line.int64(2, int64(key.line))
+
+		var loc protoBuffer
+		loc.uint64(1, ids[key])
+		loc.message(4, line.bytes())
+		b.message(4, loc.bytes())
+	}
+
+	// functions
+	for _, key := range keys {
+		entry := p.entries[key]
+
+		var fn protoBuffer
+		fn.uint64(1, ids[key])
+		fn.int64(2, str(entry.String()))
+		fn.int64(3, str(entry.String()))
+		fn.int64(4, str(traceTemplateLabel(key.template)))
+		b.message(5, fn.bytes())
+	}
+
+	// duration and period type
+	b.int64(10, int64(p.duration))
+	b.message(11, valueType("calls", "count"))
+	b.int64(12, 1)
+
+	// string table (must be last, as str() adds strings)
+	var result protoBuffer
+	result.buf.Write(b.bytes())
+	for _, s := range strTable {
+		result.string(6, s)
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(result.bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuffer is a minimal protocol buffer encoder
+type protoBuffer struct {
+	buf bytes.Buffer
+}
+
+func (b *protoBuffer) bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.buf.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	b.buf.WriteByte(byte(x))
+}
+
+func (b *protoBuffer) key(field int, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protoBuffer) message(field int, data []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(data)))
+	b.buf.Write(data)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.message(field, []byte(s))
+}
+
+func (b *protoBuffer) packedUint64(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.message(field, packed.bytes())
+}
+
+func (b *protoBuffer) packedInt64(field int, xs []int64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+	b.message(field, packed.bytes())
+}
@@ -0,0 +1,27 @@
+//go:build go1.16
+// +build go1.16
+
+package mario
+
+import "runtime/metrics"
+
+// allocCounter reads the runtime heap allocations counter, without stopping the world
+type allocCounter struct {
+	samples []metrics.Sample
+}
+
+func newAllocCounter() *allocCounter {
+	return &allocCounter{
+		samples: []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}},
+	}
+}
+
+// read returns cumulative bytes allocated on heap by program
+func (c *allocCounter) read() uint64 {
+	metrics.Read(c.samples)
+
+	if c.samples[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return c.samples[0].Value.Uint64()
+}
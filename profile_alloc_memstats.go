@@ -0,0 +1,21 @@
+//go:build !go1.16
+// +build !go1.16
+
+package mario
+
+import "runtime"
+
+// allocCounter reads the runtime heap allocations counter. Before Go 1.16, runtime.ReadMemStats() stops the world on
+// each read.
+type allocCounter struct{}
+
+func newAllocCounter() *allocCounter {
+	return &allocCounter{}
+}
+
+// read returns cumulative bytes allocated on heap by program
+func (c *allocCounter) read() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.TotalAlloc
+}
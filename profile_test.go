@@ -0,0 +1,111 @@
+package mario_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_WithProfiler(t *testing.T) {
+	profiler := mario.NewProfiler()
+
+	tpl := mario.Must(mario.New().Parse("{{#each items}}{{> item}}{{/each}}\n{{#if ok}}done{{/if}}"))
+	tpl.WithPartial("item", mario.Must(mario.New().Parse("{{upper this}}\n{{#if this}}!{{/if}}")))
+	tpl.WithHelperFunc("upper", strings.ToUpper)
+	tpl.WithProfiler(profiler)
+
+	for i := 0; i < 2; i++ {
+		var b strings.Builder
+		err := tpl.Execute(&b, map[string]interface{}{"items": []string{"a", "b", "c"}, "ok": true})
+		require.NoError(t, err)
+		require.Equal(t, "A\n!B\n!C\n!\ndone", b.String())
+	}
+
+	entries := make(map[string]*mario.ProfileEntry)
+	for _, entry := range profiler.Entries() {
+		entries[entry.String()] = entry
+	}
+
+	testcases := []struct {
+		name  string
+		calls int
+	}{
+		{"block {{#each}} (template):1", 2},
+		{"block {{#if}} (template):2", 2},
+		{"block {{#if}} item:2", 6},
+		{"helper each", 2},
+		{"helper if", 8},
+		{"helper upper", 6},
+		{"partial item", 6},
+	}
+
+	require.Len(t, entries, len(testcases))
+
+	for _, tt := range testcases {
+		entry := entries[tt.name]
+		require.NotNil(t, entry, tt.name)
+		require.Equal(t, tt.calls, entry.Calls, tt.name)
+		require.True(t, entry.Self <= entry.Cum, tt.name)
+		require.True(t, entry.SelfAlloc <= entry.CumAlloc, tt.name)
+	}
+
+	// each block includes each helper, that includes partials
+	require.True(t, entries["block {{#each}} (template):1"].Cum >= entries["helper each"].Cum)
+	require.True(t, entries["helper each"].Cum >= entries["partial item"].Cum)
+
+	// text report
+	var b strings.Builder
+	require.NoError(t, profiler.WriteText(&b))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, len(testcases)+1)
+	require.Contains(t, lines[0], "calls")
+	require.True(t, strings.HasSuffix(lines[1], "block {{#each}} (template):1"))
+
+	// pprof
+	var buf bytes.Buffer
+	require.NoError(t, profiler.WritePprof(&buf))
+
+	zr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(zr)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "partial item")
+	require.Contains(t, string(data), "alloc_space")
+
+	profiler.Reset()
+	require.Empty(t, profiler.Entries())
+}
+
+func TestProfiler_Recursive(t *testing.T) {
+	profiler := mario.NewProfiler()
+
+	tpl := mario.Must(mario.New().Parse("{{> node}}"))
+	tpl.WithPartial("node", mario.Must(mario.New().Parse("{{name}}{{#each children}}{{> node}}{{/each}}")))
+	tpl.WithProfiler(profiler)
+
+	var b strings.Builder
+	err := tpl.Execute(&b, map[string]interface{}{
+		"name":     "a",
+		"children": []map[string]interface{}{{"name": "b", "children": []map[string]interface{}{{"name": "c", "children": []interface{}{}}}}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "abc", b.String())
+
+	var node *mario.ProfileEntry
+	for _, entry := range profiler.Entries() {
+		if entry.String() == "partial node" {
+			node = entry
+		}
+	}
+
+	require.NotNil(t, node)
+	require.Equal(t, 3, node.Calls)
+
+	// cumulative time of recursive calls is counted once
+	require.True(t, node.Cum <= profiler.Entries()[0].Cum)
+}
@@ -0,0 +1,164 @@
+package mario
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/imantung/mario/ast"
+)
+
+// stringParams mode
+//
+// Like handlebars.js `stringParams` compile option, a helper param or hash value that is a path which doesn't resolve
+// in the context stack is passed to the helper as its name, and helpers can get the type and the lookup context of
+// each param and hash value with Options.ParamType(), Options.HashType(), Options.ParamContext() and
+// Options.HashContext().
+//
+// References:
+//   - https://github.com/wycats/handlebars.js/blob/master/lib/handlebars/compiler/compiler.js (pushParam)
+//   - https://github.com/wycats/handlebars.js/blob/master/lib/handlebars/compiler/javascript-compiler.js (setupParams)
+
+// Param types, in stringParams mode
+const (
+	// ParamTypeID is the type of a path param
+	ParamTypeID = "ID"
+	// ParamTypeString is the type of a string literal param
+	ParamTypeString = "STRING"
+	// ParamTypeNumber is the type of a number literal param
+	ParamTypeNumber = "NUMBER"
+	// ParamTypeBoolean is the type of a boolean literal param
+	ParamTypeBoolean = "BOOLEAN"
+	// ParamTypeSexpr is the type of a subexpression param
+	ParamTypeSexpr = "SexprNode"
+	// ParamTypeUndefined is the type of an undefined literal param
+	ParamTypeUndefined = "UNDEFINED"
+	// ParamTypeNull is the type of a null literal param
+	ParamTypeNull = "NULL"
+)
+
+// WithStringParams enables the stringParams mode, where a helper param or hash value that is a path which doesn't
+// resolve in the context stack is passed to the helper as its name, and helpers can get params types and contexts.
+//
+// For example, with `{{sortable-header created_at}}`, the `sortable-header` helper gets "created_at" if there is no
+// such field in context, and options.ParamType(0) returns ParamTypeID.
+func (tpl *Template) WithStringParams() *Template {
+	tpl.stringParams = true
+	return tpl
+}
+
+// ParamType returns the type of parameter at given position, in stringParams mode: ParamTypeID, ParamTypeString,
+// ParamTypeNumber, ParamTypeBoolean, ParamTypeSexpr, ParamTypeUndefined or ParamTypeNull. It returns an empty string
+// if there is no such parameter, or if stringParams mode is not enabled.
+func (options *Options) ParamType(pos int) string {
+	if len(options.paramTypes) > pos {
+		return options.paramTypes[pos]
+	}
+	return ""
+}
+
+// HashType returns the type of hash value with given name, in stringParams mode. It returns an empty string if there is
+// no such value, or if stringParams mode is not enabled.
+func (options *Options) HashType(name string) string {
+	return options.hashTypes[name]
+}
+
+// ParamContext returns the context where parameter at given position was looked up, in stringParams mode. It returns
+// nil if there is no such parameter, or if stringParams mode is not enabled.
+func (options *Options) ParamContext(pos int) interface{} {
+	if len(options.paramContexts) > pos {
+		return options.paramContexts[pos]
+	}
+	return nil
+}
+
+// HashContext returns the context where hash value with given name was looked up, in stringParams mode. It returns
+// nil if there is no such value, or if stringParams mode is not enabled.
+func (options *Options) HashContext(name string) interface{} {
+	return options.hashContexts[name]
+}
+
+// paramType returns the stringParams type of given param node
+func paramType(node ast.Node) string {
+	switch node.(type) {
+	case *ast.PathExpression:
+		return ParamTypeID
+	case *ast.StringLiteral:
+		return ParamTypeString
+	case *ast.NumberLiteral:
+		return ParamTypeNumber
+	case *ast.BooleanLiteral:
+		return ParamTypeBoolean
+	case *ast.SubExpression:
+		return ParamTypeSexpr
+	case *ast.UndefinedLiteral:
+		return ParamTypeUndefined
+	case *ast.NullLiteral:
+		return ParamTypeNull
+	}
+	return ""
+}
+
+// stringParamPrefixRegexp matches the `./` and `../` prefixes that are removed from param names
+var stringParamPrefixRegexp = regexp.MustCompile(`^(?:\.?\./)*`)
+
+// stringParamName returns the name passed to helper for given unresolved path
+func stringParamName(node *ast.PathExpression) string {
+	return strings.Replace(stringParamPrefixRegexp.ReplaceAllString(node.Original, ""), "/", ".", -1)
+}
+
+// stringParam evaluates given param node in stringParams mode, and returns its value, type and lookup context
+func (v *evaluator) stringParam(node ast.Node) (interface{}, string, interface{}) {
+	ctx := v.curCtx()
+
+	value := node.Accept(v)
+
+	if path, ok := node.(*ast.PathExpression); ok {
+		if path.Depth > 0 {
+			ctx = v.ancestorCtx(path.Depth)
+		}
+
+		if value == nil {
+			value = stringParamName(path)
+		}
+	}
+
+	var ctxValue interface{}
+	if ctx.IsValid() {
+		ctxValue = ctx.Interface()
+	}
+
+	return value, paramType(node), ctxValue
+}
+
+// stringParamsOptions computes helper options argument from an expression, in stringParams mode
+func (v *evaluator) stringParamsOptions(node *ast.Expression) *Options {
+	result := newOptions(v, nil, make(map[string]interface{}))
+	result.hashTypes = make(map[string]string)
+	result.hashContexts = make(map[string]interface{})
+
+	for _, paramNode := range node.Params {
+		value, typ, ctx := v.stringParam(paramNode)
+
+		result.params = append(result.params, value)
+		result.paramTypes = append(result.paramTypes, typ)
+		result.paramContexts = append(result.paramContexts, ctx)
+	}
+
+	if node.Hash != nil {
+		v.at(node.Hash)
+
+		for _, pair := range node.Hash.Pairs {
+			v.at(pair)
+
+			value, typ, ctx := v.stringParam(pair.Val)
+			if value != nil {
+				result.hash[pair.Key] = value
+			}
+
+			result.hashTypes[pair.Key] = typ
+			result.hashContexts[pair.Key] = ctx
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,92 @@
+package mario_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+// describeHelper returns a helper with given number of params that renders its params and hash values with their types
+func describeHelper(nbParams int) interface{} {
+	in := make([]reflect.Type, nbParams, nbParams+1)
+	for i := range in {
+		in[i] = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+	in = append(in, reflect.TypeOf((*mario.Options)(nil)))
+
+	fnType := reflect.FuncOf(in, []reflect.Type{reflect.TypeOf("")}, false)
+
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.ValueOf(describe(args[nbParams].Interface().(*mario.Options)))}
+	}).Interface()
+}
+
+// describe renders helper params and hash values with their types
+func describe(options *mario.Options) string {
+	var result []string
+	for i, param := range options.Params() {
+		result = append(result, mario.Str(param)+":"+options.ParamType(i))
+	}
+	if _, ok := options.Hash()["sort"]; ok {
+		result = append(result, "sort="+options.HashStr("sort")+":"+options.HashType("sort"))
+	}
+	return strings.Join(result, " ")
+}
+
+func TestStringParams(t *testing.T) {
+	ctx := map[string]interface{}{
+		"title": "Users",
+		"user":  map[string]string{"name": "Mario"},
+	}
+
+	for _, test := range []struct {
+		source   string
+		nbParams int
+		expected string
+	}{
+		{`{{describe created_at}}`, 1, "created_at:ID"},
+		{`{{describe title}}`, 1, "Users:ID"},
+		{`{{describe "str" 12 true}}`, 3, "str:STRING 12:NUMBER true:BOOLEAN"},
+		{`{{describe (describe foo)}}`, 1, "foo:ID:SexprNode"},
+		{`{{describe null undefined}}`, 2, ":NULL :UNDEFINED"},
+		{`{{describe sort=created_at}}`, 0, "sort=created_at:ID"},
+		{`{{describe sort=title}}`, 0, "sort=Users:ID"},
+		{`{{#with user}}{{describe ../missing this/age ./name}}{{/with}}`, 3, "missing:ID this.age:ID Mario:ID"},
+	} {
+		tpl := mario.Must(mario.New().WithStringParams().Parse(test.source)).WithHelperFunc("describe", describeHelper(test.nbParams))
+
+		var b strings.Builder
+		require.NoError(t, tpl.Execute(&b, ctx), test.source)
+		require.Equal(t, test.expected, b.String(), test.source)
+	}
+}
+
+func TestStringParams_Contexts(t *testing.T) {
+	user := map[string]string{"name": "Mario"}
+	ctx := map[string]interface{}{"user": user}
+
+	var contexts []interface{}
+	var hashContext interface{}
+
+	tpl := mario.Must(mario.New().WithStringParams().Parse(`{{#with user}}{{ctx name ../user key=../foo}}{{/with}}`))
+	tpl.WithHelperFunc("ctx", func(name, user interface{}, options *mario.Options) string {
+		contexts = []interface{}{options.ParamContext(0), options.ParamContext(1)}
+		hashContext = options.HashContext("key")
+		return ""
+	})
+
+	require.NoError(t, tpl.Execute(&strings.Builder{}, ctx))
+	require.Equal(t, []interface{}{user, ctx}, contexts)
+	require.Equal(t, ctx, hashContext)
+}
+
+func TestStringParams_Disabled(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse(`{{describe created_at sort=foo}}`)).WithHelperFunc("describe", describeHelper(1))
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, nil))
+	require.Equal(t, ":", b.String())
+}
@@ -11,10 +11,34 @@ import (
 
 // Template represents a handlebars template.
 type Template struct {
-	program  *ast.Program
-	helpers  map[string]*Helper
-	partials map[string]*Template
-	mutex    sync.RWMutex // protects helpers and partials
+	source       string
+	program      *ast.Program
+	helpers      map[string]*Helper
+	partials     map[string]*Template
+	debug        DebugFunc
+	profiler     *Profiler
+	logger       Logger
+	logLevel     LogLevel
+	mustache     bool
+	trackIds     bool
+	stringParams bool
+	compat       bool
+
+	// partials indentation and standalone tags detection
+	preventIndent    bool
+	ignoreStandalone bool
+
+	// known helpers, and expressions resolved as helper calls or not when parsing
+	knownHelpers     map[string]bool
+	knownHelpersOnly bool
+	helperCalls      helperCalls
+	delims           [2]string
+
+	// programs of indented source and their helper calls, by indentation, for standalone partials in Mustache mode
+	indented sync.Map
+
+	interceptors interceptors
+	mutex        sync.RWMutex // protects helpers and partials
 }
 
 // New mustache handlebars template
@@ -22,6 +46,7 @@ func New() *Template {
 	return &Template{
 		helpers:  make(map[string]*Helper),
 		partials: make(map[string]*Template),
+		logLevel: LogInfo,
 	}
 }
 
@@ -39,28 +64,109 @@ func Must(t *Template, err error) *Template {
 func (tpl *Template) Parse(source string) (*Template, error) {
 	var program *ast.Program
 	var err error
-	if program, err = parser.Parse(source); err != nil {
+	if program, err = parser.ParseWithOptions(source, tpl.parseOptions()); err != nil {
 		return nil, err
 	}
-	tpl.program = program
+	if err = tpl.setProgram(program); err != nil {
+		return nil, err
+	}
+	tpl.source = source
+	return tpl, nil
+}
+
+// ParseProgram sets an already parsed program, for example an AST unmarshalled from JSON with ast.UnmarshalNode,
+// instead of parsing a source. Like Parse(), it fails if program calls an unknown helper in knownHelpersOnly mode.
+// Source() returns an empty string for that template.
+func (tpl *Template) ParseProgram(program *ast.Program) (*Template, error) {
+	if err := tpl.setProgram(program); err != nil {
+		return nil, err
+	}
+	tpl.source = ""
 	return tpl, nil
 }
 
+// WithProgram is like ParseProgram(), but panics on error.
+func (tpl *Template) WithProgram(program *ast.Program) *Template {
+	return Must(tpl.ParseProgram(program))
+}
+
+// setProgram sets template program, and resolves its helper calls
+func (tpl *Template) setProgram(program *ast.Program) error {
+	helperCalls, err := tpl.resolveHelperCalls(program)
+	if err != nil {
+		return err
+	}
+	tpl.program = program
+	tpl.helperCalls = helperCalls
+	return nil
+}
+
 // Execute evaluates template with given context.
 func (tpl *Template) Execute(w io.Writer, ctx interface{}) error {
 	return tpl.ExecuteWith(w, ctx, nil)
 }
 
 // ExecuteWith evaluates template with given context and private data frame.
-func (tpl *Template) ExecuteWith(w io.Writer, ctx interface{}, frame *DataFrame) (err error) {
+func (tpl *Template) ExecuteWith(w io.Writer, ctx interface{}, frame *DataFrame) error {
+	return tpl.execute(w, ctx, frame, nil)
+}
+
+// execute evaluates template with given context, private data frame and optional tracer
+func (tpl *Template) execute(w io.Writer, ctx interface{}, frame *DataFrame, t *tracer) (err error) {
 	defer errRecover(&err)
 	if frame == nil {
 		frame = NewDataFrame()
 	}
 	eval := createEvaluator(tpl, ctx, frame)
+	eval.tracer = t
+	if eval.profile != nil {
+		defer eval.profile.done()
+	}
+
+	if len(tpl.interceptors.render) > 0 {
+		return tpl.interceptRender(w, ctx, frame, func() error {
+			return eval.VisitProgram(w, tpl.Program())
+		})
+	}
+
 	return eval.VisitProgram(w, tpl.Program())
 }
 
+// WithDelims sets open and close delimiters, instead of the default {{ and }}. It must be called before Parse().
+//
+// All constructs use the new delimiters, for example with `[[` and `]]`: `[[#if foo]]`, `[[{unescaped}]]`,
+// `[[~ stripped ~]]`, `[[! comment ]]` and raw blocks `[[{{raw}}]] content [[{{/raw}}]]`. Delimiters can't be empty,
+// nor contain whitespaces or '=': Parse() fails on invalid delimiters.
+func (tpl *Template) WithDelims(open string, close string) *Template {
+	tpl.delims = [2]string{open, close}
+	return tpl
+}
+
+// WithPreventIndent disables the indentation of standalone partials: like handlebars.js `preventIndent` option, the
+// indentation of a standalone partial tag is output before the partial, but the partial lines are not indented. That
+// is useful for partials that render preformatted output. The mode of the executed template applies to its partials.
+func (tpl *Template) WithPreventIndent() *Template {
+	tpl.preventIndent = true
+	return tpl
+}
+
+// WithIgnoreStandalone disables standalone tags detection, like handlebars.js `ignoreStandalone` option: whitespaces
+// and newline around a block, partial or comment tag that is alone on its line are kept. It must be called before
+// Parse().
+func (tpl *Template) WithIgnoreStandalone() *Template {
+	tpl.ignoreStandalone = true
+	return tpl
+}
+
+// parseOptions returns options to parse template source
+func (tpl *Template) parseOptions() parser.Options {
+	return parser.Options{
+		Mustache:         tpl.mustache,
+		Delims:           tpl.delims,
+		IgnoreStandalone: tpl.ignoreStandalone,
+	}
+}
+
 // WithHelperFunc to create and set helper
 func (tpl *Template) WithHelperFunc(name string, fn interface{}) *Template {
 	return tpl.WithHelper(name, CreateHelper(fn))
@@ -69,6 +175,32 @@ func (tpl *Template) WithHelperFunc(name string, fn interface{}) *Template {
 // WithHelper to set helper
 func (tpl *Template) WithHelper(name string, helper *Helper) *Template {
 	tpl.helpers[name] = helper
+
+	// update known helper calls resolved when parsing
+	tpl.helperCalls.register(name, helper)
+	tpl.indented.Range(func(_, value interface{}) bool {
+		value.(*indentedSource).helperCalls.register(name, helper)
+		return true
+	})
+
+	return tpl
+}
+
+// WithDebug sets a function that receives all evaluation events: visited nodes, contexts and data frames changes,
+// helper calls and path lookups. See NewDebugLogger.
+func (tpl *Template) WithDebug(fn DebugFunc) *Template {
+	tpl.debug = fn
+	return tpl
+}
+
+// WithProfiler sets a profiler that gathers calls count, time and allocated bytes of each helper, partial and block
+// statement, on each execution.
+//
+// Profiling reads the clock and the runtime heap allocations counter twice per helper call, partial and block, which
+// costs about a microsecond per event, and records entries under a lock shared by all executions using that
+// profiler. Since Go 1.16 the counter is read with runtime/metrics, without stopping the world.
+func (tpl *Template) WithProfiler(profiler *Profiler) *Template {
+	tpl.profiler = profiler
 	return tpl
 }
 
@@ -83,6 +215,11 @@ func (tpl *Template) Program() *ast.Program {
 	return tpl.program
 }
 
+// Source returns parsed source
+func (tpl *Template) Source() string {
+	return tpl.source
+}
+
 func errRecover(errp *error) {
 	e := recover()
 	if e != nil {
@@ -0,0 +1,212 @@
+package mario
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TemplateSet is a collection of named templates, each template being available as a partial to all others.
+type TemplateSet struct {
+	templates map[string]*Template
+}
+
+// NewTemplateSet instanciates a new empty template set.
+func NewTemplateSet() *TemplateSet {
+	return &TemplateSet{
+		templates: make(map[string]*Template),
+	}
+}
+
+// PartialCycleError is returned when a template added to a set is part of a static partial cycle.
+type PartialCycleError struct {
+	Path []string // partial names chain, starting and ending with the added template
+}
+
+// Error implements the error interface.
+func (err *PartialCycleError) Error() string {
+	return "Partial cycle detected: " + strings.Join(err.Path, " > ")
+}
+
+// Parse parses source and adds resulting template to the set with given name.
+//
+// Like Add(), it returns the template with a *PartialCycleError if that template is part of a partial cycle.
+func (set *TemplateSet) Parse(name string, source string) (*Template, error) {
+	tpl, err := New().Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	return tpl, set.Add(name, tpl)
+}
+
+// Add adds an already parsed template to the set with given name.
+//
+// It returns a *PartialCycleError, with the partial names chain, if that template is part of a static partial cycle.
+// The template is added anyway: recursive partials, like a tree node including itself for its children, render as
+// long as the recursion ends, and evaluation fails if it goes deeper than MaxPartialDepth.
+func (set *TemplateSet) Add(name string, tpl *Template) error {
+	set.templates[name] = tpl
+
+	for other, t := range set.templates {
+		t.WithPartial(name, tpl)
+		tpl.WithPartial(other, t)
+	}
+
+	if path := partialPath(tpl, tpl, []string{name}, make(map[*Template]bool)); path != nil {
+		return &PartialCycleError{Path: path}
+	}
+
+	return nil
+}
+
+// Remove removes template with given name from the set, and unregisters it as a partial of other templates.
+func (set *TemplateSet) Remove(name string) {
+	delete(set.templates, name)
+	set.unlink(name)
+}
+
+// Lookup returns template with given name, or nil if not found.
+func (set *TemplateSet) Lookup(name string) *Template {
+	return set.templates[name]
+}
+
+// Names returns sorted names of all templates in the set.
+func (set *TemplateSet) Names() []string {
+	var result []string
+	for name := range set.templates {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Dependencies returns sorted names of all static partials transitively included by template with given name.
+func (set *TemplateSet) Dependencies(name string) ([]string, error) {
+	tpl := set.templates[name]
+	if tpl == nil {
+		return nil, fmt.Errorf("Template not found: %s", name)
+	}
+
+	return tpl.PartialDependencies()
+}
+
+// link registers every template of the set as a partial of all others, when templates are added all at once
+func (set *TemplateSet) link() {
+	for _, tpl := range set.templates {
+		for name, partial := range set.templates {
+			tpl.WithPartial(name, partial)
+		}
+	}
+}
+
+// unlink unregisters partial with given name from all templates of the set
+func (set *TemplateSet) unlink(name string) {
+	for _, tpl := range set.templates {
+		delete(tpl.partials, name)
+	}
+}
+
+// Cycle returns the partial names chain of a static partial cycle going through template with given name, or nil if
+// there is none.
+//
+// A cycle is not an error: recursive partials, like a tree node including itself for its children, render as long as
+// the recursion ends, and evaluation fails if it goes deeper than MaxPartialDepth.
+func (set *TemplateSet) Cycle(name string) []string {
+	tpl := set.templates[name]
+	if tpl == nil {
+		return nil
+	}
+
+	return findPartialCycle(tpl, []string{name}, make(map[*Template]bool), make(map[*Template]bool))
+}
+
+// PartialDependencies returns sorted names of all static partials transitively included by template, including
+// recursive ones.
+//
+// It returns an error if a partial is not registered.
+func (tpl *Template) PartialDependencies() ([]string, error) {
+	deps := make(map[string]bool)
+	if err := collectPartials(tpl, deps); err != nil {
+		return nil, err
+	}
+
+	return sortedKeys(deps), nil
+}
+
+// collectPartials adds to deps the names of all static partials transitively included by template
+func collectPartials(tpl *Template, deps map[string]bool) error {
+	for _, name := range tpl.Analyze().Partials {
+		if deps[name] {
+			continue
+		}
+		deps[name] = true
+
+		partial := tpl.partials[name]
+		if partial == nil {
+			return fmt.Errorf("Partial not found: %s", name)
+		}
+
+		if err := collectPartials(partial, deps); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partialPath returns the partial names chain from template to target, appended to given chain, or nil if target is
+// not reachable
+func partialPath(tpl *Template, target *Template, chain []string, visited map[*Template]bool) []string {
+	for _, name := range tpl.Analyze().Partials {
+		partial := tpl.partials[name]
+		if partial == nil {
+			continue
+		}
+
+		path := append(append([]string(nil), chain...), name)
+		if partial == target {
+			return path
+		}
+
+		if visited[partial] {
+			continue
+		}
+		visited[partial] = true
+
+		if result := partialPath(partial, target, path, visited); result != nil {
+			return result
+		}
+	}
+
+	return nil
+}
+
+// findPartialCycle returns the partial names chain of a cycle reachable from template, or nil if there is none
+func findPartialCycle(tpl *Template, chain []string, visiting map[*Template]bool, done map[*Template]bool) []string {
+	if visiting[tpl] {
+		return chain
+	}
+
+	if done[tpl] {
+		return nil
+	}
+
+	visiting[tpl] = true
+	defer delete(visiting, tpl)
+
+	for _, name := range tpl.Analyze().Partials {
+		partial := tpl.partials[name]
+		if partial == nil {
+			continue
+		}
+
+		if cycle := findPartialCycle(partial, append(chain, name), visiting, done); cycle != nil {
+			return cycle
+		}
+	}
+
+	done[tpl] = true
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package mario_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateSet(t *testing.T) {
+	set := mario.NewTemplateSet()
+
+	_, err := set.Parse("page", `{{> header}}<p>{{body}}</p>{{> footer}}`)
+	require.NoError(t, err)
+	_, err = set.Parse("header", `<h1>{{> title}}</h1>`)
+	require.NoError(t, err)
+	_, err = set.Parse("title", `{{title}}`)
+	require.NoError(t, err)
+	_, err = set.Parse("footer", `<footer/>`)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"footer", "header", "page", "title"}, set.Names())
+
+	deps, err := set.Dependencies("page")
+	require.NoError(t, err)
+	require.Equal(t, []string{"footer", "header", "title"}, deps)
+
+	var b strings.Builder
+	require.NoError(t, set.Lookup("page").Execute(&b, map[string]string{"title": "foo", "body": "bar"}))
+	require.Equal(t, `<h1>foo</h1><p>bar</p><footer/>`, b.String())
+
+	set.Remove("footer")
+	require.Equal(t, []string{"header", "page", "title"}, set.Names())
+
+	_, err = set.Dependencies("page")
+	require.EqualError(t, err, "Partial not found: footer")
+}
+
+func TestTemplateSet_Cycle(t *testing.T) {
+	set := mario.NewTemplateSet()
+
+	_, err := set.Parse("a", `{{> b}}`)
+	require.NoError(t, err)
+	_, err = set.Parse("b", `{{> c}}`)
+	require.NoError(t, err)
+	require.Nil(t, set.Cycle("a"))
+
+	tpl, err := set.Parse("c", `{{> a}}`)
+	require.EqualError(t, err, "Partial cycle detected: c > a > b > c")
+	require.NotNil(t, tpl)
+	require.Equal(t, tpl, set.Lookup("c"))
+
+	var cycleErr *mario.PartialCycleError
+	require.True(t, errors.As(err, &cycleErr))
+	require.Equal(t, []string{"c", "a", "b", "c"}, cycleErr.Path)
+	require.Equal(t, []string{"c", "a", "b", "c"}, set.Cycle("c"))
+
+	deps, err := set.Dependencies("a")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, deps)
+
+	// never ending recursion
+	var b strings.Builder
+	err = set.Lookup("a").Execute(&b, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Partial recursion too deep: more than 1000 nested partials")
+}
+
+func TestTemplateSet_RecursivePartial(t *testing.T) {
+	set := mario.NewTemplateSet()
+
+	_, err := set.Parse("node", "{{name}}{{#each children}}({{> node}}){{/each}}")
+	require.EqualError(t, err, "Partial cycle detected: node > node")
+	require.Equal(t, []string{"node", "node"}, set.Cycle("node"))
+
+	deps, err := set.Dependencies("node")
+	require.NoError(t, err)
+	require.Equal(t, []string{"node"}, deps)
+
+	tree := map[string]interface{}{
+		"name": "root",
+		"children": []map[string]interface{}{
+			{"name": "a", "children": []map[string]interface{}{{"name": "a1", "children": nil}}},
+			{"name": "b", "children": nil},
+		},
+	}
+
+	var b strings.Builder
+	require.NoError(t, set.Lookup("node").Execute(&b, tree))
+	require.Equal(t, "root(a(a1))(b)", b.String())
+}
+
+func BenchmarkTemplateSet_Add(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		set := mario.NewTemplateSet()
+
+		for j := 0; j < 500; j++ {
+			if _, err := set.Parse(fmt.Sprintf("p%d", j), fmt.Sprintf("{{> p%d}}", j+1)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
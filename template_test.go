@@ -1,6 +1,7 @@
 package mario_test
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -77,3 +78,76 @@ func TestTemplate_PrintAST(t *testing.T) {
 		ast.Print(tpl.Program()),
 	)
 }
+
+func TestTemplate_WithProgram(t *testing.T) {
+	parsed := mario.Must(mario.New().Parse(`{{#each items}}{{upper this}}{{else}}none{{/each}} {{> footer}}`))
+
+	data, err := json.Marshal(parsed.Program())
+	require.NoError(t, err)
+
+	node, err := ast.UnmarshalNode(data)
+	require.NoError(t, err)
+
+	tpl := mario.New().WithProgram(node.(*ast.Program)).
+		WithHelperFunc("upper", strings.ToUpper).
+		WithPartial("footer", mario.Must(mario.New().Parse("!")))
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, map[string]interface{}{"items": []string{"a", "b"}}))
+	require.Equal(t, "AB !", b.String())
+	require.Equal(t, "", tpl.Source())
+}
+
+func TestTemplate_WithDelims(t *testing.T) {
+	t.Parallel()
+
+	ctx := map[string]interface{}{
+		"foo":  "<b>",
+		"list": []string{"a", "b"},
+		"ok":   true,
+	}
+
+	tests := []struct {
+		open     string
+		close    string
+		source   string
+		expected string
+	}{
+		{"[[", "]]", "{{foo}} [[foo]] [[{foo}]] [[&foo]]", "{{foo}} &lt;b&gt; <b> <b>"},
+		{"[[", "]]", "[[#each list]][[@index]]:[[.]] [[/each]]", "0:a 1:b "},
+		{"[[", "]]", "[[#if ok]]yes[[else]]no[[/if]] [[^ok]]x[[^]]y[[/ok]]", "yes y"},
+		{"[[", "]]", "a [[! comment ]] b [[!-- }} --]] c", "a  b  c"},
+		{"[[", "]]", "a   [[~foo~]]   b", "a&lt;b&gt;b"},
+		{"[[", "]]", "<ul>\n  [[#each list]]\n  <li>[[.]]</li>\n  [[/each]]\n</ul>", "<ul>\n  <li>a</li>\n  <li>b</li>\n</ul>"},
+		{"[[", "]]", "[[{{raw}}]] [[foo]] {{foo}} [[{{/raw}}]]", " [[foo]] {{foo}} "},
+		{"[[", "]]", `\[[foo]] \\[[foo]]`, `[[foo]] \&lt;b&gt;`},
+		{"[[", "]]", "[[> part]]-[[#with foo as |f|]][[f]][[/with]]", "part-&lt;b&gt;"},
+		{"<%", "%>", "<%#if ok%><%foo%><%/if%> {{foo}}", "&lt;b&gt; {{foo}}"},
+		{"<<<", ">>>", "<<<#each list>>><<<.>>><<</each>>> <<<~! comment ~>>> <<<{foo}>>>", "ab<b>"},
+		{"|", "|", "|#each list||.||/each| |! comment |", "ab "},
+	}
+
+	for _, test := range tests {
+		tpl, err := mario.New().WithDelims(test.open, test.close).Parse(test.source)
+		require.NoError(t, err, test.source)
+
+		tpl.WithPartial("part", mario.Must(mario.New().Parse("part")))
+		tpl.WithHelperFunc("raw", func(options *mario.Options) string {
+			return options.Fn()
+		})
+
+		var b strings.Builder
+		require.NoError(t, tpl.Execute(&b, ctx), test.source)
+		require.Equal(t, test.expected, b.String(), test.source)
+	}
+}
+
+func TestTemplate_WithDelims_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, delims := range [][2]string{{"", "]]"}, {"[[", ""}, {"[ [", "]]"}, {"[=", "]]"}} {
+		_, err := mario.New().WithDelims(delims[0], delims[1]).Parse("[[foo]]")
+		require.Error(t, err, delims)
+		require.Contains(t, err.Error(), "Invalid delimiters", delims)
+	}
+}
@@ -0,0 +1,385 @@
+package mario
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/imantung/mario/ast"
+)
+
+// TraceSpan represents a chunk of output, and the statement that produced it.
+type TraceSpan struct {
+	Start    int          `json:"start"`    // start byte position in output
+	End      int          `json:"end"`      // end byte position in output (exclusive)
+	Node     ast.Node     `json:"-"`        // statement node
+	Type     string       `json:"type"`     // statement type: content, mustache, block or partial
+	Template string       `json:"template"` // partial name, empty for the executed template
+	Loc      ast.Loc      `json:"loc"`      // statement location in template source
+	Helper   string       `json:"helper,omitempty"`
+	Children []*TraceSpan `json:"children,omitempty"`
+}
+
+// Trace maps output byte ranges back to template statements.
+type Trace struct {
+	Output  string            `json:"output"`
+	Sources map[string]string `json:"sources"` // templates sources, by partial name
+	Spans   []*TraceSpan      `json:"spans"`
+}
+
+// ExecuteTrace evaluates template with given context and private data frame, and traces which statement produced
+// each chunk of output.
+//
+// Chunks transformed by a helper (eg. an helper that uppercases its block) can't be mapped back, so they are
+// attributed to the statement that called that helper.
+//
+// Like ExecuteWith(), execution goes through render interceptors and is profiled.
+func (tpl *Template) ExecuteTrace(w io.Writer, ctx interface{}, frame *DataFrame) (*Trace, error) {
+	t := newTracer()
+
+	var b strings.Builder
+	if err := tpl.execute(io.MultiWriter(w, &b), ctx, frame, t); err != nil {
+		return nil, err
+	}
+
+	result := &Trace{
+		Output:  b.String(),
+		Sources: map[string]string{"": tpl.source},
+	}
+
+	if t.root != nil {
+		result.Spans = t.root.resolve(0)
+	}
+
+	for name, source := range t.sources {
+		result.Sources[name] = source
+	}
+
+	return result, nil
+}
+
+// SpanAt returns the innermost span containing given output byte position, or nil if not found.
+func (t *Trace) SpanAt(pos int) *TraceSpan {
+	var result *TraceSpan
+
+	spans := t.Spans
+	for spans != nil {
+		var found *TraceSpan
+
+		for _, span := range spans {
+			if (span.Start <= pos) && (pos < span.End) {
+				found = span
+				break
+			}
+		}
+
+		if found == nil {
+			break
+		}
+
+		result = found
+		spans = found.Children
+	}
+
+	return result
+}
+
+// JSON returns JSON representation of trace.
+func (t *Trace) JSON() ([]byte, error) {
+	return json.Marshal(t)
+}
+
+// WriteHTML writes an HTML page that displays output, where clicking a chunk highlights the statement that produced it.
+func (t *Trace) WriteHTML(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString(traceHTMLHeader)
+
+	// output
+	b.WriteString(`<div class="pane"><h2>Output</h2><pre>`)
+	t.writeSpansHTML(&b, t.Spans, 0, len(t.Output))
+	b.WriteString("</pre></div>\n")
+
+	// sources
+	b.WriteString(`<div class="pane"><h2>Sources</h2>`)
+	var names []string
+	for name := range t.Sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(&b, `<h3>%s</h3><pre>`, html.EscapeString(traceTemplateLabel(name)))
+		for i, line := range strings.Split(t.Sources[name], "\n") {
+			fmt.Fprintf(&b, `<span class="line" id="%s">%4d  %s</span>`+"\n", traceLineID(name, i+1), i+1, html.EscapeString(line))
+		}
+		b.WriteString("</pre>")
+	}
+	b.WriteString("</div>\n")
+
+	b.WriteString(traceHTMLFooter)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeSpansHTML writes output between start and end positions, with given spans
+func (t *Trace) writeSpansHTML(b *strings.Builder, spans []*TraceSpan, start int, end int) {
+	cur := start
+
+	for _, span := range spans {
+		if span.Start > cur {
+			b.WriteString(html.EscapeString(t.Output[cur:span.Start]))
+		}
+
+		title := fmt.Sprintf("%s, line %d: %s", traceTemplateLabel(span.Template), span.Loc.Line, span.Type)
+		if span.Helper != "" {
+			title += " (" + span.Helper + ")"
+		}
+
+		fmt.Fprintf(b, `<span class="chunk" title="%s" data-line="%s">`, html.EscapeString(title), traceLineID(span.Template, span.Loc.Line))
+		t.writeSpansHTML(b, span.Children, span.Start, span.End)
+		b.WriteString("</span>")
+
+		cur = span.End
+	}
+
+	if end > cur {
+		b.WriteString(html.EscapeString(t.Output[cur:end]))
+	}
+}
+
+// traceTemplateLabel returns label of template with given partial name
+func traceTemplateLabel(name string) string {
+	if name == "" {
+		return "(template)"
+	}
+	return name
+}
+
+// traceLineID returns HTML id of given source line
+func traceLineID(name string, line int) string {
+	return fmt.Sprintf("src-%x-%d", name, line)
+}
+
+const traceHTMLHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Render trace</title>
+<style>
+body { display: flex; font-family: sans-serif; margin: 0; }
+.pane { flex: 1; padding: 0 1em; overflow: auto; height: 100vh; }
+pre { background: #f6f8fa; padding: 1em; }
+.chunk { cursor: pointer; }
+.chunk:hover { background: #fff3b0; }
+.chunk.selected { background: #ffd54f; }
+.line.selected { background: #ffd54f; display: inline-block; width: 100%; }
+</style>
+</head>
+<body>
+`
+
+const traceHTMLFooter = `<script>
+document.querySelectorAll('.chunk').forEach(function(chunk) {
+  chunk.addEventListener('click', function(e) {
+    e.stopPropagation();
+    document.querySelectorAll('.selected').forEach(function(el) { el.classList.remove('selected'); });
+    chunk.classList.add('selected');
+    var line = document.getElementById(chunk.dataset.line);
+    if (line) { line.classList.add('selected'); line.scrollIntoView({block: 'center'}); }
+  });
+});
+</script>
+</body>
+</html>
+`
+
+//
+// Tracer
+//
+
+// traceFrame records output of an evaluated program
+type traceFrame struct {
+	template string
+	output   strings.Builder
+	spans    []*traceSpanFrames
+
+	// programs evaluated while evaluating current statement
+	pending []*traceFrame
+}
+
+// traceSpanFrames is a span, with output and relative positions, and the programs evaluated to produce it
+type traceSpanFrames struct {
+	span   *TraceSpan
+	output string
+	frames []*traceFrame
+}
+
+// tracer records, for each evaluated program, which statement produced each chunk of output
+type tracer struct {
+	root   *traceFrame
+	frames []*traceFrame
+
+	// sources of evaluated partials, by name
+	sources map[string]string
+
+	// partials names stack
+	names []string
+}
+
+func newTracer() *tracer {
+	return &tracer{
+		sources: make(map[string]string),
+	}
+}
+
+// enterPartial is called before evaluating partial with given name
+func (t *tracer) enterPartial(name string) {
+	t.names = append(t.names, name)
+}
+
+// partialSource is called with the source of the partial template that is evaluated for current partial name
+func (t *tracer) partialSource(source string) {
+	if len(t.names) > 0 {
+		t.sources[t.names[len(t.names)-1]] = source
+	}
+}
+
+// exitPartial is called after evaluating a partial
+func (t *tracer) exitPartial() {
+	t.names = t.names[:len(t.names)-1]
+}
+
+// traceState is a snapshot of tracer stacks
+type traceState struct {
+	frames  int
+	names   int
+	pending int
+}
+
+// state returns a snapshot of tracer stacks
+func (t *tracer) state() traceState {
+	s := traceState{frames: len(t.frames), names: len(t.names)}
+	if len(t.frames) > 0 {
+		s.pending = len(t.frames[len(t.frames)-1].pending)
+	}
+	return s
+}
+
+// restore restores tracer stacks to given snapshot: programs evaluated after that snapshot are discarded, as their
+// output was not written
+func (t *tracer) restore(s traceState) {
+	t.frames = t.frames[:s.frames]
+	t.names = t.names[:s.names]
+	if len(t.frames) > 0 {
+		frame := t.frames[len(t.frames)-1]
+		frame.pending = frame.pending[:s.pending]
+	}
+}
+
+// pushProgram is called before evaluating a program
+func (t *tracer) pushProgram() {
+	frame := &traceFrame{}
+	if len(t.names) > 0 {
+		frame.template = t.names[len(t.names)-1]
+	}
+
+	t.frames = append(t.frames, frame)
+}
+
+// popProgram is called after evaluating a program
+func (t *tracer) popProgram() {
+	frame := t.frames[len(t.frames)-1]
+	t.frames = t.frames[:len(t.frames)-1]
+
+	if len(t.frames) == 0 {
+		t.root = frame
+		return
+	}
+
+	parent := t.frames[len(t.frames)-1]
+	parent.pending = append(parent.pending, frame)
+}
+
+// statement is called after evaluating a program statement, with its output
+func (t *tracer) statement(node ast.Node, output string, helper string) {
+	frame := t.frames[len(t.frames)-1]
+
+	pending := frame.pending
+	frame.pending = nil
+
+	if output == "" {
+		return
+	}
+
+	start := frame.output.Len()
+	frame.output.WriteString(output)
+
+	frame.spans = append(frame.spans, &traceSpanFrames{
+		span: &TraceSpan{
+			Start:    start,
+			End:      start + len(output),
+			Node:     node,
+			Type:     traceNodeType(node),
+			Template: frame.template,
+			Loc:      node.Location(),
+			Helper:   helper,
+		},
+		output: output,
+		frames: pending,
+	})
+}
+
+// resolve computes absolute positions of spans, given absolute position of frame output
+func (frame *traceFrame) resolve(offset int) []*TraceSpan {
+	var result []*TraceSpan
+
+	for _, sf := range frame.spans {
+		span := sf.span
+		span.Start += offset
+		span.End += offset
+
+		// find programs outputs in statement output
+		cur := 0
+		for _, child := range sf.frames {
+			childOutput := child.output.String()
+			if childOutput == "" {
+				continue
+			}
+
+			i := strings.Index(sf.output[cur:], childOutput)
+			if i == -1 {
+				// output was transformed
+				continue
+			}
+
+			span.Children = append(span.Children, child.resolve(span.Start+cur+i)...)
+			cur += i + len(childOutput)
+		}
+
+		result = append(result, span)
+	}
+
+	return result
+}
+
+// traceNodeType returns type name of given statement node
+func traceNodeType(node ast.Node) string {
+	switch node.Type() {
+	case ast.NodeContent:
+		return "content"
+	case ast.NodeMustache:
+		return "mustache"
+	case ast.NodeBlock:
+		return "block"
+	case ast.NodePartial:
+		return "partial"
+	case ast.NodeComment:
+		return "comment"
+	}
+	return "unknown"
+}
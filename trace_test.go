@@ -0,0 +1,110 @@
+package mario_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_ExecuteTrace(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse("Hello {{name}}!\n{{#each items}}[{{this}}]{{/each}}{{> footer}}{{#upper}}abc{{/upper}}"))
+	tpl.WithPartial("footer", mario.Must(mario.New().Parse("<{{name}}>")))
+	tpl.WithHelperFunc("upper", func(options *mario.Options) string {
+		return strings.ToUpper(options.Fn())
+	})
+
+	var b strings.Builder
+	trace, err := tpl.ExecuteTrace(&b, map[string]interface{}{"name": "Mario", "items": []string{"a", "b"}}, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, "Hello Mario!\n[a][b]<Mario>ABC", b.String())
+	require.Equal(t, b.String(), trace.Output)
+
+	testcases := []struct {
+		pos      int
+		typ      string
+		template string
+		line     int
+		helper   string
+	}{
+		{0, "content", "", 1, ""},
+		{6, "mustache", "", 1, ""},
+		{13, "content", "", 2, ""},
+		{14, "mustache", "", 2, ""},
+		{17, "mustache", "", 2, ""},
+		{19, "content", "footer", 1, ""},
+		{20, "mustache", "footer", 1, ""},
+		{26, "block", "", 2, "upper"},
+	}
+
+	for _, tt := range testcases {
+		span := trace.SpanAt(tt.pos)
+		require.NotNil(t, span, tt.pos)
+		require.Equal(t, tt.typ, span.Type, tt.pos)
+		require.Equal(t, tt.template, span.Template, tt.pos)
+		require.Equal(t, tt.line, span.Loc.Line, tt.pos)
+		require.Equal(t, tt.helper, span.Helper, tt.pos)
+	}
+
+	require.Nil(t, trace.SpanAt(100))
+
+	require.Len(t, trace.Spans, 6)
+	require.Equal(t, "each", trace.Spans[3].Helper)
+	require.Equal(t, 13, trace.Spans[3].Start)
+	require.Equal(t, 19, trace.Spans[3].End)
+	require.Len(t, trace.Spans[3].Children, 6)
+	require.Equal(t, "<{{name}}>", trace.Sources["footer"])
+
+	data, err := trace.JSON()
+	require.NoError(t, err)
+	require.Contains(t, string(data), `{"start":6,"end":11,"type":"mustache","template":"","loc":{"Pos":6,"Line":1,"Column":6,"EndPos":14,"EndLine":1,"EndColumn":14}}`)
+
+	var h strings.Builder
+	require.NoError(t, trace.WriteHTML(&h))
+	require.Contains(t, h.String(), `<span class="chunk" title="footer, line 1: mustache" data-line="src-666f6f746572-1">Mario</span>`)
+}
+
+func TestTemplate_ExecuteTrace_NestedPartials(t *testing.T) {
+	set := mario.NewTemplateSet()
+	_, err := set.Parse("page", "{{> header}}{{body}}")
+	require.NoError(t, err)
+	_, err = set.Parse("header", "<h1>{{> title}}</h1>")
+	require.NoError(t, err)
+	_, err = set.Parse("title", "{{title}}")
+	require.NoError(t, err)
+
+	var b strings.Builder
+	trace, err := set.Lookup("page").ExecuteTrace(&b, map[string]string{"title": "foo", "body": "bar"}, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]string{
+		"":       "{{> header}}{{body}}",
+		"header": "<h1>{{> title}}</h1>",
+		"title":  "{{title}}",
+	}, trace.Sources)
+	require.Equal(t, "title", trace.SpanAt(4).Template)
+}
+
+func TestTemplate_ExecuteTrace_Interceptors(t *testing.T) {
+	profiler := mario.NewProfiler()
+
+	var calls int
+	tpl := mario.Must(mario.New().Parse("{{#if ok}}{{name}}{{/if}}")).
+		WithProfiler(profiler).
+		WithRenderInterceptor(func(call *mario.RenderCall, next func() error) error {
+			calls++
+			return next()
+		})
+
+	var b strings.Builder
+	trace, err := tpl.ExecuteTrace(&b, map[string]interface{}{"ok": true, "name": "Mario"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "Mario", trace.Output)
+	require.Equal(t, 1, calls)
+
+	entries := profiler.Entries()
+	require.Len(t, entries, 2)
+	require.Equal(t, 1, int(entries[0].Calls))
+}
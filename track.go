@@ -0,0 +1,159 @@
+package mario
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/imantung/mario/ast"
+)
+
+// trackIds mode
+//
+// Like handlebars.js `trackIds` compile option, helpers can get the source path of their params and hash values with
+// Options.ParamPath() and Options.HashPath(), and the `each` and `with` helpers set the `@contextPath` data to the
+// path of current context. Options.ParamID() and Options.HashID() return the ids like handlebars.js `options.ids` and
+// `options.hashIds`: the source path of a path expression, true for a subexpression, and nil for a literal.
+//
+// References:
+//   - https://github.com/wycats/handlebars.js/blob/master/lib/handlebars/compiler/compiler.js (pushParam)
+//   - https://github.com/wycats/handlebars.js/blob/master/lib/handlebars/utils.js (appendContextPath)
+
+// WithTrackIds enables the trackIds mode, where helpers can get the source paths of their params and hash values,
+// and the `@contextPath` data is set by `each` and `with` helpers.
+//
+// For example, with `{{#each users}}{{input email}}{{/each}}`, the `input` helper gets "email" with
+// options.ParamPath(0), and "users.0" with options.DataStr("contextPath") for the first user.
+func (tpl *Template) WithTrackIds() *Template {
+	tpl.trackIds = true
+	return tpl
+}
+
+// ParamPath returns the source path of parameter at given position, in trackIds mode. It returns an empty string
+// if that parameter is not a path, or if trackIds mode is not enabled.
+func (options *Options) ParamPath(pos int) string {
+	path, _ := options.ParamID(pos).(string)
+	return path
+}
+
+// HashPath returns the source path of hash value with given name, in trackIds mode. It returns an empty string
+// if that value is not a path, or if trackIds mode is not enabled.
+func (options *Options) HashPath(name string) string {
+	path, _ := options.HashID(name).(string)
+	return path
+}
+
+// ParamID returns the id of parameter at given position, in trackIds mode, like handlebars.js `options.ids`: the
+// source path of a path expression, true for a subexpression, and nil for a literal. It returns nil if there is no
+// such parameter, or if trackIds mode is not enabled.
+func (options *Options) ParamID(pos int) interface{} {
+	if len(options.paramIDs) > pos {
+		return options.paramIDs[pos]
+	}
+	return nil
+}
+
+// HashID returns the id of hash value with given name, in trackIds mode, like handlebars.js `options.hashIds`. It
+// returns nil if there is no such hash value, or if trackIds mode is not enabled.
+func (options *Options) HashID(name string) interface{} {
+	return options.hashIDs[name]
+}
+
+// contextPath returns the `@contextPath` for a block evaluated with the context given as first parameter
+func (options *Options) contextPath() string {
+	return appendContextPath(options.DataStr("contextPath"), options.ParamPath(0))
+}
+
+// appendContextPath appends given path to given context path
+func appendContextPath(contextPath string, path string) string {
+	if contextPath == "" {
+		return path
+	}
+	if path == "" {
+		return contextPath
+	}
+	return contextPath + "." + path
+}
+
+// trackedThisRegexp matches the `this` prefix that is removed from tracked paths
+var trackedThisRegexp = regexp.MustCompile(`^this(?:\.|$)`)
+
+// trackedID returns the id of given param node: its source path if it is a path expression, true if it is a
+// subexpression, and nil if it is a literal
+func (v *evaluator) trackedID(node ast.Node) interface{} {
+	switch n := node.(type) {
+	case *ast.PathExpression:
+		return v.trackedPath(n)
+	case *ast.SubExpression:
+		return true
+	}
+	return nil
+}
+
+// trackedPath returns the source path of given path expression
+func (v *evaluator) trackedPath(path *ast.PathExpression) string {
+	if !path.Data && (len(path.Parts) > 0) {
+		// block parameter: its path is the context path of the block that set it
+		if bpPath, ok := v.blockParamPath(path.Parts[0]); ok {
+			if bpPath == "" {
+				return ""
+			}
+			return appendContextPath(bpPath, strings.Join(path.Parts[1:], "."))
+		}
+	}
+
+	result := trackedThisRegexp.ReplaceAllString(path.Original, "")
+	result = strings.TrimPrefix(result, "./")
+	if result == "." {
+		result = ""
+	}
+
+	return result
+}
+
+// trackedIDs computes the ids of given expression params and hash values
+func (v *evaluator) trackedIDs(node *ast.Expression) ([]interface{}, map[string]interface{}) {
+	params := make([]interface{}, len(node.Params))
+	for i, param := range node.Params {
+		params[i] = v.trackedID(param)
+	}
+
+	hash := make(map[string]interface{})
+	if node.Hash != nil {
+		for _, pair := range node.Hash.Pairs {
+			hash[pair.Key] = v.trackedID(pair.Val)
+		}
+	}
+
+	return params, hash
+}
+
+// pushBlockParamsPaths pushes the paths of given block parameters: the first one has the path of the context that
+// is set by data frame, and the second one (index or key) has no path
+func (v *evaluator) pushBlockParamsPaths(names []string, data *DataFrame) {
+	paths := make(map[string]string)
+
+	for i, name := range names {
+		if (i == 0) && (data != nil) {
+			paths[name] = Str(data.Get("contextPath"))
+		} else {
+			paths[name] = ""
+		}
+	}
+
+	v.blockParamsPaths = append(v.blockParamsPaths, paths)
+}
+
+// popBlockParamsPaths pops last block parameters paths
+func (v *evaluator) popBlockParamsPaths() {
+	v.blockParamsPaths = v.blockParamsPaths[:len(v.blockParamsPaths)-1]
+}
+
+// blockParamPath returns the path of block parameter with given name, and false if there is no such block parameter
+func (v *evaluator) blockParamPath(name string) (string, bool) {
+	for i := len(v.blockParamsPaths) - 1; i >= 0; i-- {
+		if path, ok := v.blockParamsPaths[i][name]; ok {
+			return path, true
+		}
+	}
+	return "", false
+}
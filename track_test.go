@@ -0,0 +1,75 @@
+package mario_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/imantung/mario"
+	"github.com/stretchr/testify/require"
+)
+
+// inputHelper renders the tracked path of its param and hash values
+func inputHelper(value interface{}, options *mario.Options) string {
+	result := "[" + options.ParamPath(0)
+	for _, key := range []string{"label", "placeholder"} {
+		if _, ok := options.Hash()[key]; ok {
+			result += " " + key + ":" + options.HashPath(key)
+		}
+	}
+	return result + "]"
+}
+
+func execTrackIds(t *testing.T, source string, ctx interface{}) string {
+	tpl := mario.Must(mario.New().WithTrackIds().Parse(source)).WithHelperFunc("input", inputHelper)
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, ctx))
+	return b.String()
+}
+
+func TestTrackIds(t *testing.T) {
+	ctx := map[string]interface{}{
+		"user":    map[string]string{"email": "a@b.c", "name": "Mario"},
+		"users":   []map[string]string{{"email": "a@b.c"}, {"email": "d@e.f"}},
+		"company": map[string]interface{}{"users": []string{"luigi"}},
+	}
+
+	for _, test := range []struct {
+		source   string
+		expected string
+	}{
+		{`{{input user.email}}`, "[user.email]"},
+		{`{{input user/email}}`, "[user/email]"},
+		{`{{input this.user}} {{input ./user}} {{input this}}`, "[user] [user] []"},
+		{`{{input "literal" label=user.name placeholder=(input 1)}}`, "[ label:user.name placeholder:]"},
+		{`{{#with user}}{{input email}} {{@contextPath}}{{/with}}`, "[email] user"},
+		{`{{#each users}}{{input email}} {{@contextPath}},{{/each}}`, "[email] users.0,[email] users.1,"},
+		{`{{#each users as |u i|}}{{input u.email}} {{input i}},{{/each}}`, "[users.0.email] [],[users.1.email] [],"},
+		{`{{#with company}}{{#each users}}{{@contextPath}}{{/each}}{{/with}}`, "company.users.0"},
+		{`{{#with user as |u|}}{{input u}}{{/with}}`, "[user]"},
+	} {
+		require.Equal(t, test.expected, execTrackIds(t, test.source, ctx), test.source)
+	}
+}
+
+func TestTrackIds_Disabled(t *testing.T) {
+	tpl := mario.Must(mario.New().Parse(`{{#each users}}{{input email}}{{@contextPath}}{{/each}}`)).WithHelperFunc("input", inputHelper)
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, map[string]interface{}{"users": []map[string]string{{"email": "a@b.c"}}}))
+	require.Equal(t, "[]", b.String())
+}
+
+func TestTrackIds_IDs(t *testing.T) {
+	tpl := mario.Must(mario.New().WithTrackIds().Parse(`{{{ids user.name "a" 1 (upper user.name) k=(upper "b") l=null}}}`)).
+		WithHelperFunc("upper", strings.ToUpper).
+		WithHelperFunc("ids", func(name, a, b, upper interface{}, options *mario.Options) string {
+			return fmt.Sprintf("%#v %#v %#v %#v %#v %#v %#v", options.ParamID(0), options.ParamID(1), options.ParamID(2),
+				options.ParamID(3), options.HashID("k"), options.HashID("l"), options.ParamPath(3))
+		})
+
+	var b strings.Builder
+	require.NoError(t, tpl.Execute(&b, map[string]interface{}{"user": map[string]string{"name": "Mario"}}))
+	require.Equal(t, `"user.name" <nil> <nil> true true <nil> ""`, b.String())
+}